@@ -11,12 +11,12 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/types"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
 	userStore db.UserStore
+	guard     *LoginGuard
 }
 
 type AuthResponse struct {
@@ -29,12 +29,18 @@ type genericResp struct {
 	Msg  string `json:"msg"`
 }
 
-func NewAuthHandler(userStore db.UserStore) *AuthHandler {
+func NewAuthHandler(userStore db.UserStore, guard *LoginGuard) *AuthHandler {
 	return &AuthHandler{
 		userStore: userStore,
+		guard:     guard,
 	}
 }
 
+// dummyPasswordHash is checked against when the email is unknown, so such
+// a login takes as long as a wrong password. It has the cost of real
+// users' hashes.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), types.BcryptCost)
+
 // HandleAuthenticate authenticates a user
 // @Summary      User Login
 // @Description  Login with email and password to get a JWT token
@@ -45,34 +51,26 @@ func NewAuthHandler(userStore db.UserStore) *AuthHandler {
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
+// @Failure      423  {object}  types.Error  "Too many failed attempts for this email or address; see Retry-After"
+// @Failure      429  {object}  map[string]string  "Too many attempts from this address, or a failed login too recent; see Retry-After"
 // @Router       /auth [post]
 func (h *AuthHandler) HandleAuthenticate(c fiber.Ctx) error {
-	fmt.Println("\n🔥🔥🔥 HANDLER REACHED! 🔥🔥🔥")
-	rawBody := c.Body()
-	fmt.Printf("📦 Raw Body from Swagger: %s\n", string(rawBody))
 	var params types.AuthParams
 	if err := c.Bind().Body(&params); err != nil {
 		return types.ErrBadRequest()
 	}
-	fmt.Println("--- DEBUG LOGIN ---")
-	fmt.Printf("Input Params: %+v\n", params)
-	fmt.Printf("🔍 RECEIVED PARAMS: Email='%s' | Password='%s'\n", params.Email, params.Password)
-
-	fmt.Println("-------------------")
-
-	user, err := h.userStore.GetUserByEmail(c.Context(), params.Email)
-	if err != nil {
-		// احتمالا اینجا داره ارور میده
-		fmt.Println("DB Error:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
-
 	if errors := ValidateRequest(params); errors != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(errors)
 	}
-	user, err = h.userStore.GetUserByEmail(c.Context(), params.Email)
+	attempt, err := h.guard.begin(c, params.Email)
+	if err != nil {
+		return err
+	}
+	user, err := h.userStore.GetUserByEmail(c.Context(), params.Email)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
+		if errors.Is(err, db.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(params.Password))
+			h.guard.failed(c.Context(), attempt)
 			return invalidCredentials(c)
 		}
 		return err
@@ -80,9 +78,10 @@ func (h *AuthHandler) HandleAuthenticate(c fiber.Ctx) error {
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.EncryptedPassword), []byte(params.Password))
 	if err != nil {
-		fmt.Println("Password mismatch error:", err)
+		h.guard.failed(c.Context(), attempt)
 		return invalidCredentials(c)
 	}
+	h.guard.succeeded(c.Context(), attempt)
 
 	token := CreateTokenFromUser(user)
 	return c.JSON(AuthResponse{
@@ -91,6 +90,28 @@ func (h *AuthHandler) HandleAuthenticate(c fiber.Ctx) error {
 	})
 }
 
+// HandleUnlockUser lifts a login lockout (Admin only)
+// @Summary      Unlock a user's login
+// @Description  Forget the failed logins for a user's email, lifting its lockout and delays. Those counted for client addresses stay
+// @Tags         admin
+// @Produce      json
+// @Param        id   path  string  true  "User ID"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  types.Error
+// @Router       /admin/user/{id}/unlock [post]
+func (h *AuthHandler) HandleUnlockUser(c fiber.Ctx) error {
+	id := c.Params("id")
+	user, err := h.userStore.GetUserByID(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	if err := h.guard.unlock(c.Context(), user.Email); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"message": "user unlocked", "id": id})
+}
+
 func invalidCredentials(c fiber.Ctx) error {
 	return c.Status(http.StatusBadRequest).JSON(genericResp{
 		Type: "error",
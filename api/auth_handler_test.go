@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db/fixtures"
+	"github.com/raminfathi/GoTel/db/memory"
 	"github.com/raminfathi/GoTel/types"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthenticate(t *testing.T) {
@@ -20,7 +26,7 @@ func TestAuthenticate(t *testing.T) {
 	// 2. Setup Fiber App & Handler
 	app := fiber.New()
 	// Note: AuthHandler needs UserStore, so we pass tdb.store.User
-	authHandler := NewAuthHandler(tdb.store.User)
+	authHandler := NewAuthHandler(tdb.store.User, NewLoginGuard(memory.NewLoginAttemptStore(), DefaultLoginPolicy))
 	app.Post("/auth", authHandler.HandleAuthenticate)
 
 	// 3. Insert a test user into the database
@@ -90,3 +96,146 @@ func TestAuthenticate(t *testing.T) {
 		t.Errorf("expected http status 400 (or 401) but got %d", resp.StatusCode)
 	}
 }
+
+func TestLoginLockout(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	// Delays are short enough to wait out; a lockout is not.
+	policy := LoginPolicy{
+		Window:           time.Minute,
+		DelayAfter:       2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		AccountLockAfter: 3,
+		IPLockAfter:      100,
+		LockFor:          time.Minute,
+	}
+	authHandler := NewAuthHandler(tdb.store.User, NewLoginGuard(memory.NewLoginAttemptStore(), policy))
+	app.Post("/auth", authHandler.HandleAuthenticate)
+	app.Post("/admin/user/:id/unlock", authHandler.HandleUnlockUser)
+
+	user := fixtures.AddUser(tdb.store, "james", "foo", false)
+	login := func(email, password string) (*http.Response, string) {
+		t.Helper()
+		time.Sleep(10 * time.Millisecond)
+		body, _ := json.Marshal(types.AuthParams{Email: email, Password: password})
+		req := httptest.NewRequest("POST", "/auth", bytes.NewReader(body))
+		req.Header.Add("Content-Type", "application/json")
+		res, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	// A known and an unknown email go through the same steps.
+	var locked []string
+	for _, email := range []string{user.Email, "nobody@foo.com"} {
+		for i := 0; i < 3; i++ {
+			if res, _ := login(email, "wrong password"); res.StatusCode != http.StatusBadRequest {
+				t.Fatalf("%s: expected 400 for failure %d but got %d", email, i+1, res.StatusCode)
+			}
+		}
+		res, body := login(email, "james_foo")
+		if res.StatusCode != http.StatusLocked || res.Header.Get("Retry-After") != "60" {
+			t.Fatalf("%s: expected 423 with Retry-After once locked but got %d %v", email, res.StatusCode, res.Header)
+		}
+		locked = append(locked, body)
+	}
+	if locked[0] != locked[1] {
+		t.Errorf("expected the lockout not to tell whether the email exists but got %s and %s", locked[0], locked[1])
+	}
+
+	res, err := app.Test(httptest.NewRequest("POST", "/admin/user/"+user.ID.Hex()+"/unlock", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 unlocking the user but got %d", res.StatusCode)
+	}
+	if res, _ := login(user.Email, "james_foo"); res.StatusCode != http.StatusOK {
+		t.Errorf("expected an unlocked user to log in but got %d", res.StatusCode)
+	}
+	if res, _ := login("nobody@foo.com", "james_foo"); res.StatusCode != http.StatusLocked {
+		t.Errorf("expected other emails to stay locked but got %d", res.StatusCode)
+	}
+}
+
+func TestLoginLockoutConcurrent(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	policy := LoginPolicy{
+		Window:           time.Minute,
+		DelayAfter:       100,
+		AccountLockAfter: 3,
+		IPLockAfter:      12,
+		LockFor:          time.Minute,
+	}
+	authHandler := NewAuthHandler(tdb.store.User, NewLoginGuard(memory.NewLoginAttemptStore(), policy))
+	app.Post("/auth", authHandler.HandleAuthenticate)
+
+	user := fixtures.AddUser(tdb.store, "james", "foo", false)
+	login := func(email, password string) int {
+		body, _ := json.Marshal(types.AuthParams{Email: email, Password: password})
+		req := httptest.NewRequest("POST", "/auth", bytes.NewReader(body))
+		req.Header.Add("Content-Type", "application/json")
+		res, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		return res.StatusCode
+	}
+
+	// Logins that succeed do not count against the address.
+	for i := 0; i < policy.IPLockAfter+1; i++ {
+		if status := login(user.Email, "james_foo"); status != http.StatusOK {
+			t.Fatalf("login %d: expected 200 but got %d", i+1, status)
+		}
+	}
+
+	// Guesses made at once get no more password checks than the lockout
+	// allows.
+	statuses := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- login(user.Email, "wrong password")
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	checked := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusBadRequest:
+			checked++
+		case http.StatusLocked:
+		default:
+			t.Errorf("expected 400 or 423 but got %d", status)
+		}
+	}
+	if checked != policy.AccountLockAfter {
+		t.Errorf("expected %d passwords checked before the lockout but got %d", policy.AccountLockAfter, checked)
+	}
+}
+
+// TestDummyPasswordHashCost checks that a login for an unknown email costs
+// as much as a wrong password for a real user.
+func TestDummyPasswordHashCost(t *testing.T) {
+	user, err := types.NewUserFromParams(types.CreateUserParams{Email: "james@foo.com", Password: "supersecure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userCost, _ := bcrypt.Cost([]byte(user.EncryptedPassword))
+	if cost, err := bcrypt.Cost(dummyPasswordHash); err != nil || cost != userCost {
+		t.Errorf("expected the dummy hash to cost %d like a user's but got %d, %v", userCost, cost, err)
+	}
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// exportPageSize is how many bookings an export reads at a time. Only the
+// current page is held in memory while the response streams.
+var exportPageSize int64 = db.MaxPageLimit
+
+// bookingRow is a booking with its guest, room and hotel joined in. Those
+// are looked up even if deleted, and are nil if they do not exist at all.
+type bookingRow struct {
+	Booking *types.Booking
+	User    *types.User
+	Room    *types.Room
+	Hotel   *types.Hotel
+}
+
+// bookingRows pages through the bookings matching a filter. Rooms and
+// hotels are remembered for the whole export; users only for a page.
+type bookingRows struct {
+	store  *db.Store
+	filter db.BookingFilter
+	cursor string
+	done   bool
+	rooms  map[bson.ObjectID]*types.Room
+	hotels map[bson.ObjectID]*types.Hotel
+}
+
+func newBookingRows(store *db.Store, filter db.BookingFilter) *bookingRows {
+	return &bookingRows{
+		store:  store,
+		filter: filter,
+		rooms:  map[bson.ObjectID]*types.Room{},
+		hotels: map[bson.ObjectID]*types.Hotel{},
+	}
+}
+
+// next returns the next page of rows, or none once all have been read.
+func (r *bookingRows) next(ctx context.Context) ([]bookingRow, error) {
+	if r.done {
+		return nil, nil
+	}
+	// Each page is read once, so caching it would only crowd out entries
+	// that are read again.
+	bookings, page, err := r.store.Booking.GetBookings(db.WithoutCache(ctx), r.filter, &db.Pagination{Limit: exportPageSize, Cursor: r.cursor})
+	if err != nil {
+		return nil, err
+	}
+	r.cursor = page.NextCursor
+	r.done = r.cursor == ""
+
+	ctx = db.WithDeleted(ctx)
+	users := map[bson.ObjectID]*types.User{}
+	rows := make([]bookingRow, len(bookings))
+	for i, booking := range bookings {
+		row := bookingRow{Booking: booking}
+		if row.User, err = lookup(ctx, users, booking.UserID, r.store.User.GetUserByID); err != nil {
+			return nil, err
+		}
+		if row.Room, err = lookup(ctx, r.rooms, booking.RoomID, r.store.Room.GetRoomByID); err != nil {
+			return nil, err
+		}
+		if row.Room != nil {
+			if row.Hotel, err = lookup(ctx, r.hotels, row.Room.HotelID, r.store.Hotel.GetHotelByID); err != nil {
+				return nil, err
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// lookup gets the record with the given id through seen, fetching it on a
+// miss. A record that does not exist is remembered as nil.
+func lookup[T any](ctx context.Context, seen map[bson.ObjectID]*T, id bson.ObjectID, get func(context.Context, string) (*T, error)) (*T, error) {
+	if v, ok := seen[id]; ok {
+		return v, nil
+	}
+	v, err := get(ctx, id.Hex())
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	seen[id] = v
+	return v, nil
+}
+
+// bookingEncoder writes an export in some file format.
+type bookingEncoder interface {
+	header() error
+	row(bookingRow) error
+	footer() error
+}
+
+// streamBookings sends the bookings matching the query as an attachment.
+// The first page is read up front so a failing store still gets a proper
+// error status; later failures can only cut the file short.
+func (h *BookingHandler) streamBookings(c fiber.Ctx, filename, contentType string, newEncoder func(*bufio.Writer) bookingEncoder) error {
+	filter, _, err := bindBookingQuery(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	rows := newBookingRows(h.store, filter)
+	page, err := rows.next(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(filename)
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		enc := newEncoder(w)
+		err := enc.header()
+		for err == nil && len(page) > 0 {
+			for _, row := range page {
+				if err = enc.row(row); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = w.Flush()
+			}
+			if err == nil {
+				page, err = rows.next(ctx)
+			}
+		}
+		if err == nil {
+			err = enc.footer()
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Printf("booking export %s: %v", filename, err)
+		}
+	})
+}
+
+// HandleExportBookingsCSV streams bookings as CSV (Admin only)
+// @Summary      Export bookings as CSV
+// @Description  Stream the bookings matching the filters as CSV, one row per booking with the guest, room and hotel joined in
+// @Tags         admin
+// @Produce      text/csv
+// @Param        userId  query  string  false "Filter by user"
+// @Param        roomId  query  string  false "Filter by room"
+// @Param        hotelId query  string  false "Filter by hotel"
+// @Param        from    query  string  false "Stays overlapping from this date (YYYY-MM-DD)"
+// @Param        till    query  string  false "Stays overlapping until this date (YYYY-MM-DD)"
+// @Param        status  query  string  false "active or canceled"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {file}  file
+// @Router       /admin/booking/export.csv [get]
+func (h *BookingHandler) HandleExportBookingsCSV(c fiber.Ctx) error {
+	return h.streamBookings(c, "bookings.csv", "text/csv; charset=utf-8", func(w *bufio.Writer) bookingEncoder {
+		return &csvBookingEncoder{w: csv.NewWriter(w)}
+	})
+}
+
+// HandleExportBookingsICS streams bookings as an iCalendar file (Admin only)
+// @Summary      Export bookings as iCalendar
+// @Description  Stream the bookings matching the filters as an .ics calendar with an all-day event per stay
+// @Tags         admin
+// @Produce      text/calendar
+// @Param        userId  query  string  false "Filter by user"
+// @Param        roomId  query  string  false "Filter by room"
+// @Param        hotelId query  string  false "Filter by hotel"
+// @Param        from    query  string  false "Stays overlapping from this date (YYYY-MM-DD)"
+// @Param        till    query  string  false "Stays overlapping until this date (YYYY-MM-DD)"
+// @Param        status  query  string  false "active or canceled"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {file}  file
+// @Router       /admin/booking/export.ics [get]
+func (h *BookingHandler) HandleExportBookingsICS(c fiber.Ctx) error {
+	return h.streamBookings(c, "bookings.ics", "text/calendar; charset=utf-8", func(w *bufio.Writer) bookingEncoder {
+		return &icsBookingEncoder{w: w, stamp: time.Now().UTC()}
+	})
+}
+
+var bookingCSVHeader = []string{
+	"bookingId", "status", "fromDate", "tillDate", "nights", "numPersons",
+	"userId", "userName", "userEmail",
+	"roomId", "roomType", "price",
+	"hotelId", "hotelName", "hotelLocation",
+	"createdAt",
+}
+
+type csvBookingEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvBookingEncoder) header() error {
+	return e.w.Write(bookingCSVHeader)
+}
+
+func (e *csvBookingEncoder) row(r bookingRow) error {
+	b := r.Booking
+	record := []string{
+		b.ID.Hex(), bookingStatus(b), date(b.FromDate), date(b.TillDate),
+		strconv.Itoa(len(db.BookingNights(b.FromDate, b.TillDate))), strconv.Itoa(b.NumPersons),
+		b.UserID.Hex(), "", "",
+		b.RoomID.Hex(), "", "",
+		"", "", "",
+		b.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if r.User != nil {
+		record[7], record[8] = userName(r.User), r.User.Email
+	}
+	if r.Room != nil {
+		record[10], record[11] = r.Room.Type.String(), strconv.FormatFloat(r.Room.Price, 'f', 2, 64)
+		record[12] = r.Room.HotelID.Hex()
+	}
+	if r.Hotel != nil {
+		record[13], record[14] = r.Hotel.Name, r.Hotel.Location
+	}
+	for i, field := range record {
+		record[i] = csvSafe(field)
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvBookingEncoder) footer() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvSafe keeps spreadsheets from running names and emails as formulas.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type icsBookingEncoder struct {
+	w     *bufio.Writer
+	stamp time.Time
+}
+
+func (e *icsBookingEncoder) header() error {
+	return e.lines(
+		"BEGIN", "VCALENDAR",
+		"VERSION", "2.0",
+		"PRODID", "-//GoTel//Bookings//EN",
+		"CALSCALE", "GREGORIAN",
+		"METHOD", "PUBLISH",
+	)
+}
+
+// row writes the stay as an all-day event. DTEND is the check-out day,
+// which iCalendar excludes.
+func (e *icsBookingEncoder) row(r bookingRow) error {
+	b := r.Booking
+	nights := db.BookingNights(b.FromDate, b.TillDate)
+	start := nights[0]
+	end := nights[len(nights)-1].AddDate(0, 0, 1)
+
+	guest, hotel, location, room := "unknown guest", "unknown hotel", "", "room"
+	if r.User != nil {
+		guest = userName(r.User)
+	}
+	if r.Hotel != nil {
+		hotel, location = r.Hotel.Name, r.Hotel.Location
+	}
+	if r.Room != nil {
+		room = r.Room.Type.String() + " room"
+	}
+	status := "CONFIRMED"
+	if b.Canceled {
+		status = "CANCELLED"
+	}
+	description := fmt.Sprintf("Booking %s\nRoom %s\n%d guests", b.ID.Hex(), b.RoomID.Hex(), b.NumPersons)
+
+	return e.lines(
+		"BEGIN", "VEVENT",
+		"UID", b.ID.Hex()+"@gotel",
+		"DTSTAMP", e.stamp.Format("20060102T150405Z"),
+		"DTSTART;VALUE=DATE", start.Format("20060102"),
+		"DTEND;VALUE=DATE", end.Format("20060102"),
+		"SUMMARY", icsText(fmt.Sprintf("%s: %s, %s", hotel, guest, room)),
+		"LOCATION", icsText(location),
+		"DESCRIPTION", icsText(description),
+		"STATUS", status,
+		"END", "VEVENT",
+	)
+}
+
+func (e *icsBookingEncoder) footer() error {
+	return e.lines("END", "VCALENDAR")
+}
+
+// lines writes name, value pairs as content lines, folded after 75 octets
+// as RFC 5545 asks.
+func (e *icsBookingEncoder) lines(pairs ...string) error {
+	for i := 0; i < len(pairs); i += 2 {
+		line := pairs[i] + ":" + pairs[i+1]
+		for len(line) > 75 {
+			cut := 75
+			for !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if _, err := e.w.WriteString(line[:cut] + "\r\n "); err != nil {
+				return err
+			}
+			line = line[cut:]
+		}
+		if _, err := e.w.WriteString(line + "\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icsText escapes a TEXT value.
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func bookingStatus(b *types.Booking) string {
+	if b.Canceled {
+		return string(db.BookingStatusCanceled)
+	}
+	return string(db.BookingStatusActive)
+}
+
+func userName(u *types.User) string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+func date(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
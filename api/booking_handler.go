@@ -1,17 +1,68 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
-	"time"
+	"net/http"
 
 	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/types"
 
 	"github.com/gofiber/fiber/v3"
-	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+type BookingQueryParams struct {
+	db.Pagination
+	UserID  string `query:"userId"`
+	RoomID  string `query:"roomId"`
+	HotelID string `query:"hotelId"`
+	From    string `query:"from"`
+	Till    string `query:"till"`
+	Status  string `query:"status"`
+}
+
+// filter converts the query into a store filter, rejecting malformed ids,
+// dates and statuses with a 400.
+func (p BookingQueryParams) filter() (db.BookingFilter, error) {
+	var (
+		f   db.BookingFilter
+		err error
+	)
+	if f.UserID, err = parseQueryID(p.UserID); err != nil {
+		return f, err
+	}
+	if f.RoomID, err = parseQueryID(p.RoomID); err != nil {
+		return f, err
+	}
+	if f.HotelID, err = parseQueryID(p.HotelID); err != nil {
+		return f, err
+	}
+	if f.From, err = parseQueryDate("from", p.From); err != nil {
+		return f, err
+	}
+	if f.Till, err = parseQueryDate("till", p.Till); err != nil {
+		return f, err
+	}
+	switch status := db.BookingStatus(p.Status); status {
+	case "", db.BookingStatusActive, db.BookingStatusCanceled:
+		f.Status = status
+	default:
+		return f, types.NewError(http.StatusBadRequest, "status must be active or canceled")
+	}
+	return f, nil
+}
+
+// bindBookingQuery reads the booking filter and pagination from the query string.
+func bindBookingQuery(c fiber.Ctx) (db.BookingFilter, db.Pagination, error) {
+	var params BookingQueryParams
+	if err := c.Bind().Query(&params); err != nil {
+		return db.BookingFilter{}, params.Pagination, types.ErrBadRequest()
+	}
+	if err := checkPagination(&params.Pagination); err != nil {
+		return db.BookingFilter{}, params.Pagination, err
+	}
+	filter, err := params.filter()
+	return filter, params.Pagination, err
+}
+
 type BookingHandler struct {
 	store *db.Store
 }
@@ -28,27 +79,34 @@ func NewBookingHandler(store *db.Store) *BookingHandler {
 // @Tags         booking
 // @Accept       json
 // @Produce      json
+// @Param        roomId  query  string  false "Filter by room"
+// @Param        hotelId query  string  false "Filter by hotel"
+// @Param        from    query  string  false "Stays overlapping from this date (YYYY-MM-DD)"
+// @Param        till    query  string  false "Stays overlapping until this date (YYYY-MM-DD)"
+// @Param        status  query  string  false "active or canceled"
+// @Param        limit   query  int     false "Page size"
+// @Param        page    query  int     false "Page number"
+// @Param        cursor  query  string  false "Cursor from a previous page"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}   types.Booking
+// @Success      200  {object}  types.ResourceResp
 // @Router       /booking [get]
 func (h *BookingHandler) HandleGetMyBookings(c fiber.Ctx) error {
 	user, err := getAuthUser(c)
 	if err != nil {
 		return types.ErrUnAuthorized()
 	}
-
-	filter := bson.M{"userID": user.ID}
-
-	bookings, err := h.store.Booking.GetBookings(c.Context(), filter)
+	filter, pag, err := bindBookingQuery(c)
 	if err != nil {
-		return types.ErrResourceNotFound("bookings")
+		return err
 	}
+	filter.UserID = user.ID
 
-	if bookings == nil {
-		return c.JSON([]*types.Booking{})
+	bookings, page, err := h.store.Booking.GetBookings(c.Context(), filter, &pag)
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(bookings)
+	return c.JSON(newResourceResp(bookings, len(bookings), page))
 }
 
 // HandleCancelBooking cancels a booking
@@ -65,7 +123,7 @@ func (h *BookingHandler) HandleCancelBooking(c fiber.Ctx) error {
 	id := c.Params("id")
 	booking, err := h.store.Booking.GetBookingByID(c.Context(), id)
 	if err != nil {
-		return types.ErrResourceNotFound("booking")
+		return err
 	}
 	user, err := getAuthUser(c)
 	if err != nil {
@@ -80,7 +138,7 @@ func (h *BookingHandler) HandleCancelBooking(c fiber.Ctx) error {
 			Msg:  "booking already canceled",
 		})
 	}
-	if err := h.store.Booking.UpdateBooking(c.Context(), id, bson.M{"canceled": true}); err != nil {
+	if err := h.store.Booking.CancelBooking(c.Context(), id); err != nil {
 		return err
 	}
 	return c.JSON(genericResp{
@@ -95,17 +153,33 @@ func (h *BookingHandler) HandleCancelBooking(c fiber.Ctx) error {
 // @Tags         admin
 // @Accept       json
 // @Produce      json
+// @Param        userId  query  string  false "Filter by user"
+// @Param        roomId  query  string  false "Filter by room"
+// @Param        hotelId query  string  false "Filter by hotel"
+// @Param        from    query  string  false "Stays overlapping from this date (YYYY-MM-DD)"
+// @Param        till    query  string  false "Stays overlapping until this date (YYYY-MM-DD)"
+// @Param        status  query  string  false "active or canceled"
+// @Param        limit   query  int     false "Page size"
+// @Param        page    query  int     false "Page number"
+// @Param        cursor  query  string  false "Cursor from a previous page"
+// @Param        includeDeleted query bool false "Include deleted bookings"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}   types.Booking
+// @Success      200  {object}  types.ResourceResp
 // @Router       /admin/booking [get]
 func (h *BookingHandler) HandleGetBookings(c fiber.Ctx) error {
-	booking, err := h.store.Booking.GetBookings(c.Context(), bson.M{})
+	filter, pag, err := bindBookingQuery(c)
 	if err != nil {
-		return types.ErrResourceNotFound("bookings")
+		return err
 	}
-	fmt.Println(booking)
-	return c.JSON(booking)
-
+	ctx, _, err := readContext(c)
+	if err != nil {
+		return err
+	}
+	bookings, page, err := h.store.Booking.GetBookings(ctx, filter, &pag)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newResourceResp(bookings, len(bookings), page))
 }
 
 // HandleGetBooking returns a specific booking
@@ -119,33 +193,13 @@ func (h *BookingHandler) HandleGetBookings(c fiber.Ctx) error {
 // @Success      200  {object}  types.Booking
 // @Router       /booking/{id} [get]
 func (h *BookingHandler) HandleGetBooking(c fiber.Ctx) error {
-	id := c.Params("id")
-	cacheKey := fmt.Sprintf("booking-%s", id)
-	val, err := h.store.Cache.Get(c.Context(), cacheKey)
-	if err == nil && val != "" {
-		fmt.Println("--->> Serving from CACHE")
-
-		var booking types.Booking
-		if err := json.Unmarshal([]byte(val), &booking); err == nil {
-			if err := h.checkBookingOwner(c, &booking); err != nil {
-				return err
-			}
-			return c.JSON(booking)
-		}
-	}
-	fmt.Println("--->> Serving from MongoDB")
-	booking, err := h.store.Booking.GetBookingByID(c.Context(), id)
+	booking, err := h.store.Booking.GetBookingByID(c.Context(), c.Params("id"))
 	if err != nil {
-		return types.ErrResourceNotFound("booking")
+		return err
 	}
 	if err := h.checkBookingOwner(c, booking); err != nil {
 		return err
 	}
-
-	serialized, err := json.Marshal(booking)
-	if err == nil {
-		h.store.Cache.Set(c.Context(), cacheKey, serialized, time.Minute*1)
-	}
 	return c.JSON(booking)
 }
 
@@ -2,13 +2,19 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/db/fixtures"
 	"github.com/raminfathi/GoTel/types"
 )
@@ -65,4 +71,203 @@ func TestBookRoom(t *testing.T) {
 	if booking.NumPersons != 2 {
 		t.Errorf("expected 2 persons but got %d", booking.NumPersons)
 	}
+
+	// An overlapping stay is refused as a conflict.
+	bookingParams.FromDate = bookingParams.FromDate.AddDate(0, 0, 2)
+	bookingParams.TillDate = bookingParams.TillDate.AddDate(0, 0, 2)
+	body, _ = json.Marshal(bookingParams)
+	req = httptest.NewRequest("POST", route, bytes.NewReader(body))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for an overlapping booking but got %d", resp.StatusCode)
+	}
+}
+
+func TestBookRoomOfDeletedHotel(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	app.Post("/room/:id/book", func(c fiber.Ctx) error {
+		c.Locals("user", user)
+		return c.Next()
+	}, NewRoomHandler(tdb.store).HandleBookRoom)
+
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	// A delete that got as far as the hotel leaves its rooms behind.
+	if err := tdb.store.Hotel.DeleteHotel(context.Background(), hotel.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(types.BookRoomParams{
+		FromDate:   time.Now().AddDate(0, 0, 1),
+		TillDate:   time.Now().AddDate(0, 0, 3),
+		NumPersons: 2,
+	})
+	req := httptest.NewRequest("POST", "/room/"+room.ID.Hex()+"/book", bytes.NewReader(body))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 booking a room of a deleted hotel but got %d", resp.StatusCode)
+	}
+}
+
+func TestGetBookingsFilters(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	bookingHandler := NewBookingHandler(tdb.store)
+	app.Get("/admin/booking", bookingHandler.HandleGetBookings)
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	other := fixtures.AddHotel(tdb.store, "Budget Inn", "Paris", 2, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	otherRoom := fixtures.AddRoom(tdb.store, types.Single, 50.0, other.ID)
+
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	booking := fixtures.AddBooking(tdb.store, user.ID, room.ID, from, from.AddDate(0, 0, 2))
+	fixtures.AddBooking(tdb.store, user.ID, otherRoom.ID, from.AddDate(0, 0, 30), from.AddDate(0, 0, 32))
+
+	resp := getResourceResp(t, app, "/admin/booking?hotelId="+hotel.ID.Hex())
+	if resp.Total != 1 {
+		t.Fatalf("expected 1 booking for %s but got %d", hotel.Name, resp.Total)
+	}
+	resp = getResourceResp(t, app, fmt.Sprintf("/admin/booking?from=%s&till=%s",
+		from.Format(time.DateOnly), from.AddDate(0, 0, 1).Format(time.DateOnly)))
+	if resp.Total != 1 {
+		t.Fatalf("expected 1 booking in range but got %d", resp.Total)
+	}
+	data, _ := json.Marshal(resp.Data)
+	var bookings []types.Booking
+	if err := json.Unmarshal(data, &bookings); err != nil {
+		t.Fatal(err)
+	}
+	if bookings[0].ID != booking.ID {
+		t.Errorf("expected booking %s but got %s", booking.ID, bookings[0].ID)
+	}
+	resp = getResourceResp(t, app, "/admin/booking?status=canceled")
+	if resp.Total != 0 {
+		t.Errorf("expected no canceled bookings but got %d", resp.Total)
+	}
+
+	for _, target := range []string{
+		"/admin/booking?status=pending",
+		"/admin/booking?from=yesterday",
+		"/admin/booking?roomId=123",
+	} {
+		res, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s but got %d", target, res.StatusCode)
+		}
+	}
+}
+
+func TestExportBookings(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	bookingHandler := NewBookingHandler(tdb.store)
+	app.Get("/admin/booking/export.csv", bookingHandler.HandleExportBookingsCSV)
+	app.Get("/admin/booking/export.ics", bookingHandler.HandleExportBookingsICS)
+
+	defer func(size int64) { exportPageSize = size }(exportPageSize)
+	exportPageSize = 2
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London, UK", 5, nil)
+	other := fixtures.AddHotel(tdb.store, "Budget Inn", "Paris", 2, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	otherRoom := fixtures.AddRoom(tdb.store, types.Single, 50.0, other.ID)
+
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	for i := 0; i < 3; i++ {
+		start := from.AddDate(0, 0, 3*i)
+		fixtures.AddBooking(tdb.store, user.ID, room.ID, start, start.AddDate(0, 0, 2))
+	}
+	fixtures.AddBooking(tdb.store, user.ID, otherRoom.ID, from, from.AddDate(0, 0, 1))
+
+	export := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := export("/admin/booking/export.csv?hotelId=" + hotel.ID.Hex())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") || !strings.Contains(resp.Header.Get("Content-Disposition"), "bookings.csv") {
+		t.Errorf("expected a CSV attachment but got %v", resp.Header)
+	}
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected a header and 3 bookings across pages but got %d records", len(records))
+	}
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[name] = i
+	}
+	row := records[1]
+	if row[column["userName"]] != "james bond" || row[column["roomType"]] != "double" || row[column["hotelName"]] != hotel.Name ||
+		row[column["hotelLocation"]] != hotel.Location || row[column["fromDate"]] != from.Format(time.DateOnly) || row[column["nights"]] != "2" {
+		t.Errorf("expected the booking joined with its guest, room and hotel but got %v", row)
+	}
+
+	// Export pages are read once and must not fill the cache.
+	family, _ := db.CacheFamilyByName("bookings")
+	if n, err := tdb.store.Cache.CountPrefix(context.Background(), family.Prefix); err != nil || n != 0 {
+		t.Errorf("expected no cached booking pages after an export but got %d, %v", n, err)
+	}
+
+	resp, body = export("/admin/booking/export.ics?roomId=" + otherRoom.ID.Hex())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar") {
+		t.Errorf("expected a calendar but got %s", resp.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART;VALUE=DATE:" + from.Format("20060102") + "\r\n",
+		"DTEND;VALUE=DATE:" + from.AddDate(0, 0, 1).Format("20060102") + "\r\n",
+		"SUMMARY:Budget Inn: james bond\\, single room\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected the calendar to contain %q but got\n%s", line, body)
+		}
+	}
+	if n := strings.Count(body, "BEGIN:VEVENT"); n != 1 {
+		t.Errorf("expected 1 event but got %d", n)
+	}
+
+	if resp, _ := export("/admin/booking/export.csv?from=yesterday"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad date but got %d", resp.StatusCode)
+	}
 }
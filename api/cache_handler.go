@@ -0,0 +1,78 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+)
+
+type CacheHandler struct {
+	store *db.Store
+}
+
+// NewCacheHandler manages the cache of store, which must come from
+// db.NewCachedStore.
+func NewCacheHandler(store *db.Store) *CacheHandler {
+	return &CacheHandler{
+		store: store,
+	}
+}
+
+// HandleGetCache lists the cached families (Admin only)
+// @Summary      List cache families
+// @Description  List each family of cached reads with the keys it has in the cache and the hits and misses this instance has seen since it started
+// @Tags         admin
+// @Produce      json
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {array}  types.CacheFamilyStats
+// @Router       /admin/cache [get]
+func (h *CacheHandler) HandleGetCache(c fiber.Ctx) error {
+	families, err := h.store.CacheStats.Families(c.Context(), h.store.Cache)
+	if err != nil {
+		return err
+	}
+	return c.JSON(families)
+}
+
+// HandleDeleteCacheFamily purges a family (Admin only)
+// @Summary      Purge a cache family
+// @Description  Drop every cached key of a family: hotel, hotels, room, rooms, hotel-rooms, booking or bookings
+// @Tags         admin
+// @Produce      json
+// @Param        family path string true "Family"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  types.CachePurgeReport
+// @Failure      404  {object}  types.Error
+// @Router       /admin/cache/{family} [delete]
+func (h *CacheHandler) HandleDeleteCacheFamily(c fiber.Ctx) error {
+	family, ok := db.CacheFamilyByName(c.Params("family"))
+	if !ok {
+		return types.NewError(fiber.StatusNotFound, "unknown cache family")
+	}
+	if err := h.store.Cache.DeletePrefix(c.Context(), family.Prefix); err != nil {
+		return err
+	}
+	return c.JSON(types.CachePurgeReport{Family: family.Name})
+}
+
+// HandleDeleteCacheKey purges a single key (Admin only)
+// @Summary      Purge a cache key
+// @Description  Drop one cached key, which must belong to a cache family
+// @Tags         admin
+// @Produce      json
+// @Param        key path string true "Key, such as hotel-<id>"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  types.CachePurgeReport
+// @Failure      400  {object}  types.Error
+// @Router       /admin/cache/key/{key} [delete]
+func (h *CacheHandler) HandleDeleteCacheKey(c fiber.Ctx) error {
+	key := c.Params("key")
+	family, ok := db.CacheFamilyOf(key)
+	if !ok {
+		return types.NewError(fiber.StatusBadRequest, "key is not in a cache family")
+	}
+	if err := h.store.Cache.Delete(c.Context(), key); err != nil {
+		return err
+	}
+	return c.JSON(types.CachePurgeReport{Family: family.Name, Key: key})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db/fixtures"
+	"github.com/raminfathi/GoTel/types"
+)
+
+func TestCacheAdmin(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	cacheHandler := NewCacheHandler(tdb.store)
+	app.Get("/hotel", hotelHandler.HandleGetHotels)
+	app.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	app.Get("/admin/cache", cacheHandler.HandleGetCache)
+	app.Delete("/admin/cache/key/:key", cacheHandler.HandleDeleteCacheKey)
+	app.Delete("/admin/cache/:family", cacheHandler.HandleDeleteCacheFamily)
+
+	grand := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	lodge := fixtures.AddHotel(tdb.store, "City Lodge", "London", 3, nil)
+	do := func(method, target string) *http.Response {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(method, target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	for _, target := range []string{"/hotel/" + grand.ID.Hex(), "/hotel/" + grand.ID.Hex(), "/hotel/" + lodge.ID.Hex(), "/hotel"} {
+		if res := do("GET", target); res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: expected 200 but got %d", target, res.StatusCode)
+		}
+	}
+
+	families := func() map[string]types.CacheFamilyStats {
+		t.Helper()
+		res := do("GET", "/admin/cache")
+		var list []types.CacheFamilyStats
+		if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		byName := map[string]types.CacheFamilyStats{}
+		for _, family := range list {
+			byName[family.Family] = family
+		}
+		return byName
+	}
+	got := families()
+	if hotel := got["hotel"]; hotel.Keys != 2 || hotel.Hits != 1 || hotel.Misses != 2 || hotel.Prefix != "hotel-" {
+		t.Errorf("unexpected hotel family %+v", hotel)
+	}
+	if hotels := got["hotels"]; hotels.Keys != 1 || hotels.Misses != 1 {
+		t.Errorf("unexpected hotels family %+v", hotels)
+	}
+
+	if res := do("DELETE", "/admin/cache/key/hotel-"+grand.ID.Hex()); res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 purging a key but got %d", res.StatusCode)
+	}
+	if res := do("DELETE", "/admin/cache/key/views:hotels"); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a key outside the families but got %d", res.StatusCode)
+	}
+	if keys := families()["hotel"].Keys; keys != 1 {
+		t.Errorf("expected 1 hotel key left but got %d", keys)
+	}
+
+	if res := do("DELETE", "/admin/cache/hotels"); res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 purging a family but got %d", res.StatusCode)
+	}
+	if res := do("DELETE", "/admin/cache/users"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown family but got %d", res.StatusCode)
+	}
+	got = families()
+	if got["hotels"].Keys != 0 || got["hotel"].Keys != 1 {
+		t.Errorf("expected only the hotels family purged but got %+v and %+v", got["hotels"], got["hotel"])
+	}
+}
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/types" // Import types here as well
 )
 
@@ -11,6 +13,27 @@ func ErrorHandler(c fiber.Ctx, err error) error {
 	if apiError, ok := err.(types.Error); ok {
 		return c.Status(apiError.Code).JSON(apiError)
 	}
-	apiError := types.NewError(http.StatusInternalServerError, err.Error())
+	apiError := toAPIError(err)
 	return c.Status(apiError.Code).JSON(apiError)
 }
+
+// toAPIError maps store and framework errors to the status code they mean,
+// falling back to 500 for anything unexpected.
+func toAPIError(err error) types.Error {
+	var fiberErr *fiber.Error
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return types.NewError(http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrInvalidID):
+		return types.ErrInvalidID()
+	case errors.Is(err, db.ErrInvalidCursor):
+		return types.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrDuplicate), errors.Is(err, db.ErrConflict):
+		return types.NewError(http.StatusConflict, err.Error())
+	case errors.Is(err, db.ErrStaleVersion):
+		return types.NewError(http.StatusPreconditionFailed, err.Error())
+	case errors.As(err, &fiberErr):
+		return types.NewError(fiberErr.Code, fiberErr.Message)
+	}
+	return types.NewError(http.StatusInternalServerError, err.Error())
+}
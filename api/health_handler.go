@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+)
+
+type HealthHandler struct {
+	cache *db.CacheBreaker
+}
+
+// NewHealthHandler reports on cache, which is nil when the API runs
+// without one.
+func NewHealthHandler(cache *db.CacheBreaker) *HealthHandler {
+	return &HealthHandler{
+		cache: cache,
+	}
+}
+
+// HandleGetHealth reports whether the API is degraded
+// @Summary      Health check
+// @Description  Report the state of the API. It answers 200 while degraded, e.g. while the cache breaker is open and reads go straight to the database
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  types.Health
+// @Router       /health [get]
+func (h *HealthHandler) HandleGetHealth(c fiber.Ctx) error {
+	health := types.Health{Status: "ok"}
+	if h.cache != nil {
+		status := h.cache.Status()
+		health.Cache = &status
+		if status.State != db.CacheBreakerClosed {
+			health.Status = "degraded"
+		}
+	}
+	return c.JSON(health)
+}
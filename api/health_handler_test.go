@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/types"
+)
+
+func TestGetHealth(t *testing.T) {
+	pingErr := errors.New("connection refused")
+	breaker := db.NewCacheBreaker(memory.NewCacheStore(), func(context.Context) error { return pingErr }, db.DefaultCacheBreakerOptions)
+	defer breaker.Close()
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/health", NewHealthHandler(breaker).HandleGetHealth)
+	get := func() types.Health {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("GET", "/health", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != fiber.StatusOK {
+			t.Fatalf("expected 200 but got %d", res.StatusCode)
+		}
+		var health types.Health
+		if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+			t.Fatal(err)
+		}
+		return health
+	}
+
+	if health := get(); health.Status != "ok" || health.Cache.State != db.CacheBreakerClosed {
+		t.Errorf("expected ok with a closed breaker but got %+v", health)
+	}
+	breaker.Probe(context.Background())
+	if health := get(); health.Status != "degraded" || health.Cache.State != db.CacheBreakerOpen || health.Cache.LastError != pingErr.Error() {
+		t.Errorf("expected degraded with an open breaker but got %+v", health)
+	}
+}
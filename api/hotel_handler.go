@@ -1,10 +1,12 @@
 package api
 
 import (
-	"encoding/json"
+	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/importer"
 	"github.com/raminfathi/GoTel/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 
@@ -28,36 +30,36 @@ func NewHotelHandler(store *db.Store) *HotelHandler {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "Hotel ID"
+// @Param        limit  query   int     false "Page size"
+// @Param        page   query   int     false "Page number"
+// @Param        cursor query   string  false "Cursor from a previous page"
+// @Param        If-None-Match header string false "Entity tag of the copy held"
+// @Param        If-Modified-Since header string false "Last-Modified of the copy held"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}   types.Room
+// @Success      200  {object}  types.ResourceResp
+// @Header       200  {string}  ETag  "Weak tag of the page"
+// @Header       200  {string}  Last-Modified  "Latest update among the rooms"
+// @Success      304  {string}  string  "Not modified"
 // @Router       /hotel/{id}/rooms [get]
 func (h *HotelHandler) HandleGetRooms(c fiber.Ctx) error {
 	id := c.Params("id")
-	cacheKey := "hotel-rooms-" + c.OriginalURL()
-
-	val, err := h.store.Cache.Get(c.Context(), cacheKey)
-	if err == nil && val != "" {
-		var rooms []*types.Room
-		if err := json.Unmarshal([]byte(val), &rooms); err == nil {
-			return c.JSON(rooms)
-		}
-	}
-
 	oid, err := bson.ObjectIDFromHex(id)
 	if err != nil {
 		return types.ErrInvalidID()
 	}
-	filter := bson.M{"hotelID": oid}
-	rooms, err := h.store.Room.GetRooms(c.Context(), filter)
+	pag, err := bindPagination(c)
+	if err != nil {
+		return err
+	}
+	rooms, page, err := h.store.Room.GetRooms(c.Context(), db.RoomFilter{HotelID: oid}, &pag)
 	if err != nil {
-		return types.ErrResourceNotFound("rooms")
+		return err
 	}
-	serialized, err := json.Marshal(rooms)
-	if err == nil {
-		h.store.Cache.Set(c.Context(), cacheKey, serialized, time.Minute*1)
+	etag, modified := pageValidators(rooms, page, roomVersion)
+	if notModified(c, etag, modified) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
-
-	return c.JSON(rooms)
+	return c.JSON(newResourceResp(rooms, len(rooms), page))
 }
 
 // HandleGetHotel returns a single hotel
@@ -67,43 +69,44 @@ func (h *HotelHandler) HandleGetRooms(c fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "Hotel ID"
+// @Param        includeDeleted query bool false "Also find a deleted hotel (admins only)"
+// @Param        If-None-Match header string false "Entity tag of the copy held"
+// @Param        If-Modified-Since header string false "Last-Modified of the copy held"
 // @Param        X-Api-Token header string true "Token"
 // @Success      200  {object}  types.Hotel
+// @Header       200  {string}  ETag  "Hotel version, for If-Match on update"
+// @Header       200  {string}  Last-Modified  "When the hotel was last updated"
+// @Success      304  {string}  string  "Not modified"
 // @Failure      404  {object}  map[string]string
 // @Router       /hotel/{id} [get]
 func (h *HotelHandler) HandleGetHotel(c fiber.Ctx) error {
 
 	id := c.Params("id")
 
-	cacheKey := "hotel-" + id
-
-	val, err := h.store.Cache.Get(c.Context(), cacheKey)
-	if err == nil && val != "" {
-		var hotel types.Hotel
-		if err := json.Unmarshal([]byte(val), &hotel); err == nil {
-			return c.JSON(hotel)
-		}
+	ctx, _, err := readContext(c)
+	if err != nil {
+		return err
 	}
-	// oid, err := bson.ObjectIDFromHex(id)
-	// if err != nil {
-	// 	return types.ErrInvalidID()
-	// }
-	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), id)
+	hotel, err := h.store.Hotel.GetHotelByID(ctx, id)
 	if err != nil {
-		return types.ErrResourceNotFound("hotel")
+		return err
 	}
-	serialized, err := json.Marshal(hotel)
-	if err == nil {
-		h.store.Cache.Set(c.Context(), cacheKey, serialized, time.Minute*5)
+	if notModified(c, versionETag(hotel.Version), hotel.UpdatedAt) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
-
 	return c.JSON(hotel)
 
 }
 
 type HotelQueryParams struct {
 	db.Pagination
-	Rating int
+	Rating   int    `query:"rating"`
+	Location string `query:"location"`
+	// Near is "lat,lng"; Radius is in meters and needs Near.
+	Near   string  `query:"near"`
+	Radius float64 `query:"radius"`
+	// Q searches name, location and description; it excludes Near.
+	Q string `query:"q"`
 }
 
 // HandleGetHotels returns all hotels
@@ -112,46 +115,110 @@ type HotelQueryParams struct {
 // @Tags         hotel
 // @Accept       json
 // @Produce      json
+// @Param        rating   query int     false "Filter by rating"
+// @Param        location query string  false "Filter by location (case-insensitive substring)"
+// @Param        near     query string  false "Only hotels with coordinates, nearest to lat,lng first, with their distance in meters"
+// @Param        radius   query number  false "Maximum distance in meters from near"
+// @Param        q        query string  false "Search name, location and description by word, best matches first, with their score; needs a letter or digit"
+// @Param        limit  query   int     false "Page size"
+// @Param        page   query   int     false "Page number"
+// @Param        cursor query   string  false "Cursor from a previous page"
+// @Param        includeDeleted query bool false "Include deleted hotels (admins only)"
+// @Param        If-None-Match header string false "Entity tag of the copy held"
+// @Param        If-Modified-Since header string false "Last-Modified of the copy held"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}   types.Hotel
+// @Success      200  {object}  types.ResourceResp
+// @Header       200  {string}  ETag  "Weak tag of the page"
+// @Header       200  {string}  Last-Modified  "Latest update among the hotels"
+// @Success      304  {string}  string  "Not modified"
 // @Router       /hotel [get]
 func (h *HotelHandler) HandleGetHotels(c fiber.Ctx) error {
 	var params HotelQueryParams
 	if err := c.Bind().Query(&params); err != nil {
 		return types.ErrBadRequest()
 	}
-	cacheKey := "hotels-" + c.OriginalURL()
-	val, err := h.store.Cache.Get(c.Context(), cacheKey)
-	if err == nil && val != "" {
-		var cachedResp types.ResourceResp
-		if err := json.Unmarshal([]byte(val), &cachedResp); err == nil {
-			return c.JSON(cachedResp)
-		}
-
+	if err := checkPagination(&params.Pagination); err != nil {
+		return err
 	}
-
-	filter := db.Map{}
-	if params.Rating > 0 {
-		filter["rating"] = params.Rating
+	near, err := parseQueryPoint("near", params.Near)
+	if err != nil {
+		return err
 	}
-
-	hotels, err := h.store.Hotel.GetHotels(c.Context(), filter, &params.Pagination)
+	if params.Radius < 0 || (params.Radius > 0 && near == nil) {
+		return types.NewError(fiber.StatusBadRequest, "radius must be positive and needs near")
+	}
+	// Every backend searches by the words of q, so one without any would
+	// match differently on each.
+	if params.Q != "" && len(db.SearchTerms(params.Q)) == 0 {
+		return types.NewError(fiber.StatusBadRequest, "q must contain a letter or digit")
+	}
+	if near != nil && params.Q != "" {
+		return types.NewError(fiber.StatusBadRequest, "near and q cannot be combined")
+	}
+	if (near != nil || params.Q != "") && params.Cursor != "" {
+		return types.NewError(fiber.StatusBadRequest, "near and q searches page by number, not cursor")
+	}
+	ctx, _, err := readContext(c)
 	if err != nil {
-		return types.ErrResourceNotFound("hotels")
+		return err
 	}
 
-	resp := types.ResourceResp{
-		Data:    hotels,
-		Results: len(hotels),
-		Page:    int(params.Page),
+	filter := db.HotelFilter{
+		Rating:   params.Rating,
+		Location: params.Location,
+		Near:     near,
+		Radius:   params.Radius,
+		Query:    params.Q,
+	}
+	hotels, page, err := h.store.Hotel.GetHotels(ctx, filter, &params.Pagination)
+	if err != nil {
+		return err
 	}
+	etag, modified := pageValidators(hotels, page, hotelVersion)
+	if notModified(c, etag, modified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.JSON(newResourceResp(hotels, len(hotels), page))
+}
 
-	return c.JSON(resp)
-	serialized, err := json.Marshal(resp)
-	if err == nil {
-		h.store.Cache.Set(c.Context(), cacheKey, serialized, time.Second*30)
+type HotelSuggestParams struct {
+	Prefix string `query:"prefix"`
+	Limit  int    `query:"limit"`
+}
+
+const (
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 20
+)
+
+// HandleGetHotelSuggestions autocompletes hotel locations
+// @Summary      Suggest locations
+// @Description  List the hotel locations starting with a prefix, ignoring case, those with the most hotels first
+// @Tags         hotel
+// @Produce      json
+// @Param        prefix query string true  "Start of the location"
+// @Param        limit  query int    false "Maximum number of suggestions (default 5, at most 20)"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {array}  types.LocationSuggestion
+// @Router       /hotel/suggest [get]
+func (h *HotelHandler) HandleGetHotelSuggestions(c fiber.Ctx) error {
+	var params HotelSuggestParams
+	if err := c.Bind().Query(&params); err != nil {
+		return types.ErrBadRequest()
+	}
+	if params.Prefix == "" {
+		return types.NewError(fiber.StatusBadRequest, "prefix is required")
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultSuggestLimit
+	}
+	params.Limit = min(params.Limit, maxSuggestLimit)
+	suggestions, err := h.store.Hotel.SuggestLocations(c.Context(), params.Prefix, params.Limit)
+	if err != nil {
+		return err
 	}
-	return c.JSON(resp)
+	return c.JSON(suggestions)
 }
 
 // HandlePostHotel adds a new hotel (Admin only)
@@ -175,10 +242,12 @@ func (h *HotelHandler) HandlePostHotel(c fiber.Ctx) error {
 	}
 
 	hotel := types.Hotel{
-		Name:     params.Name,
-		Location: params.Location,
-		Rating:   0,
-		Rooms:    []bson.ObjectID{},
+		Name:        params.Name,
+		Location:    params.Location,
+		Description: params.Description,
+		Rating:      0,
+		Rooms:       []bson.ObjectID{},
+		Coordinates: params.Coordinates(),
 	}
 
 	insertedHotel, err := h.store.Hotel.InsertHotel(c.Context(), &hotel)
@@ -189,6 +258,44 @@ func (h *HotelHandler) HandlePostHotel(c fiber.Ctx) error {
 	return c.JSON(insertedHotel)
 }
 
+type ImportHotelsParams struct {
+	// Format is csv or json; it defaults to the body's Content-Type.
+	Format string `query:"format"`
+	DryRun bool   `query:"dryRun"`
+}
+
+// HandleImportHotels adds hotels with their rooms in bulk (Admin only)
+// @Summary      Import hotels
+// @Description  Add hotels with nested rooms from a CSV or JSON body. Every row is validated; a hotel is only imported if it and all its rooms are valid. The report tells how each row fared.
+// @Tags         admin
+// @Accept       json
+// @Accept       text/csv
+// @Produce      json
+// @Param        request body   []types.ImportHotel true  "Hotels, or CSV with the columns name,location,description,lat,lng,roomType,basePrice"
+// @Param        format  query  string false "csv or json (default from Content-Type)"
+// @Param        dryRun  query  bool   false "Validate only, without adding anything"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  types.ImportReport
+// @Router       /admin/hotel/import [post]
+func (h *HotelHandler) HandleImportHotels(c fiber.Ctx) error {
+	var params ImportHotelsParams
+	if err := c.Bind().Query(&params); err != nil {
+		return types.ErrBadRequest()
+	}
+	if params.Format == "" {
+		params.Format = c.Get(fiber.HeaderContentType)
+	}
+	format, err := importer.ParseFormat(params.Format)
+	if err != nil {
+		return types.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	hotels, err := importer.Read(bytes.NewReader(c.Body()), format)
+	if err != nil {
+		return types.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return c.JSON(importer.Import(c.Context(), h.store, hotels, params.DryRun))
+}
+
 // HandlePutHotel (Admin Only)
 // HandlePutHotel updates a hotel (Admin only)
 // @Summary      Update a hotel
@@ -198,8 +305,11 @@ func (h *HotelHandler) HandlePostHotel(c fiber.Ctx) error {
 // @Produce      json
 // @Param        id      path    string                true  "Hotel ID"
 // @Param        request body    types.UpdateHotelParams true  "Update Data"
+// @Param        If-Match header string false "ETag from GET /hotel/{id}; the update fails with 412 if the hotel changed since"
 // @Param        X-Api-Token header string true "Token"
 // @Success      200     {object}  map[string]string
+// @Header       200     {string}  ETag  "New hotel version"
+// @Failure      412     {object}  types.Error
 // @Router       /admin/hotel/{id} [put]
 func (h *HotelHandler) HandlePutHotel(c fiber.Ctx) error {
 	id := c.Params("id")
@@ -208,27 +318,118 @@ func (h *HotelHandler) HandlePutHotel(c fiber.Ctx) error {
 	if err := c.Bind().Body(&params); err != nil {
 		return types.ErrBadRequest()
 	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
 
-	updateData := db.Map{}
-	if params.Name != "" {
-		updateData["name"] = params.Name
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
 	}
-	if params.Location != "" {
-		updateData["location"] = params.Location
+
+	if err := h.store.Hotel.UpdateHotel(c.Context(), id, params, version); err != nil {
+		return err
 	}
 
-	oid, err := bson.ObjectIDFromHex(id)
+	hotel, err := h.store.Hotel.GetHotelByID(c.Context(), id)
 	if err != nil {
-		return types.ErrInvalidID()
+		return err
 	}
 
-	filter := db.Map{"_id": oid}
+	setETag(c, hotel.Version)
+	return c.JSON(db.Map{"msg": "updated successfully"})
+}
 
-	if err := h.store.Hotel.UpdateHotel(c.Context(), filter, updateData); err != nil {
+type DeleteHotelParams struct {
+	Force bool `query:"force"`
+}
+
+// HandleDeleteHotel removes a hotel and its rooms (Admin only)
+// @Summary      Delete a hotel
+// @Description  Delete a hotel together with its rooms. Hotels with upcoming bookings are only deleted with force=true, which cancels those bookings. The hotel is deleted first, so retrying a delete that failed partway finishes it.
+// @Tags         admin
+// @Produce      json
+// @Param        id    path   string  true   "Hotel ID"
+// @Param        force query  bool    false  "Cancel upcoming bookings instead of refusing"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  types.DeleteHotelReport
+// @Failure      404  {object}  types.Error
+// @Failure      409  {object}  types.Error
+// @Router       /admin/hotel/{id} [delete]
+func (h *HotelHandler) HandleDeleteHotel(c fiber.Ctx) error {
+	id := c.Params("id")
+
+	var params DeleteHotelParams
+	if err := c.Bind().Query(&params); err != nil {
+		return types.ErrBadRequest()
+	}
+	// Deleted hotels are looked up too, so that retrying a delete that
+	// failed partway finishes the cascade.
+	hotel, err := h.store.Hotel.GetHotelByID(db.WithDeleted(c.Context()), id)
+	if err != nil {
 		return err
 	}
 
-	// h.store.Cache.Delete(c.Context(), "hotel-"+id)
+	upcoming, _, err := h.store.Booking.GetBookings(c.Context(), db.BookingFilter{
+		HotelID: hotel.ID,
+		From:    time.Now(),
+		Status:  db.BookingStatusActive,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if len(upcoming) > 0 && !params.Force {
+		return types.NewError(fiber.StatusConflict,
+			fmt.Sprintf("hotel has %d upcoming bookings; retry with force=true to cancel them", len(upcoming)))
+	}
 
-	return c.JSON(db.Map{"msg": "updated successfully"})
+	// The cached stores record the cache keys the cascade drops in purged.
+	ctx, purged := db.WithPurgedKeys(c.Context())
+	report := types.DeleteHotelReport{
+		HotelID:          hotel.ID,
+		DeletedRooms:     []bson.ObjectID{},
+		CanceledBookings: []bson.ObjectID{},
+	}
+	// The hotel goes first so that a failure below leaves it deleted rather
+	// than half-emptied. HandleBookRoom refuses the rooms of a deleted
+	// hotel from then on.
+	if hotel.DeletedAt == nil {
+		if err := h.store.Hotel.DeleteHotel(ctx, id); err != nil {
+			return err
+		}
+	}
+	// Rooms are looked up by hotel rather than taken from hotel.Rooms so
+	// that rooms whose link was lost are removed as well.
+	rooms, _, err := h.store.Room.GetRooms(ctx, db.RoomFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		if err := h.store.Room.DeleteRoom(ctx, room.ID.Hex()); err != nil {
+			return err
+		}
+		report.DeletedRooms = append(report.DeletedRooms, room.ID)
+	}
+	// Bookings are read again once the rooms are gone, which also cancels
+	// those made after the check above by requests that found the hotel
+	// still there. Only a booking that passed HandleBookRoom's checks and
+	// is stored after this read can escape.
+	upcoming, _, err = h.store.Booking.GetBookings(ctx, db.BookingFilter{
+		HotelID: hotel.ID,
+		From:    time.Now(),
+		Status:  db.BookingStatusActive,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	for _, booking := range upcoming {
+		if err := h.store.Booking.CancelBooking(ctx, booking.ID.Hex()); err != nil {
+			return err
+		}
+		report.CanceledBookings = append(report.CanceledBookings, booking.ID)
+	}
+
+	report.PurgedCacheKeys = purged.Keys()
+
+	return c.JSON(report)
 }
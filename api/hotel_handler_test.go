@@ -0,0 +1,502 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/fixtures"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGetHotelsPagination(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	for i := 0; i < 3; i++ {
+		fixtures.AddHotel(tdb.store, fmt.Sprintf("Hotel %d", i), "London", 4, nil)
+	}
+
+	resp := getResourceResp(t, app, "/hotel?limit=2")
+	if resp.Results != 2 || resp.Total != 3 || resp.TotalPages != 2 || resp.Page != 1 {
+		t.Fatalf("unexpected first page %+v", resp)
+	}
+	if resp.NextCursor == "" {
+		t.Fatal("expected a next cursor on the first page")
+	}
+
+	resp = getResourceResp(t, app, "/hotel?limit=2&cursor="+resp.NextCursor)
+	if resp.Results != 1 || resp.NextCursor != "" {
+		t.Fatalf("unexpected last page %+v", resp)
+	}
+
+	req := httptest.NewRequest("GET", "/hotel?cursor=bogus", nil)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad cursor but got %d", res.StatusCode)
+	}
+}
+
+func TestGetHotelsNear(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	far := fixtures.AddHotelAt(tdb.store, "Parsian Azadi", "Tehran", 4, 35.7891, 51.3758)
+	nearby := fixtures.AddHotelAt(tdb.store, "Espinas Palace", "Tehran", 5, 35.7563, 51.4137)
+	fixtures.AddHotel(tdb.store, "Unmapped", "Tehran", 3, nil)
+
+	resp := getResourceResp(t, app, "/hotel?near=35.7575,51.4100")
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hotels []types.Hotel
+	if err := json.Unmarshal(data, &hotels); err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 2 || hotels[0].ID != nearby.ID || hotels[1].ID != far.ID {
+		t.Fatalf("expected %s then %s but got %+v", nearby.Name, far.Name, hotels)
+	}
+	if hotels[0].Distance == nil || hotels[1].Distance == nil || *hotels[0].Distance >= *hotels[1].Distance {
+		t.Errorf("expected increasing distances but got %v and %v", hotels[0].Distance, hotels[1].Distance)
+	}
+
+	resp = getResourceResp(t, app, "/hotel?near=35.7575,51.4100&radius=2000")
+	if resp.Total != 1 {
+		t.Errorf("expected 1 hotel within 2km but got %d", resp.Total)
+	}
+
+	for _, target := range []string{
+		"/hotel?near=35.7575",
+		"/hotel?near=north,south",
+		"/hotel?near=95,51.41",
+		"/hotel?radius=2000",
+		"/hotel?near=35.7575,51.4100&radius=-1",
+	} {
+		res, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s but got %d", target, res.StatusCode)
+		}
+	}
+}
+
+func TestGetHotelsSearch(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel/suggest", hotelHandler.HandleGetHotelSuggestions)
+	app.Get("/hotel", hotelHandler.HandleGetHotels)
+
+	palace := fixtures.AddHotel(tdb.store, "Espinas Palace", "Tehran", 5, nil)
+	fixtures.AddHotel(tdb.store, "Palace Garden", "Tabriz", 4, nil)
+	fixtures.AddHotel(tdb.store, "Grand Hotel", "Tehran", 5, nil)
+
+	resp := getResourceResp(t, app, "/hotel?q=palace&rating=5")
+	if resp.Total != 1 || resp.Results != 1 {
+		t.Fatalf("expected 1 rating 5 palace but got %+v", resp)
+	}
+	if id := resp.Data.([]any)[0].(map[string]any)["id"]; id != palace.ID.Hex() {
+		t.Errorf("expected %s but got %v", palace.ID.Hex(), id)
+	}
+
+	res, err := app.Test(httptest.NewRequest("GET", "/hotel/suggest?prefix=t", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suggestions []types.LocationSuggestion
+	if err := json.NewDecoder(res.Body).Decode(&suggestions); err != nil {
+		t.Fatal(err)
+	}
+	want := []types.LocationSuggestion{{Location: "Tehran", Hotels: 2}, {Location: "Tabriz", Hotels: 1}}
+	if !slices.Equal(suggestions, want) {
+		t.Errorf("expected %v but got %v", want, suggestions)
+	}
+
+	for _, target := range []string{
+		"/hotel?q=palace&near=35.75,51.41",
+		"/hotel?q=!!!",
+		"/hotel?q=palace&cursor=" + db.EncodeCursor(palace.ID),
+		"/hotel/suggest",
+	} {
+		res, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s but got %d", target, res.StatusCode)
+		}
+	}
+}
+
+func getResourceResp(t *testing.T, app *fiber.App, target string) types.ResourceResp {
+	t.Helper()
+	res, err := app.Test(httptest.NewRequest("GET", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for %s but got %d", target, res.StatusCode)
+	}
+	var resp types.ResourceResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestPutHotelIfMatch(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	app.Put("/hotel/:id", hotelHandler.HandlePutHotel)
+
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	target := "/hotel/" + hotel.ID.Hex()
+
+	res, err := app.Test(httptest.NewRequest("GET", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := res.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\" but got %q", etag)
+	}
+
+	put := func(ifMatch, name string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("PUT", target, strings.NewReader(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res = put(etag, "Grander Hotel")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", res.StatusCode)
+	}
+	if got := res.Header.Get("ETag"); got != `"2"` {
+		t.Errorf("expected the update to return ETag \"2\" but got %q", got)
+	}
+	// A second admin still holding the first ETag must not overwrite it.
+	if res := put(etag, "Other Hotel"); res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a stale ETag but got %d", res.StatusCode)
+	}
+	if res := put("2", "Other Hotel"); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed If-Match but got %d", res.StatusCode)
+	}
+
+	// GET must not serve the pre-update copy from the cache.
+	res, err = app.Test(httptest.NewRequest("GET", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got types.Hotel
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Grander Hotel" || res.Header.Get("ETag") != `"2"` {
+		t.Errorf("expected Grander Hotel with ETag \"2\" but got %s with %s", got.Name, res.Header.Get("ETag"))
+	}
+}
+
+func TestGetHotelNotModified(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel", hotelHandler.HandleGetHotels)
+	app.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	app.Get("/hotel/:id/rooms", hotelHandler.HandleGetRooms)
+	app.Put("/hotel/:id", hotelHandler.HandlePutHotel)
+
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	fixtures.AddRoom(tdb.store, types.Single, 100, hotel.ID)
+
+	get := func(target string, header ...string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, target := range []string{"/hotel", "/hotel/" + hotel.ID.Hex(), "/hotel/" + hotel.ID.Hex() + "/rooms"} {
+		res := get(target)
+		etag, modified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+		if res.StatusCode != http.StatusOK || etag == "" || modified == "" || res.Header.Get("Cache-Control") != "private, no-cache" {
+			t.Fatalf("%s: expected 200 with validators but got %d %v", target, res.StatusCode, res.Header)
+		}
+		res = get(target, "If-None-Match", `"other", `+etag)
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusNotModified || len(body) != 0 || res.Header.Get("ETag") != etag {
+			t.Errorf("%s: expected an empty 304 for a matching If-None-Match but got %d %q", target, res.StatusCode, body)
+		}
+		if res := get(target, "If-Modified-Since", modified); res.StatusCode != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for If-Modified-Since but got %d", target, res.StatusCode)
+		}
+		// If-None-Match decides alone when both are sent.
+		if res := get(target, "If-None-Match", `"other"`, "If-Modified-Since", modified); res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200 for a different If-None-Match but got %d", target, res.StatusCode)
+		}
+	}
+
+	etags := map[string]string{}
+	for _, target := range []string{"/hotel", "/hotel/" + hotel.ID.Hex(), "/hotel/" + hotel.ID.Hex() + "/rooms"} {
+		etags[target] = get(target).Header.Get("ETag")
+	}
+	req := httptest.NewRequest("PUT", "/hotel/"+hotel.ID.Hex(), strings.NewReader(`{"name":"Grander Hotel"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if res, err := app.Test(req); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the update to succeed but got %v %v", res, err)
+	}
+	fixtures.AddRoom(tdb.store, types.Double, 150, hotel.ID)
+	for target, etag := range etags {
+		if res := get(target, "If-None-Match", etag); res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200 after a write but got %d", target, res.StatusCode)
+		}
+	}
+}
+
+func TestDeleteHotel(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	app.Delete("/admin/hotel/:id", hotelHandler.HandleDeleteHotel)
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	other := fixtures.AddRoom(tdb.store, types.Single, 50.0, hotel.ID)
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	booking := fixtures.AddBooking(tdb.store, user.ID, room.ID, from, from.AddDate(0, 0, 2))
+
+	target := "/hotel/" + hotel.ID.Hex()
+	// Warm the cache so the delete has something to purge.
+	if res, err := app.Test(httptest.NewRequest("GET", target, nil)); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 warming the cache but got %v, %v", res, err)
+	}
+
+	del := func(query string) *http.Response {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("DELETE", "/admin/hotel/"+hotel.ID.Hex()+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := del(""); res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a hotel with an upcoming booking but got %d", res.StatusCode)
+	}
+
+	res := del("?force=true")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 with force but got %d", res.StatusCode)
+	}
+	var report types.DeleteHotelReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DeletedRooms) != 2 || !slices.Contains(report.DeletedRooms, room.ID) || !slices.Contains(report.DeletedRooms, other.ID) {
+		t.Errorf("expected rooms %s and %s deleted but got %v", room.ID, other.ID, report.DeletedRooms)
+	}
+	if len(report.CanceledBookings) != 1 || report.CanceledBookings[0] != booking.ID {
+		t.Errorf("expected booking %s canceled but got %v", booking.ID, report.CanceledBookings)
+	}
+	if !slices.Contains(report.PurgedCacheKeys, "hotel-"+hotel.ID.Hex()) {
+		t.Errorf("expected the hotel cache key purged but got %v", report.PurgedCacheKeys)
+	}
+
+	// The cached copy must be gone, not just the stored hotel.
+	res, err := app.Test(httptest.NewRequest("GET", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted hotel but got %d", res.StatusCode)
+	}
+	ctx := context.Background()
+	if _, err := tdb.store.Room.GetRoomByID(ctx, room.ID.Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected the room to be deleted but got %v", err)
+	}
+	bookings, _, err := tdb.store.Booking.GetBookings(ctx, db.BookingFilter{UserID: user.ID, Status: db.BookingStatusCanceled}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Errorf("expected the booking to be canceled but got %d canceled bookings", len(bookings))
+	}
+}
+
+// failingRoomStore fails to delete one room.
+type failingRoomStore struct {
+	db.RoomStore
+	fail bson.ObjectID
+}
+
+func (s *failingRoomStore) DeleteRoom(ctx context.Context, id string) error {
+	if id == s.fail.Hex() {
+		return errors.New("room store unavailable")
+	}
+	return s.RoomStore.DeleteRoom(ctx, id)
+}
+
+func TestDeleteHotelRetry(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	stuck := fixtures.AddRoom(tdb.store, types.Single, 50.0, hotel.ID)
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	booking := fixtures.AddBooking(tdb.store, user.ID, room.ID, from, from.AddDate(0, 0, 2))
+
+	failing := *tdb.store
+	failing.Room = &failingRoomStore{RoomStore: tdb.store.Room, fail: stuck.ID}
+	del := func(store *db.Store) *http.Response {
+		t.Helper()
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Delete("/admin/hotel/:id", NewHotelHandler(store).HandleDeleteHotel)
+		res, err := app.Test(httptest.NewRequest("DELETE", "/admin/hotel/"+hotel.ID.Hex()+"?force=true", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := del(&failing); res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when a room cannot be deleted but got %d", res.StatusCode)
+	}
+	ctx := context.Background()
+	if _, err := tdb.store.Hotel.GetHotelByID(ctx, hotel.ID.Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected the hotel to be deleted before its rooms but got %v", err)
+	}
+	if _, err := tdb.store.Room.GetRoomByID(ctx, stuck.ID.Hex()); err != nil {
+		t.Fatalf("expected the room that failed to remain but got %v", err)
+	}
+
+	res := del(tdb.store)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to succeed but got %d", res.StatusCode)
+	}
+	var report types.DeleteHotelReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(report.DeletedRooms, stuck.ID) {
+		t.Errorf("expected the retry to delete room %s but got %v", stuck.ID, report.DeletedRooms)
+	}
+	// The first attempt stopped before its bookings were canceled.
+	if !slices.Contains(report.CanceledBookings, booking.ID) {
+		t.Errorf("expected the retry to cancel booking %s but got %v", booking.ID, report.CanceledBookings)
+	}
+	rooms, _, err := tdb.store.Room.GetRooms(ctx, db.RoomFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 0 {
+		t.Errorf("expected no rooms left but got %d", len(rooms))
+	}
+}
+
+func TestImportHotels(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	hotelHandler := NewHotelHandler(tdb.store)
+	app.Post("/hotel/import", hotelHandler.HandleImportHotels)
+
+	const body = "name,location,roomType,basePrice\n" +
+		"Espinas Palace,Tehran,single,99.9\n" +
+		"Espinas Palace,Tehran,double,149.9\n" +
+		"X,Tehran,single,50\n"
+	importCSV := func(target string) types.ImportReport {
+		t.Helper()
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 for %s but got %d", target, res.StatusCode)
+		}
+		var report types.ImportReport
+		if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	report := importCSV("/hotel/import?dryRun=true")
+	if !report.DryRun || report.Hotels != 1 || report.Rooms != 2 || report.Rejected != 1 {
+		t.Errorf("unexpected dry run report %+v", report)
+	}
+	report = importCSV("/hotel/import")
+	if report.Hotels != 1 || report.Results[0].Status != types.ImportCreated || report.Results[1].Errors["name"] == "" {
+		t.Errorf("unexpected import report %+v", report)
+	}
+	hotels, _, err := tdb.store.Hotel.GetHotels(context.Background(), db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 1 || len(hotels[0].Rooms) != 2 {
+		t.Fatalf("expected 1 hotel with 2 rooms after the import but got %d hotels", len(hotels))
+	}
+
+	req := httptest.NewRequest("POST", "/hotel/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml")
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format but got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+)
+
+// LoginPolicy sets how failed logins are throttled, per account and per
+// client IP. Failures are forgotten Window after the last one. From the
+// DelayAfter-th failure on, the next attempt must wait BaseDelay, doubling
+// with each further failure up to MaxDelay. After AccountLockAfter failures
+// for an account, or IPLockAfter from an address, logins are locked for
+// LockFor.
+type LoginPolicy struct {
+	Window           time.Duration
+	DelayAfter       int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	AccountLockAfter int
+	IPLockAfter      int
+	LockFor          time.Duration
+}
+
+var DefaultLoginPolicy = LoginPolicy{
+	Window:           15 * time.Minute,
+	DelayAfter:       3,
+	BaseDelay:        time.Second,
+	MaxDelay:         30 * time.Second,
+	AccountLockAfter: 10,
+	IPLockAfter:      100,
+	LockFor:          15 * time.Minute,
+}
+
+// LoginGuard applies a LoginPolicy. Accounts are keyed by the email given,
+// whether or not a user has it, so an unknown email is throttled and
+// locked exactly like a known one. Each attempt is counted as failed
+// before its password is checked and taken back if it succeeds, so
+// concurrent attempts cannot all pass the lockout before one is counted.
+// If the attempts cannot be read or counted, logins go ahead unthrottled,
+// at once while the cache breaker is open.
+type LoginGuard struct {
+	attempts db.LoginAttemptStore
+	policy   LoginPolicy
+}
+
+func NewLoginGuard(attempts db.LoginAttemptStore, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{
+		attempts: attempts,
+		policy:   policy,
+	}
+}
+
+func accountLoginKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// loginKey is a key a login attempt is counted under.
+type loginKey struct {
+	key       string
+	lockAfter int
+	// n is the count of failures including this attempt, or 0 if it could
+	// not be counted.
+	n int
+}
+
+// loginAttempt is a login attempt counted in advance as failed, per
+// account and per client IP.
+type loginAttempt struct {
+	account, ip loginKey
+}
+
+// begin counts a login attempt as failed before its password is checked.
+// It returns the error to answer the attempt with instead, if any.
+func (g *LoginGuard) begin(c fiber.Ctx, email string) (*loginAttempt, error) {
+	a := &loginAttempt{
+		account: loginKey{key: accountLoginKey(email), lockAfter: g.policy.AccountLockAfter},
+		ip:      loginKey{key: ipLoginKey(c.IP()), lockAfter: g.policy.IPLockAfter},
+	}
+	attempts, err := g.attempts.LoginAttempts(c.Context(), a.account.key, a.ip.key)
+	if err != nil {
+		logLoginError("reading login attempts", err)
+		return a, nil
+	}
+	account, ip := attempts[0], attempts[1]
+	if wait := max(account.Blocked, ip.Blocked); wait > 0 {
+		setRetryAfter(c, wait)
+		if account.Failures >= g.policy.AccountLockAfter || ip.Failures >= g.policy.IPLockAfter {
+			return nil, errLoginLocked()
+		}
+		return nil, types.NewError(fiber.StatusTooManyRequests, "too many failed login attempts, retry later")
+	}
+
+	// The count, not the block read above, settles a lockout: attempts
+	// that are not blocked yet may be under way at the same time.
+	locked := false
+	for _, key := range []*loginKey{&a.account, &a.ip} {
+		n, err := g.attempts.RecordLoginFailure(c.Context(), key.key, g.policy.Window)
+		if err != nil {
+			logLoginError("counting a login attempt", err)
+			continue
+		}
+		key.n = n
+		locked = locked || n > key.lockAfter
+	}
+	if locked {
+		setRetryAfter(c, g.policy.LockFor)
+		return nil, errLoginLocked()
+	}
+	return a, nil
+}
+
+// failed blocks the next logins as the policy says for the failures
+// counted with the attempt.
+func (g *LoginGuard) failed(ctx context.Context, a *loginAttempt) {
+	for _, key := range []loginKey{a.account, a.ip} {
+		if key.n == 0 {
+			continue
+		}
+		if block := g.block(key.n, key.lockAfter); block > 0 {
+			if err := g.attempts.BlockLogin(ctx, key.key, block); err != nil {
+				logLoginError("blocking logins", err)
+			}
+		}
+	}
+}
+
+// block returns how long logins wait after the n-th failure.
+func (g *LoginGuard) block(n, lockAfter int) time.Duration {
+	if n >= lockAfter {
+		return g.policy.LockFor
+	}
+	if n < g.policy.DelayAfter {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := g.policy.DelayAfter; i < n && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.policy.MaxDelay)
+}
+
+// succeeded forgets the account's failures. Of the address, only the
+// attempt is taken back, so logging into one account does not reset
+// guessing at others.
+func (g *LoginGuard) succeeded(ctx context.Context, a *loginAttempt) {
+	if err := g.attempts.ResetLogin(ctx, a.account.key); err != nil {
+		logLoginError("resetting login attempts", err)
+	}
+	if a.ip.n > 0 {
+		if err := g.attempts.ForgetLoginFailure(ctx, a.ip.key); err != nil {
+			logLoginError("taking back a login attempt", err)
+		}
+	}
+}
+
+// unlock lifts the lockout and delays of an account.
+func (g *LoginGuard) unlock(ctx context.Context, email string) error {
+	return g.attempts.ResetLogin(ctx, accountLoginKey(email))
+}
+
+func errLoginLocked() types.Error {
+	return types.NewError(fiber.StatusLocked, "login temporarily locked after too many failed attempts")
+}
+
+func setRetryAfter(c fiber.Ctx, wait time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// logLoginError logs a failure to reach the attempts, except while the
+// cache breaker is open, which is reported already.
+func logLoginError(doing string, err error) {
+	if !errors.Is(err, db.ErrCacheBreakerOpen) {
+		log.Printf("%s: %v", doing, err)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db"
+)
+
+// HotelViews counts the hotel named by the :id route parameter as viewed
+// when the request is answered with 200, towards warming the cache. Copies
+// revalidated with 304 and failed requests are not counted. Views only
+// rank hotels, so a count that cannot be written is dropped.
+func HotelViews(cache db.CacheStore) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() == fiber.StatusOK {
+			// The parameter is only valid during the request.
+			db.RecordHotelView(c.Context(), cache, strings.Clone(c.Params("id")))
+		}
+		return nil
+	}
+}
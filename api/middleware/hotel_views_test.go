@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/api"
+	"github.com/raminfathi/GoTel/api/middleware"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/types"
+)
+
+func TestHotelViews(t *testing.T) {
+	cache := memory.NewCacheStore()
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Get("/hotel/:id", middleware.HotelViews(cache), func(c fiber.Ctx) error {
+		switch c.Params("id") {
+		case "cached":
+			return c.SendStatus(fiber.StatusNotModified)
+		case "missing":
+			return types.ErrResourceNotFound("hotel")
+		}
+		return c.JSON(fiber.Map{"id": c.Params("id")})
+	})
+	for _, id := range []string{"a", "a", "b", "cached", "missing"} {
+		if _, err := app.Test(httptest.NewRequest("GET", "/hotel/"+id, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := app.Test(httptest.NewRequest("GET", "/hotel/b", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the handler's answer but got %d", res.StatusCode)
+	}
+
+	ranked, err := cache.TopRanked(context.Background(), db.HotelViewsRanking, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ranked, []string{"b", "a"}) {
+		t.Errorf("expected only the hotels answered with 200 to be counted but got %v", ranked)
+	}
+}
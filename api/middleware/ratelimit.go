@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RateLimit allows Limit requests in any Window. A zero Limit turns
+// limiting off.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitFromEnv returns the limit set for a route group in
+// RATE_LIMIT_<group>, written as requests per window such as "10/1m", or
+// "off". It returns def when the variable is not set.
+func RateLimitFromEnv(group string, def RateLimit) (RateLimit, error) {
+	name := "RATE_LIMIT_" + strings.ToUpper(group)
+	value := os.Getenv(name)
+	switch value {
+	case "":
+		return def, nil
+	case "off":
+		return RateLimit{}, nil
+	}
+	limit, window, ok := strings.Cut(value, "/")
+	n, err := strconv.Atoi(limit)
+	if !ok || err != nil || n <= 0 {
+		return def, fmt.Errorf("%s must be requests per window such as 10/1m, got %q", name, value)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return def, fmt.Errorf("%s must be requests per window such as 10/1m, got %q", name, value)
+	}
+	return RateLimit{Limit: n, Window: d}, nil
+}
+
+// RateLimiter limits the requests to a route group, counting those of an
+// authenticated user under their ID and the others under the client IP.
+// Every response carries the RateLimit-* headers; a request over the limit
+// gets 429 with Retry-After. If the counters cannot be reached the request
+// is let through, without a word while the cache breaker is open.
+func RateLimiter(limiter db.RateLimiter, group string, limit RateLimit) fiber.Handler {
+	policy := fmt.Sprintf("%d;w=%d", limit.Limit, int(math.Ceil(limit.Window.Seconds())))
+	return func(c fiber.Ctx) error {
+		if limit.Limit <= 0 {
+			return c.Next()
+		}
+		key := "ratelimit:" + group + ":ip:" + c.IP()
+		if user, ok := c.Locals("user").(*types.User); ok {
+			key = "ratelimit:" + group + ":user:" + user.ID.Hex()
+		}
+		res, err := limiter.Allow(c.Context(), key, limit.Limit, limit.Window)
+		if err != nil {
+			if !errors.Is(err, db.ErrCacheBreakerOpen) {
+				log.Printf("rate limiter %s: %v", group, err)
+			}
+			return c.Next()
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+		c.Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Set("RateLimit-Reset", reset)
+		c.Set("RateLimit-Policy", policy)
+		if !res.Allowed {
+			c.Set(fiber.HeaderRetryAfter, reset)
+			return types.NewError(fiber.StatusTooManyRequests, "too many requests")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/api"
+	"github.com/raminfathi/GoTel/api/middleware"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := memory.NewRateLimiter()
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	// A user ID in the query stands in for an authenticated user.
+	app.Use(func(c fiber.Ctx) error {
+		if id := c.Query("user"); id != "" {
+			oid, _ := bson.ObjectIDFromHex(id)
+			c.Locals("user", &types.User{ID: oid})
+		}
+		return c.Next()
+	})
+	app.Post("/auth", middleware.RateLimiter(limiter, "auth", middleware.RateLimit{Limit: 2, Window: time.Minute}), func(c fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+	app.Post("/open", middleware.RateLimiter(limiter, "open", middleware.RateLimit{}), func(c fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+	post := func(target string) *http.Response {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("POST", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		res := post("/auth")
+		if res.StatusCode != http.StatusOK || res.Header.Get("RateLimit-Limit") != "2" || res.Header.Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request %d: expected 200 with %s remaining but got %d %v", i+1, remaining, res.StatusCode, res.Header)
+		}
+		if res.Header.Get("RateLimit-Reset") != "60" || res.Header.Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("request %d: unexpected reset and policy %v", i+1, res.Header)
+		}
+	}
+	res := post("/auth")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "60" || res.Header.Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected 429 with Retry-After but got %d %v", res.StatusCode, res.Header)
+	}
+
+	// An authenticated user is counted apart from the address they use.
+	user := bson.NewObjectID().Hex()
+	if res := post("/auth?user=" + user); res.StatusCode != http.StatusOK || res.Header.Get("RateLimit-Remaining") != "1" {
+		t.Errorf("expected the user to have their own limit but got %d %v", res.StatusCode, res.Header)
+	}
+
+	for i := 0; i < 3; i++ {
+		if res := post("/open"); res.StatusCode != http.StatusOK || res.Header.Get("RateLimit-Limit") != "" {
+			t.Errorf("expected no limit without one configured but got %d %v", res.StatusCode, res.Header)
+		}
+	}
+}
+
+// openBreakerLimiter fails like a Redis limiter behind an open breaker.
+type openBreakerLimiter struct{}
+
+func (openBreakerLimiter) Allow(context.Context, string, int, time.Duration) (db.RateLimitResult, error) {
+	return db.RateLimitResult{}, db.ErrCacheBreakerOpen
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/auth", middleware.RateLimiter(openBreakerLimiter{}, "auth", middleware.RateLimit{Limit: 1, Window: time.Minute}), func(c fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+	for i := 0; i < 2; i++ {
+		res, err := app.Test(httptest.NewRequest("POST", "/auth", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK || res.Header.Get("RateLimit-Limit") != "" {
+			t.Errorf("request %d: expected to be let through unlimited but got %d %v", i+1, res.StatusCode, res.Header)
+		}
+	}
+}
+
+func TestRateLimitFromEnv(t *testing.T) {
+	def := middleware.RateLimit{Limit: 10, Window: time.Minute}
+	if limit, err := middleware.RateLimitFromEnv("auth", def); err != nil || limit != def {
+		t.Errorf("expected the default but got %+v, %v", limit, err)
+	}
+	t.Setenv("RATE_LIMIT_AUTH", "5/30s")
+	if limit, err := middleware.RateLimitFromEnv("auth", def); err != nil || limit != (middleware.RateLimit{Limit: 5, Window: 30 * time.Second}) {
+		t.Errorf("expected 5 per 30s but got %+v, %v", limit, err)
+	}
+	t.Setenv("RATE_LIMIT_AUTH", "off")
+	if limit, err := middleware.RateLimitFromEnv("auth", def); err != nil || limit.Limit != 0 {
+		t.Errorf("expected limiting off but got %+v, %v", limit, err)
+	}
+	for _, value := range []string{"5", "0/1m", "5/soon"} {
+		t.Setenv("RATE_LIMIT_AUTH", value)
+		if _, err := middleware.RateLimitFromEnv("auth", def); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
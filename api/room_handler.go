@@ -1,7 +1,7 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -13,6 +13,14 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+type RoomQueryParams struct {
+	db.Pagination
+	HotelID  string  `query:"hotelId"`
+	Type     int     `query:"type"`
+	MinPrice float64 `query:"minPrice"`
+	MaxPrice float64 `query:"maxPrice"`
+}
+
 type RoomHandler struct {
 	store *db.Store
 }
@@ -29,37 +37,44 @@ func NewRoomHandler(store *db.Store) *RoomHandler {
 // @Tags         room
 // @Accept       json
 // @Produce      json
+// @Param        hotelId  query  string  false "Filter by hotel"
+// @Param        type     query  int     false "Filter by room type"
+// @Param        minPrice query  number  false "Minimum price"
+// @Param        maxPrice query  number  false "Maximum price"
+// @Param        limit   query  int     false "Page size"
+// @Param        page    query  int     false "Page number"
+// @Param        cursor  query  string  false "Cursor from a previous page"
+// @Param        includeDeleted query bool false "Include deleted rooms (admins only)"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}   types.Room
+// @Success      200  {object}  types.ResourceResp
 // @Router       /room [get]
 func (h *RoomHandler) HandleGetRooms(c fiber.Ctx) error {
-
-	cacheKey := "rooms-" + c.OriginalURL()
-	val, err := h.store.Cache.Get(c.Context(), cacheKey)
-	if err == nil && val != "" {
-		var rooms []*types.Room
-		if err := json.Unmarshal([]byte(val), &rooms); err == nil {
-			return c.JSON(rooms)
-		}
-	}
-	filter := bson.M{}
-	if hotelID := c.Query("hotelId"); hotelID != "" {
-		oid, err := bson.ObjectIDFromHex(hotelID)
-		if err != nil {
-			return types.ErrInvalidID()
-		}
-		filter["hotelID"] = oid
-	}
-	rooms, err := h.store.Room.GetRooms(c.Context(), filter)
+	ctx, _, err := readContext(c)
 	if err != nil {
-		return types.ErrResourceNotFound("rooms")
+		return err
 	}
-	serialized, err := json.Marshal(rooms)
-	if err == nil {
-		h.store.Cache.Set(c.Context(), cacheKey, serialized, time.Minute*1)
+	var params RoomQueryParams
+	if err := c.Bind().Query(&params); err != nil {
+		return types.ErrBadRequest()
 	}
-
-	return c.JSON(rooms)
+	if err := checkPagination(&params.Pagination); err != nil {
+		return err
+	}
+	hotelID, err := parseQueryID(params.HotelID)
+	if err != nil {
+		return err
+	}
+	filter := db.RoomFilter{
+		HotelID:  hotelID,
+		Type:     types.RoomType(params.Type),
+		MinPrice: params.MinPrice,
+		MaxPrice: params.MaxPrice,
+	}
+	rooms, page, err := h.store.Room.GetRooms(ctx, filter, &params.Pagination)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newResourceResp(rooms, len(rooms), page))
 }
 
 // HandleBookRoom creates a booking for a room
@@ -73,6 +88,9 @@ func (h *RoomHandler) HandleGetRooms(c fiber.Ctx) error {
 // @Param        X-Api-Token header string true "Token"
 // @Success      200     {object}  types.Booking
 // @Failure      400     {object}  map[string]string
+// @Failure      404     {object}  types.Error  "Room or its hotel not found"
+// @Failure      409     {object}  map[string]string  "Room already booked for one of the nights"
+// @Failure      429     {object}  map[string]string  "Too many bookings; see Retry-After"
 // @Router       /room/{id}/book [post]
 func (h *RoomHandler) HandleBookRoom(c fiber.Ctx) error {
 	var params types.BookRoomParams
@@ -83,23 +101,18 @@ func (h *RoomHandler) HandleBookRoom(c fiber.Ctx) error {
 	if errors := ValidateRequest(params); errors != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(errors)
 	}
-	roomID, err := bson.ObjectIDFromHex(c.Params("id"))
+	room, err := h.store.Room.GetRoomByID(c.Context(), c.Params("id"))
 	if err != nil {
-		return types.ErrInvalidID()
-	}
-	user, ok := c.Locals("user").(*types.User)
-	if !ok {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "user not found in context"})
+		return err
 	}
-	ok, err = h.store.Booking.IsRoomAvailable(c.Context(), roomID, params.FromDate, params.TillDate)
-	if err != nil {
+	// The rooms of a hotel being deleted take no new bookings.
+	if _, err := h.store.Hotel.GetHotelByID(c.Context(), room.HotelID.Hex()); err != nil {
 		return err
 	}
+	roomID := room.ID
+	user, ok := c.Locals("user").(*types.User)
 	if !ok {
-		return c.Status(http.StatusBadRequest).JSON(genericResp{
-			Type: "error",
-			Msg:  fmt.Sprintf("room %s already booked", c.Params("id")),
-		})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "user not found in context"})
 	}
 	booking := types.Booking{
 		UserID:     user.ID,
@@ -109,7 +122,15 @@ func (h *RoomHandler) HandleBookRoom(c fiber.Ctx) error {
 		NumPersons: params.NumPersons,
 	}
 
+	// The night ledger settles availability; a booking that overlaps
+	// another is refused whole.
 	inserted, err := h.store.Booking.InsertBooking(c.Context(), &booking)
+	if errors.Is(err, db.ErrConflict) {
+		return c.Status(http.StatusConflict).JSON(genericResp{
+			Type: "error",
+			Msg:  fmt.Sprintf("room %s already booked", c.Params("id")),
+		})
+	}
 	if err != nil {
 		return err
 	}
@@ -143,25 +164,117 @@ func (h *RoomHandler) HandlePostRoom(c fiber.Ctx) error {
 
 	room := types.Room{
 		HotelID:   hotelOID,
+		Type:      types.RoomTypeFromName(params.Type),
 		BasePrice: params.BasePrice,
 		Price:     params.BasePrice,
 	}
 
-	switch params.Type {
-	case "single":
-		room.Type = types.Single
-	case "double":
-		room.Type = types.Double
-	case "seaview":
-		room.Type = types.SeaView
-	default:
-		room.Type = types.Single
+	insertedRoom, err := h.store.Room.InsertRoom(c.Context(), &room)
+	if err != nil {
+		return err
 	}
+	return c.JSON(insertedRoom)
+}
 
-	insertedRoom, err := h.store.Room.InsertRoom(c.Context(), &room)
+// HandleGetRoom returns a single room (Admin only)
+// @Summary      Get a room
+// @Description  Get a room by ID
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "Room ID"
+// @Param        includeDeleted query bool false "Also find a deleted room"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  types.Room
+// @Header       200  {string}  ETag  "Room version, for If-Match on PUT"
+// @Failure      404  {object}  types.Error
+// @Router       /admin/room/{id} [get]
+func (h *RoomHandler) HandleGetRoom(c fiber.Ctx) error {
+	ctx, _, err := readContext(c)
+	if err != nil {
+		return err
+	}
+	room, err := h.store.Room.GetRoomByID(ctx, c.Params("id"))
 	if err != nil {
 		return err
 	}
+	setETag(c, room.Version)
+	return c.JSON(room)
+}
 
-	return c.JSON(insertedRoom)
+// HandlePutRoom updates a room's type or prices (Admin only)
+// @Summary      Update a room
+// @Description  Change the type, base price or price of a room
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id      path    string                 true  "Room ID"
+// @Param        request body    types.UpdateRoomParams true  "Update Data"
+// @Param        If-Match header string false "ETag from GET /admin/room/{id}; the update fails with 412 if the room changed since"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200     {object}  types.Room
+// @Header       200     {string}  ETag  "New room version"
+// @Failure      400     {object}  map[string]string
+// @Failure      412     {object}  types.Error
+// @Router       /admin/room/{id} [put]
+func (h *RoomHandler) HandlePutRoom(c fiber.Ctx) error {
+	id := c.Params("id")
+
+	var params types.UpdateRoomParams
+	if err := c.Bind().Body(&params); err != nil {
+		return types.ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	if err := h.store.Room.UpdateRoom(c.Context(), id, params, version); err != nil {
+		return err
+	}
+	room, err := h.store.Room.GetRoomByID(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	setETag(c, room.Version)
+	return c.JSON(room)
+}
+
+// HandleDeleteRoom retires a room (Admin only)
+// @Summary      Delete a room
+// @Description  Delete a room and remove it from its hotel. Rooms with upcoming bookings cannot be deleted.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "Room ID"
+// @Param        X-Api-Token header string true "Token"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  types.Error
+// @Failure      409  {object}  types.Error
+// @Router       /admin/room/{id} [delete]
+func (h *RoomHandler) HandleDeleteRoom(c fiber.Ctx) error {
+	id := c.Params("id")
+
+	room, err := h.store.Room.GetRoomByID(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	upcoming, _, err := h.store.Booking.GetBookings(c.Context(), db.BookingFilter{
+		RoomID: room.ID,
+		From:   time.Now(),
+		Status: db.BookingStatusActive,
+	}, &db.Pagination{Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(upcoming) > 0 {
+		return types.NewError(http.StatusConflict, "room has upcoming bookings; cancel them first")
+	}
+
+	if err := h.store.Room.DeleteRoom(c.Context(), id); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"message": "room deleted successfully", "id": id})
 }
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db/fixtures"
+	"github.com/raminfathi/GoTel/types"
+)
+
+func TestDeleteRoom(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	roomHandler := NewRoomHandler(tdb.store)
+	app.Delete("/admin/room/:id", roomHandler.HandleDeleteRoom)
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	hotel := fixtures.AddHotel(tdb.store, "Grand Hotel", "London", 5, nil)
+	room := fixtures.AddRoom(tdb.store, types.Double, 100.0, hotel.ID)
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	booking := fixtures.AddBooking(tdb.store, user.ID, room.ID, from, from.AddDate(0, 0, 2))
+
+	target := "/admin/room/" + room.ID.Hex()
+	del := func() *http.Response {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("DELETE", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := del(); res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a room with an upcoming booking but got %d", res.StatusCode)
+	}
+
+	if err := tdb.store.Booking.CancelBooking(context.Background(), booking.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if res := del(); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 once the booking is canceled but got %d", res.StatusCode)
+	}
+	got, err := tdb.store.Hotel.GetHotelByID(context.Background(), hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rooms) != 0 {
+		t.Errorf("expected the hotel to have no rooms but got %v", got.Rooms)
+	}
+	if res := del(); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted room but got %d", res.StatusCode)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
@@ -10,27 +11,62 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/db/sqlite"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type testdb struct {
 	client *mongo.Client
+	conn   *sql.DB
 	store  *db.Store
 }
 
+// setup returns a fresh store for a test, behind an in-memory cache as in
+// production. TEST_DB_BACKEND picks the backend ("mongo", "sqlite" or
+// "memory"); when it is unset, Mongo is used only if MONGO_DB_URL_TEST is
+// configured.
 func setup(t *testing.T) *testdb {
+	tdb := setupBackend(t)
+	tdb.store = db.NewCachedStore(tdb.store, memory.NewCacheStore(), db.DefaultCacheConfig)
+	return tdb
+}
+
+func setupBackend(t *testing.T) *testdb {
 	if err := godotenv.Load("../.env"); err != nil {
 		log.Println("Could not load .env file")
 	}
 
+	backend := os.Getenv("TEST_DB_BACKEND")
+	if backend == "" {
+		backend = "memory"
+		if os.Getenv("MONGO_DB_URL_TEST") != "" {
+			backend = "mongo"
+		}
+	}
+
+	switch backend {
+	case "memory":
+		return &testdb{store: memory.NewStore()}
+	case "mongo":
+		return setupMongo(t)
+	case "sqlite":
+		return setupSQLite(t)
+	default:
+		t.Fatalf("unknown TEST_DB_BACKEND %q", backend)
+		return nil
+	}
+}
+
+func setupMongo(t *testing.T) *testdb {
 	dbURI := os.Getenv("MONGO_DB_URL_TEST")
 	if dbURI == "" {
 		dbURI = "mongodb://localhost:27017"
 	}
 
 	testDBName := fmt.Sprintf("hotel_db_test_%d", time.Now().UnixNano())
-	os.Setenv("DBNAME", testDBName)
+	t.Setenv(db.MongoDBNameEnvName, testDBName)
 
 	client, err := mongo.Connect(options.Client().ApplyURI(dbURI))
 	if err != nil {
@@ -40,18 +76,45 @@ func setup(t *testing.T) *testdb {
 	client.Database(testDBName).Drop(context.TODO())
 
 	hotelStore := db.NewMongoHotelStore(client)
+	store := &db.Store{
+		User:    db.NewMongoUserStore(client),
+		Hotel:   hotelStore,
+		Room:    db.NewMongoRoomStore(client, hotelStore),
+		Booking: db.NewMongoBookingStore(client),
+	}
+	if err := store.EnsureIndexes(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
 
 	return &testdb{
 		client: client,
-		store: &db.Store{
-			User:    db.NewMongoUserStore(client),
-			Hotel:   hotelStore,
-			Room:    db.NewMongoRoomStore(client, hotelStore),
-			Booking: db.NewMongoBookingStore(client),
-		},
+		store:  store,
+	}
+}
+
+func setupSQLite(t *testing.T) *testdb {
+	conn, err := sqlite.Open(context.TODO(), ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testdb{
+		conn:  conn,
+		store: sqlite.NewStore(conn),
 	}
 }
+
 func (tdb *testdb) teardown(t *testing.T) {
+	if tdb.conn != nil {
+		if err := tdb.conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tdb.client == nil {
+		return
+	}
+	if err := tdb.client.Database(os.Getenv(db.MongoDBNameEnvName)).Drop(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
 	if err := tdb.client.Disconnect(context.TODO()); err != nil {
 		t.Fatal(err)
 	}
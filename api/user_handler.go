@@ -2,12 +2,12 @@ package api
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/types"
 
 	"github.com/gofiber/fiber/v3"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type UserHandler struct {
@@ -28,8 +28,11 @@ func NewUserHandler(userStore db.UserStore) *UserHandler {
 // @Produce      json
 // @Param        id      path    string                true  "User ID"
 // @Param        request body    types.UpdateUserParams true  "Update Data"
+// @Param        If-Match header string false "ETag from GET /user/{id}; the update fails with 412 if the user changed since"
 // @Param        X-Api-Token header string true "Token"
 // @Success      200     {object}  map[string]string
+// @Header       200     {string}  ETag  "New user version"
+// @Failure      412     {object}  types.Error
 // @Router       /user/{id} [put]
 func (h *UserHandler) HandlePutUser(c fiber.Ctx) error {
 	var params types.UpdateUserParams
@@ -38,11 +41,20 @@ func (h *UserHandler) HandlePutUser(c fiber.Ctx) error {
 	if err := c.Bind().Body(&params); err != nil {
 		return types.ErrBadRequest()
 	}
-	filter := db.Map{"_id": userId}
-	if err := h.userStore.UpdateUser(c.Context(), filter, params); err != nil {
-		return c.Status(400).JSON(map[string]string{"error": err.Error()})
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	if err := h.userStore.UpdateUser(c.Context(), userId, params, version); err != nil {
+		return err
+	}
+	user, err := h.userStore.GetUserByID(c.Context(), userId)
+	if err != nil {
+		return err
 	}
 
+	setETag(c, user.Version)
+
 	return c.JSON(map[string]string{"message": "user updated successfully", "id": userId})
 }
 
@@ -60,7 +72,7 @@ func (h *UserHandler) HandleDeleteUser(c fiber.Ctx) error {
 	userId := c.Params("id")
 
 	if err := h.userStore.DeleteUser(c.Context(), userId); err != nil {
-		return types.ErrBadRequest()
+		return err
 	}
 
 	return c.JSON(map[string]string{"message": "user deleted successfully", "id": userId})
@@ -75,6 +87,7 @@ func (h *UserHandler) HandleDeleteUser(c fiber.Ctx) error {
 // @Param        request body types.CreateUserParams true "User Data"
 // @Success      200  {object}  types.User
 // @Failure      400  {object}  map[string]string
+// @Failure      409  {object}  types.Error
 // @Router       /user [post]
 func (h *UserHandler) HandlePostUser(c fiber.Ctx) error {
 	var params types.CreateUserParams
@@ -87,15 +100,17 @@ func (h *UserHandler) HandlePostUser(c fiber.Ctx) error {
 	_, err := h.userStore.GetUserByEmail(c.Context(), params.Email)
 	if err == nil {
 		// ارور nil یعنی یوزر پیدا شد -> پس تکراریه
-		return c.Status(fiber.StatusBadRequest).JSON(map[string]string{
-			"error": "email already exists",
-		})
+		return errEmailExists()
 	}
 	user, err := types.NewUserFromParams(params)
 	if err != nil {
 		return err
 	}
 	insertedUser, err := h.userStore.InsertUser(c.Context(), user)
+	if errors.Is(err, db.ErrDuplicate) {
+		// A concurrent registration won the race past the check above.
+		return errEmailExists()
+	}
 	if err != nil {
 		return err
 	}
@@ -109,23 +124,27 @@ func (h *UserHandler) HandlePostUser(c fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "User ID"
+// @Param        includeDeleted query bool false "Also find a deleted user (admins only)"
 // @Param        X-Api-Token header string true "Token"
 // @Success      200  {object}  types.User
-// @Failure      404  {object}  map[string]string
+// @Header       200  {string}  ETag  "User version, for If-Match on update"
+// @Failure      404  {object}  types.Error
 // @Router       /user/{id} [get]
 func (h *UserHandler) HandleGetUser(c fiber.Ctx) error {
 
 	var (
 		id = c.Params("id")
 	)
-	user, err := h.userStore.GetUserByID(c.Context(), id)
+	ctx, _, err := readContext(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.userStore.GetUserByID(ctx, id)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return c.JSON(map[string]string{"error": "not found"})
-		}
 		return err
 	}
 
+	setETag(c, user.Version)
 	return c.JSON(user)
 }
 
@@ -135,14 +154,30 @@ func (h *UserHandler) HandleGetUser(c fiber.Ctx) error {
 // @Tags         admin
 // @Accept       json
 // @Produce      json
+// @Param        limit  query   int     false "Page size"
+// @Param        page   query   int     false "Page number"
+// @Param        cursor query   string  false "Cursor from a previous page"
+// @Param        includeDeleted query bool false "Include deleted users"
 // @Param        X-Api-Token header string true "Token"
-// @Success      200  {array}  types.User
+// @Success      200  {object}  types.ResourceResp
 // @Failure      403  {object}  map[string]string
 // @Router       /admin/user [get]
 func (h *UserHandler) HandleGetUsers(c fiber.Ctx) error {
-	users, err := h.userStore.GetUsers(c.Context())
+	pag, err := bindPagination(c)
+	if err != nil {
+		return err
+	}
+	ctx, _, err := readContext(c)
 	if err != nil {
-		return types.ErrResourceNotFound("user")
+		return err
 	}
-	return c.JSON(users)
+	users, page, err := h.userStore.GetUsers(ctx, &pag)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newResourceResp(users, len(users), page))
+}
+
+func errEmailExists() types.Error {
+	return types.NewError(http.StatusConflict, "email already exists")
 }
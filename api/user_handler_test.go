@@ -5,11 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/raminfathi/GoTel/db/fixtures"
 	"github.com/raminfathi/GoTel/types"
 )
 
@@ -54,3 +56,145 @@ func TestPostUser(t *testing.T) {
 		t.Errorf("expected email %s but got %s", uniqueEmail, user.Email)
 	}
 }
+
+func TestPostUserDuplicateEmail(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Post("/", userHandler.HandlePostUser)
+
+	params := types.CreateUserParams{
+		Email:     "taken@user.com",
+		FirstName: "Test",
+		LastName:  "User",
+		Password:  "supersecurepassword",
+	}
+	for i, want := range []int{http.StatusOK, http.StatusConflict} {
+		b, _ := json.Marshal(params)
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("request %d: expected %d but got %d", i+1, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetUserErrors(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Get("/:id", userHandler.HandleGetUser)
+
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{"65f1c0ffee0000000000beef", http.StatusNotFound},
+		{"not-an-id", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/"+tt.id, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET /%s: expected %d but got %d", tt.id, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestPutUserIfMatch(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Put("/:id", userHandler.HandlePutUser)
+
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	put := func(ifMatch string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/"+user.ID.Hex(), bytes.NewReader([]byte(`{"firstName":"Jimmy"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := put(`"1"`); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("expected 200 with ETag \"2\" but got %d with %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := put(`"1"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a stale ETag but got %d", resp.StatusCode)
+	}
+	if resp := put("*"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected If-Match * to update unconditionally but got %d", resp.StatusCode)
+	}
+}
+
+func TestDeleteUserIsSoft(t *testing.T) {
+	tdb := setup(t)
+	defer tdb.teardown(t)
+
+	admin := fixtures.AddUser(tdb.store, "admin", "admin", true)
+	user := fixtures.AddUser(tdb.store, "james", "bond", false)
+	asUser := func(u *types.User) fiber.Handler {
+		return func(c fiber.Ctx) error {
+			c.Locals("user", u)
+			return c.Next()
+		}
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	userHandler := NewUserHandler(tdb.store.User)
+	app.Delete("/:id", userHandler.HandleDeleteUser)
+	app.Get("/admin/:id", asUser(admin), userHandler.HandleGetUser)
+	app.Get("/user/:id", asUser(user), userHandler.HandleGetUser)
+
+	get := func(target string) *http.Response {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/"+user.ID.Hex(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", resp.StatusCode)
+	}
+	if resp := get("/admin/" + user.ID.Hex()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted user but got %d", resp.StatusCode)
+	}
+	if resp := get("/user/" + user.ID.Hex() + "?includeDeleted=true"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 when a non-admin asks for deleted users but got %d", resp.StatusCode)
+	}
+
+	resp = get("/admin/" + user.ID.Hex() + "?includeDeleted=true")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for an admin asking for deleted users but got %d", resp.StatusCode)
+	}
+	var got types.User
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt == nil {
+		t.Error("expected the deleted user to carry deletedAt")
+	}
+}
@@ -1,11 +1,20 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/types"
 
 	"github.com/gofiber/fiber/v3"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 func getAuthUser(c fiber.Ctx) (*types.User, error) {
@@ -15,3 +24,181 @@ func getAuthUser(c fiber.Ctx) (*types.User, error) {
 	}
 	return user, nil
 }
+
+// readContext returns the context store reads should use. Admins may pass
+// includeDeleted=true to see soft-deleted records; the second result then
+// tells the handler to bypass the cache, which only holds live records.
+func readContext(c fiber.Ctx) (context.Context, bool, error) {
+	if !fiber.Query[bool](c, "includeDeleted") {
+		return c.Context(), false, nil
+	}
+	user, err := getAuthUser(c)
+	if err != nil || !user.IsAdmin {
+		return nil, false, types.NewError(http.StatusForbidden, "only admins can include deleted records")
+	}
+	return db.WithDeleted(c.Context()), true, nil
+}
+
+// bindPagination reads limit, page and cursor from the query string.
+func bindPagination(c fiber.Ctx) (db.Pagination, error) {
+	var pag db.Pagination
+	if err := c.Bind().Query(&pag); err != nil {
+		return pag, types.ErrBadRequest()
+	}
+	return pag, checkPagination(&pag)
+}
+
+// checkPagination rejects a cursor the stores would not be able to decode.
+func checkPagination(pag *db.Pagination) error {
+	if pag.Cursor == "" {
+		return nil
+	}
+	if _, err := db.DecodeCursor(pag.Cursor); err != nil {
+		return types.NewError(http.StatusBadRequest, "invalid cursor")
+	}
+	return nil
+}
+
+// parseQueryID parses an optional id from the query string; an empty value
+// yields the zero id, which the store filters treat as "any".
+func parseQueryID(value string) (bson.ObjectID, error) {
+	if value == "" {
+		return bson.NilObjectID, nil
+	}
+	oid, err := bson.ObjectIDFromHex(value)
+	if err != nil {
+		return bson.NilObjectID, types.ErrInvalidID()
+	}
+	return oid, nil
+}
+
+// parseQueryDate parses an optional date given as 2006-01-02 or RFC 3339.
+func parseQueryDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, types.NewError(http.StatusBadRequest, "invalid "+name+" date")
+}
+
+// parseQueryPoint parses an optional "lat,lng" pair; an empty value yields
+// nil.
+func parseQueryPoint(name, value string) (*types.GeoPoint, error) {
+	if value == "" {
+		return nil, nil
+	}
+	invalid := types.NewError(http.StatusBadRequest, name+" must be lat,lng within ±90 and ±180")
+	latStr, lngStr, ok := strings.Cut(value, ",")
+	if !ok {
+		return nil, invalid
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return nil, invalid
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil || !types.ValidCoordinates(lat, lng) {
+		return nil, invalid
+	}
+	return types.NewGeoPoint(lat, lng), nil
+}
+
+// setETag exposes a record's version as its entity tag.
+func setETag(c fiber.Ctx, version int64) {
+	c.Set(fiber.HeaderETag, versionETag(version))
+}
+
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// readCacheControl lets clients keep hotel and room reads but has them
+// revalidate every time, since a write may change them at any moment.
+const readCacheControl = "private, no-cache"
+
+// notModified sets the validators of a read and reports whether the client
+// already has this representation, in which case the handler answers 304
+// without encoding a body. If-None-Match is compared weakly and, when sent,
+// decides alone; If-Modified-Since is only consulted without it.
+func notModified(c fiber.Ctx, etag string, modified time.Time) bool {
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, readCacheControl)
+	if !modified.IsZero() {
+		c.Set(fiber.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	}
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// pageValidators returns a weak entity tag and the last modification time
+// of a listing. The tag covers every item's id and version and the page
+// itself, so it also changes when items are added or removed.
+func pageValidators[T any](items []*T, page *db.PageInfo, version func(*T) (bson.ObjectID, int64, time.Time)) (string, time.Time) {
+	h := sha256.New()
+	if page != nil {
+		fmt.Fprintf(h, "%d %d %d %s\n", page.Total, page.Page, page.Limit, page.NextCursor)
+	}
+	var modified time.Time
+	for _, item := range items {
+		id, v, updated := version(item)
+		fmt.Fprintf(h, "%s %d\n", id.Hex(), v)
+		if updated.After(modified) {
+			modified = updated
+		}
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, modified
+}
+
+func hotelVersion(h *types.Hotel) (bson.ObjectID, int64, time.Time) {
+	return h.ID, h.Version, h.UpdatedAt
+}
+
+func roomVersion(r *types.Room) (bson.ObjectID, int64, time.Time) {
+	return r.ID, r.Version, r.UpdatedAt
+}
+
+// ifMatchVersion returns the version named by the If-Match header, for the
+// stores to check against. An absent header or "*" yields 0, which updates
+// unconditionally.
+func ifMatchVersion(c fiber.Ctx) (int64, error) {
+	tag := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+	if err != nil || version <= 0 || !strings.HasPrefix(tag, `"`) {
+		return 0, types.NewError(http.StatusBadRequest, "If-Match must be a single ETag from a previous GET")
+	}
+	return version, nil
+}
+
+func newResourceResp(data any, results int, page *db.PageInfo) types.ResourceResp {
+	resp := types.ResourceResp{
+		Results:    results,
+		Data:       data,
+		Page:       int(page.Page),
+		Limit:      int(page.Limit),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	if page.Limit > 0 {
+		resp.TotalPages = int((page.Total + page.Limit - 1) / page.Limit)
+	}
+	return resp
+}
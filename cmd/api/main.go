@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/adaptor"
@@ -13,12 +15,13 @@ import (
 	"github.com/raminfathi/GoTel/api"
 	"github.com/raminfathi/GoTel/api/middleware"
 	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/backend"
+	"github.com/raminfathi/GoTel/db/migrate"
 	_ "github.com/raminfathi/GoTel/docs"
 	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 var config = fiber.Config{
@@ -41,48 +44,89 @@ var config = fiber.Config{
 
 func main() {
 	// 1. Init Dependencies
-	mongoEndpoint := os.Getenv("MONGO_DB_URL")
 	redisAddr := os.Getenv("REDIS_URL")
 	redisPw := os.Getenv("REDIS_PASSWORD")
 
+	breakerOptions, err := db.CacheBreakerOptionsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Short timeouts keep a slow Redis from holding requests up; the cache
+	// breaker bypasses it altogether once it keeps failing.
 	redisClient := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPw,
-		DB:       0,
+		Addr:         redisAddr,
+		Password:     redisPw,
+		DB:           0,
+		DialTimeout:  breakerOptions.Timeout,
+		ReadTimeout:  breakerOptions.Timeout,
+		WriteTimeout: breakerOptions.Timeout,
+		PoolTimeout:  breakerOptions.Timeout,
 	})
 	fmt.Println("Redis client initialized:", redisClient)
 
-	client, err := mongo.Connect(options.Client().ApplyURI(mongoEndpoint))
+	// 2. Init Stores
+	database, err := backend.Open(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
+	defer database.Close()
+	if database.Mongo != nil && os.Getenv("REQUIRE_MIGRATIONS") == "true" {
+		if err := checkMigrations(database.Mongo); err != nil {
 			log.Fatal(err)
 		}
-	}()
-
-	// 2. Init Stores
-	hotelStore := db.NewMongoHotelStore(client)
-	roomStore := db.NewMongoRoomStore(client, hotelStore)
-	userStore := db.NewMongoUserStore(client)
-	bookingStore := db.NewMongoBookingStore(client)
-	cacheStore := db.NewRedisCacheStore(redisClient)
+	}
+	store := database.Store
+	cacheConfig, err := db.CacheConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	localCache, err := db.LocalCacheOptionsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	breaker := db.NewCacheBreaker(db.NewRedisCacheStore(redisClient), func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	}, breakerOptions)
+	defer breaker.Close()
+	if err := breaker.Probe(context.Background()); err != nil {
+		log.Printf("starting without the cache: %v", err)
+	}
+	// The breaker guards Redis only, so the local tier serves on while it
+	// is open.
+	var cache db.CacheStore = breaker
+	if localCache.Size > 0 {
+		tiered := db.NewTieredCacheStore(redisClient, breaker, localCache)
+		defer tiered.Close()
+		cache = tiered
+	}
+	store = db.NewCachedStore(store, cache, cacheConfig)
+	if err := warmCache(store); err != nil {
+		log.Fatal(err)
+	}
+	userStore := store.User
 
-	store := &db.Store{
-		Hotel:   hotelStore,
-		Room:    roomStore,
-		User:    userStore,
-		Booking: bookingStore,
-		Cache:   cacheStore,
+	rateLimiter := db.NewRedisRateLimiter(redisClient, breaker)
+	authLimit, err := middleware.RateLimitFromEnv("auth", middleware.RateLimit{Limit: 10, Window: time.Minute})
+	if err != nil {
+		log.Fatal(err)
+	}
+	bookingLimit, err := middleware.RateLimitFromEnv("booking", middleware.RateLimit{Limit: 20, Window: time.Minute})
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiLimit, err := middleware.RateLimitFromEnv("api", middleware.RateLimit{Limit: 300, Window: time.Minute})
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// 3. Init Handlers
 	hotelHandler := api.NewHotelHandler(store)
-	authHandler := api.NewAuthHandler(userStore)
+	authHandler := api.NewAuthHandler(userStore, api.NewLoginGuard(db.NewRedisLoginAttemptStore(redisClient, breaker), api.DefaultLoginPolicy))
 	userHandler := api.NewUserHandler(userStore)
 	roomHandler := api.NewRoomHandler(store)
 	bookingHandler := api.NewBookingHandler(store)
+	healthHandler := api.NewHealthHandler(breaker)
+	cacheHandler := api.NewCacheHandler(store)
 
 	// 4. Setup Fiber & Routes
 	app := fiber.New(config)
@@ -96,13 +140,15 @@ func main() {
 	// ===========================
 	// 🔓 Public Routes
 	// ===========================
-	apiv1.Post("/auth", authHandler.HandleAuthenticate)
+	apiv1.Get("/health", healthHandler.HandleGetHealth)
+	apiv1.Post("/auth", middleware.RateLimiter(rateLimiter, "auth", authLimit), authHandler.HandleAuthenticate)
 	apiv1.Post("/user", userHandler.HandlePostUser)
 
 	// ===========================
 	// 🔒 Private Routes
 	// ===========================
 	apiv1.Use(middleware.JWTAuthentication(userStore))
+	apiv1.Use(middleware.RateLimiter(rateLimiter, "api", apiLimit))
 
 	// User Handlers
 	apiv1.Get("/user/:id", userHandler.HandleGetUser)
@@ -111,12 +157,13 @@ func main() {
 
 	// Hotel Handlers
 	apiv1.Get("/hotel", hotelHandler.HandleGetHotels)
-	apiv1.Get("/hotel/:id", hotelHandler.HandleGetHotel)
+	apiv1.Get("/hotel/suggest", hotelHandler.HandleGetHotelSuggestions)
+	apiv1.Get("/hotel/:id", middleware.HotelViews(store.Cache), hotelHandler.HandleGetHotel)
 	apiv1.Get("/hotel/:id/rooms", hotelHandler.HandleGetRooms)
 
 	// Room Handlers
 	apiv1.Get("/room", roomHandler.HandleGetRooms)
-	apiv1.Post("/room/:id/book", roomHandler.HandleBookRoom)
+	apiv1.Post("/room/:id/book", middleware.RateLimiter(rateLimiter, "booking", bookingLimit), roomHandler.HandleBookRoom)
 
 	// Booking Handlers
 	apiv1.Get("/booking", bookingHandler.HandleGetMyBookings)
@@ -129,16 +176,73 @@ func main() {
 
 	admin := apiv1.Group("/admin", api.AdminAuth)
 	admin.Get("/user", userHandler.HandleGetUsers)
+	admin.Post("/user/:id/unlock", authHandler.HandleUnlockUser)
 	admin.Post("/hotel", hotelHandler.HandlePostHotel)
+	admin.Post("/hotel/import", hotelHandler.HandleImportHotels)
 	admin.Put("/hotel/:id", hotelHandler.HandlePutHotel)
+	admin.Delete("/hotel/:id", hotelHandler.HandleDeleteHotel)
 	admin.Post("/room", roomHandler.HandlePostRoom)
+	admin.Get("/room/:id", roomHandler.HandleGetRoom)
+	admin.Put("/room/:id", roomHandler.HandlePutRoom)
+	admin.Delete("/room/:id", roomHandler.HandleDeleteRoom)
 	admin.Get("/booking", bookingHandler.HandleGetBookings)
+	admin.Get("/booking/export.csv", bookingHandler.HandleExportBookingsCSV)
+	admin.Get("/booking/export.ics", bookingHandler.HandleExportBookingsICS)
+	admin.Get("/cache", cacheHandler.HandleGetCache)
+	admin.Delete("/cache/key/:key", cacheHandler.HandleDeleteCacheKey)
+	admin.Delete("/cache/:family", cacheHandler.HandleDeleteCacheFamily)
 
 	// Start Server
 	listenAddr := os.Getenv("HTTP_LISTEN_ADDRESS")
 	log.Fatal(app.Listen(listenAddr))
 }
 
+// warmCache starts loading the most viewed hotels into the cache in the
+// background if CACHE_WARM_HOTELS asks for it. The API serves meanwhile.
+func warmCache(store *db.Store) error {
+	value := os.Getenv(db.WarmCacheEnvName)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s must be a non-negative number, got %q", db.WarmCacheEnvName, value)
+	}
+	if n == 0 {
+		return nil
+	}
+	go func() {
+		start := time.Now()
+		warmed, err := db.WarmCache(context.Background(), store, n)
+		if err != nil {
+			log.Printf("warming the cache: %v", err)
+		}
+		log.Printf("warmed the cache with %d hotels in %s", warmed, time.Since(start).Round(time.Millisecond))
+	}()
+	return nil
+}
+
+// checkMigrations refuses to start the API against a database that still
+// has pending migrations; run `go run ./cmd/migrate up` first.
+func checkMigrations(client *mongo.Client) error {
+	dbname := os.Getenv(db.MongoDBNameEnvName)
+	if dbname == "" {
+		dbname = "hotel_db"
+	}
+	migrator, err := migrate.NewMigrator(client.Database(dbname), migrate.Migrations)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, first is %s", len(pending), pending[0])
+	}
+	return nil
+}
+
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, relying on system environment variables")
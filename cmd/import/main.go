@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/backend"
+	"github.com/raminfathi/GoTel/db/importer"
+	"github.com/raminfathi/GoTel/types"
+	"github.com/redis/go-redis/v9"
+)
+
+const usage = `usage: import [-dry-run] [-format csv|json] [-json] <file>
+
+Adds the hotels in file, with their rooms, to the database named by
+DB_BACKEND, then drops the hotel and room lists cached in REDIS_URL. file
+is CSV or JSON, told apart by its extension unless -format is given; "-"
+reads standard input. The exit status is 1 if any hotel was rejected.
+`
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "validate only, without adding anything")
+	formatName := flag.String("format", "", "csv or json (default from the file extension)")
+	jsonOut := flag.Bool("json", false, "print the report as JSON")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on system environment variables")
+	}
+
+	name := flag.Arg(0)
+	if *formatName == "" {
+		*formatName = name
+	}
+	format, err := importer.ParseFormat(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	hotels, err := importer.Read(in, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	database, err := backend.Open(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := importer.Import(ctx, database.Store, hotels, *dryRun)
+	database.Close()
+	if !*dryRun && report.Hotels > 0 {
+		if err := purgeCache(ctx); err != nil {
+			log.Printf("purging the cache, hotel lists may be stale until they expire: %v", err)
+		}
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printReport(report)
+	}
+	if report.Rejected > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *types.ImportReport) {
+	for _, hotel := range report.Results {
+		fmt.Printf("row %-5d %-8s hotel %q%s\n", hotel.Row, hotel.Status, hotel.Name, details(hotel))
+		for _, room := range hotel.Rooms {
+			fmt.Printf("row %-5d %-8s   room%s\n", room.Row, room.Status, details(room))
+		}
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "[dry-run] would import"
+	}
+	fmt.Printf("%s %d hotels with %d rooms, rejected %d hotels\n", verb, report.Hotels, report.Rooms, report.Rejected)
+}
+
+// details returns the id and errors of a result, if any.
+func details(result types.ImportResult) string {
+	var s string
+	if result.ID != "" {
+		s += " " + result.ID
+	}
+	if len(result.Errors) > 0 {
+		fields := make([]string, 0, len(result.Errors))
+		for field := range result.Errors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for i, field := range fields {
+			fields[i] = field + ": " + result.Errors[field]
+		}
+		s += " (" + strings.Join(fields, "; ") + ")"
+	}
+	return s
+}
+
+// purgeCache drops the cached lists the imported hotels and rooms belong
+// in, from Redis and from the local caches of the running API instances.
+func purgeCache(ctx context.Context) error {
+	client := redis.NewClient(&redis.Options{
+		Addr:     os.Getenv("REDIS_URL"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	defer client.Close()
+	// No local tier of its own; it only publishes the evictions.
+	cache := db.NewTieredCacheStore(client, nil, db.LocalCacheOptions{})
+	defer cache.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for _, name := range []string{"hotels", "hotel-rooms", "rooms"} {
+		family, _ := db.CacheFamilyByName(name)
+		if err := cache.DeletePrefix(ctx, family.Prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/backend"
+	"github.com/raminfathi/GoTel/db/migrate"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const usage = `usage: migrate [-dry-run] [-steps n] <command>
+
+commands:
+  up      apply pending migrations (all, or the next n)
+  down    revert the last applied migration (or the last n)
+  status  list migrations and whether they are applied
+`
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would change without touching the database")
+	steps := flag.Int("steps", 0, "number of migrations to apply or revert")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on system environment variables")
+	}
+	mongoURI := os.Getenv("MONGO_DB_URL")
+	if mongoURI == "" {
+		mongoURI = "mongodb://localhost:27017"
+	}
+	dbName := os.Getenv(db.MongoDBNameEnvName)
+	if dbName == "" {
+		dbName = "hotel_db"
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	migrator, err := migrate.NewMigrator(client.Database(dbName), migrate.Migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	migrator.DryRun = *dryRun
+
+	switch cmd := flag.Arg(0); cmd {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-40s %s\n", s.Migration, state)
+		}
+	case "up":
+		if !*dryRun {
+			// Some migrations rely on unique indexes, so make sure they exist.
+			if err := backend.NewMongoStore(client).EnsureIndexes(ctx); err != nil {
+				log.Fatal(err)
+			}
+		}
+		done, err := migrator.Up(ctx, *steps)
+		report(done, "applied", "would apply", *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		done, err := migrator.Down(ctx, *steps)
+		report(done, "reverted", "would revert", *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func report(migrations []migrate.Migration, done, planned string, dryRun bool) {
+	if len(migrations) == 0 {
+		fmt.Println("no migrations to run")
+		return
+	}
+	verb := done
+	if dryRun {
+		verb = "[dry-run] " + planned
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s %s\n", verb, m)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"time"
@@ -11,6 +13,8 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/raminfathi/GoTel/db"
 	"github.com/raminfathi/GoTel/db/fixtures"
+	"github.com/raminfathi/GoTel/db/migrate"
+	"github.com/raminfathi/GoTel/db/sqlite"
 	"github.com/raminfathi/GoTel/types"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -21,41 +25,21 @@ func main() {
 		log.Println("No .env file found, using default values")
 	}
 
-	mongoURI := os.Getenv("MONGO_DB_URL")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
-	}
-
-	dbName := os.Getenv("MONGO_DB_NAME")
-	if dbName == "" {
-		dbName = "GoTel"
-	}
-	// 1. اتصال به دیتابیس
-	client, err := mongo.Connect(options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		log.Fatal(err)
-	}
 	ctx := context.Background()
 
-	// 2. پاک کردن دیتابیس قدیمی
-	fmt.Println("🧹 Dropping database...")
-	if err := client.Database(dbName).Drop(ctx); err != nil {
+	// 1-3. Connect to the configured backend, drop the old data and set up
+	// the stores.
+	store, finish, err := resetStore(ctx)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	// 3. راه‌اندازی Store
-	hotelStore := db.NewMongoHotelStore(client)
-	store := &db.Store{
-		User:    db.NewMongoUserStore(client),
-		Hotel:   hotelStore,
-		Room:    db.NewMongoRoomStore(client, hotelStore),
-		Booking: db.NewMongoBookingStore(client),
-	}
-
 	// 4. ساخت هتل با استفاده از Fixture
 	fmt.Println("🏨 Seeding Hotel...")
-	hotel := fixtures.AddHotel(store, "Espinas Palace", "Tehran", 5, nil)
+	hotel := fixtures.AddHotelAt(store, "Espinas Palace", "Tehran", 5, 35.7563, 51.4137)
 	fmt.Printf("   -> Created Hotel: %s\n", hotel.Name)
+	other := fixtures.AddHotelAt(store, "Parsian Azadi", "Tehran", 4, 35.7891, 51.3758)
+	fmt.Printf("   -> Created Hotel: %s\n", other.Name)
 
 	// 5. ساخت اتاق‌ها
 	fmt.Println("🛏️  Seeding Rooms...")
@@ -78,11 +62,89 @@ func main() {
 	fixtures.AddBooking(store, user.ID, firstRoom.ID, time.Now(), time.Now().AddDate(0, 0, 3))
 	fmt.Printf("   -> Booking created for user %s in hotel %s\n", user.Email, hotel.Name)
 
+	// 9. Backend specific wrap-up, such as recording migrations.
+	if err := finish(ctx); err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("---------------------------------------------------------")
 	fmt.Println("✅ Seeding completed successfully!")
 	fmt.Println("---------------------------------------------------------")
 }
 
+// resetStore empties the backend named by DB_BACKEND and returns its stores,
+// plus a func to run once seeding is done.
+func resetStore(ctx context.Context) (*db.Store, func(context.Context) error, error) {
+	switch backend := os.Getenv(db.BackendEnvName); backend {
+	case "", "mongo":
+		return resetMongo(ctx)
+	case "sqlite":
+		path := os.Getenv(sqlite.PathEnvName)
+		if path == "" {
+			path = "gotel.db"
+		}
+		fmt.Println("🧹 Removing database file...")
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+		conn, err := sqlite.Open(ctx, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sqlite.NewStore(conn), func(context.Context) error { return conn.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown %s %q", db.BackendEnvName, backend)
+	}
+}
+
+func resetMongo(ctx context.Context) (*db.Store, func(context.Context) error, error) {
+	mongoURI := os.Getenv("MONGO_DB_URL")
+	if mongoURI == "" {
+		mongoURI = "mongodb://localhost:27017"
+	}
+
+	dbName := os.Getenv("MONGO_DB_NAME")
+	if dbName == "" {
+		dbName = "GoTel"
+	}
+	// 1. اتصال به دیتابیس
+	client, err := mongo.Connect(options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. پاک کردن دیتابیس قدیمی
+	fmt.Println("🧹 Dropping database...")
+	if err := client.Database(dbName).Drop(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	// 3. راه‌اندازی Store
+	hotelStore := db.NewMongoHotelStore(client)
+	store := &db.Store{
+		User:    db.NewMongoUserStore(client),
+		Hotel:   hotelStore,
+		Room:    db.NewMongoRoomStore(client, hotelStore),
+		Booking: db.NewMongoBookingStore(client),
+	}
+	if err := store.EnsureIndexes(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	// A fresh database already has the latest shape, so record every
+	// migration as applied.
+	finish := func(ctx context.Context) error {
+		defer client.Disconnect(ctx)
+		migrator, err := migrate.NewMigrator(client.Database(dbName), migrate.Migrations)
+		if err != nil {
+			return err
+		}
+		_, err = migrator.Up(ctx, 0)
+		return err
+	}
+	return store, finish, nil
+}
+
 func printUserCredentials(u *types.User) {
 	// تولید توکن برای نمایش
 	token := generateToken(u)
@@ -0,0 +1,85 @@
+// Package backend opens the storage backend the environment names, for the
+// commands that share it.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/sqlite"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Backend is an open storage backend.
+type Backend struct {
+	Store *db.Store
+	// Mongo is the client of the Mongo backend, and nil for the others.
+	Mongo *mongo.Client
+	close func()
+}
+
+// Open connects to the backend named by DB_BACKEND and prepares it: Mongo,
+// at MONGO_DB_URL, gets its indexes and SQLite, at SQLITE_PATH, its
+// schema.
+func Open(ctx context.Context) (*Backend, error) {
+	switch name := os.Getenv(db.BackendEnvName); name {
+	case "", "mongo":
+		uri := os.Getenv("MONGO_DB_URL")
+		if uri == "" {
+			uri = "mongodb://localhost:27017"
+		}
+		client, err := mongo.Connect(options.Client().ApplyURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		b := &Backend{
+			Store: NewMongoStore(client),
+			Mongo: client,
+			close: func() {
+				if err := client.Disconnect(context.TODO()); err != nil {
+					log.Println(err)
+				}
+			},
+		}
+		if err := b.Store.EnsureIndexes(ctx); err != nil {
+			b.Close()
+			return nil, err
+		}
+		return b, nil
+	case "sqlite":
+		path := os.Getenv(sqlite.PathEnvName)
+		if path == "" {
+			path = "gotel.db"
+		}
+		conn, err := sqlite.Open(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Backend{
+			Store: sqlite.NewStore(conn),
+			close: func() { conn.Close() },
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown %s %q", db.BackendEnvName, name)
+	}
+}
+
+// NewMongoStore returns the stores of the Mongo backend.
+func NewMongoStore(client *mongo.Client) *db.Store {
+	hotelStore := db.NewMongoHotelStore(client)
+	return &db.Store{
+		User:    db.NewMongoUserStore(client),
+		Hotel:   hotelStore,
+		Room:    db.NewMongoRoomStore(client, hotelStore),
+		Booking: db.NewMongoBookingStore(client),
+	}
+}
+
+// Close disconnects from the backend.
+func (b *Backend) Close() {
+	b.close()
+}
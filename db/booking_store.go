@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -9,18 +10,69 @@ import (
 	"github.com/raminfathi/GoTel/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+const roomNightColl = "roomNights"
+
 type BookingStore interface {
+	// InsertBooking claims every night of the booking for its room. If any
+	// night is already taken nothing is written and ErrConflict is returned.
 	InsertBooking(context.Context, *types.Booking) (*types.Booking, error)
-	GetBookings(context.Context, bson.M) ([]*types.Booking, error)
+	GetBookings(context.Context, BookingFilter, *Pagination) ([]*types.Booking, *PageInfo, error)
 	GetBookingByID(context.Context, string) (*types.Booking, error)
-	UpdateBooking(context.Context, string, bson.M) error
+	// CancelBooking marks the booking canceled and releases its nights.
+	CancelBooking(context.Context, string) error
 	IsRoomAvailable(context.Context, bson.ObjectID, time.Time, time.Time) (bool, error)
 }
+
+type BookingStatus string
+
+const (
+	BookingStatusActive   BookingStatus = "active"
+	BookingStatusCanceled BookingStatus = "canceled"
+)
+
+// BookingFilter selects bookings. Zero fields match every booking. From and
+// Till select the bookings whose stay overlaps [From, Till); either bound
+// may be left open.
+type BookingFilter struct {
+	UserID  bson.ObjectID
+	RoomID  bson.ObjectID
+	HotelID bson.ObjectID
+	From    time.Time
+	Till    time.Time
+	Status  BookingStatus
+}
+
+// roomNight is a single night of a room held by a booking. The unique
+// (roomID, date) index on the ledger is what prevents double booking.
+type roomNight struct {
+	RoomID    bson.ObjectID `bson:"roomID"`
+	Date      time.Time     `bson:"date"`
+	BookingID bson.ObjectID `bson:"bookingID"`
+}
+
+// BookingNights returns the nights (as UTC midnights) covered by a stay.
+// The check-out day is not included; a same-day stay holds one night.
+func BookingNights(from, till time.Time) []time.Time {
+	start := from.UTC().Truncate(24 * time.Hour)
+	end := till.UTC().Truncate(24 * time.Hour)
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 1)
+	}
+	var nights []time.Time
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		nights = append(nights, d)
+	}
+	return nights
+}
+
 type MongoBookingStore struct {
 	client *mongo.Client
 	coll   *mongo.Collection
+	nights *mongo.Collection
+	rooms  *mongo.Collection
 }
 
 func NewMongoBookingStore(client *mongo.Client) *MongoBookingStore {
@@ -32,9 +84,39 @@ func NewMongoBookingStore(client *mongo.Client) *MongoBookingStore {
 	return &MongoBookingStore{
 		client: client,
 		coll:   client.Database(dbname).Collection("bookings"),
+		nights: client.Database(dbname).Collection(roomNightColl),
+		rooms:  client.Database(dbname).Collection("rooms"),
 	}
 
 }
+
+// Indexes declares the indexes the bookings collection needs. The compound
+// room index serves the overlap query in IsRoomAvailable.
+func (s *MongoBookingStore) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "roomID", Value: 1}, {Key: "fromDate", Value: 1}, {Key: "tillDate", Value: 1}}},
+		{Keys: bson.D{{Key: "userID", Value: 1}}},
+	}
+}
+
+// NightIndexes declares the indexes of the room-night ledger. The unique
+// (roomID, date) index must exist before bookings are accepted.
+func (s *MongoBookingStore) NightIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "roomID", Value: 1}, {Key: "date", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "bookingID", Value: 1}}},
+	}
+}
+
+func (s *MongoBookingStore) EnsureIndexes(ctx context.Context) error {
+	if err := ensureIndexes(ctx, s.coll, s.Indexes()); err != nil {
+		return err
+	}
+	return ensureIndexes(ctx, s.nights, s.NightIndexes())
+}
 func (s *MongoBookingStore) IsRoomAvailable(ctx context.Context, roomID bson.ObjectID, from, till time.Time) (bool, error) {
 	filter := bson.M{
 		"roomID": roomID,
@@ -55,48 +137,135 @@ func (s *MongoBookingStore) IsRoomAvailable(ctx context.Context, roomID bson.Obj
 	// If count is 0, it means no overlapping bookings found -> Room is available
 	return count == 0, nil
 }
-func (s *MongoBookingStore) UpdateBooking(ctx context.Context, id string, update bson.M) error {
-	oid, err := bson.ObjectIDFromHex(id)
+func (s *MongoBookingStore) GetBookingByID(ctx context.Context, id string) (*types.Booking, error) {
+	oid, err := ParseID(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	m := bson.M{
-		"$set": update,
+	var booking types.Booking
+	if err := s.coll.FindOne(ctx, notDeleted(ctx, bson.M{"_id": oid})).Decode(&booking); err != nil {
+		return nil, mongoErr("booking", err)
 	}
-	_, err = s.coll.UpdateByID(ctx, oid, m)
-	return err
+	return &booking, nil
 }
-
-func (s *MongoBookingStore) GetBookingByID(ctx context.Context, id string) (*types.Booking, error) {
-	oid, err := bson.ObjectIDFromHex(id)
+func (s *MongoBookingStore) GetBookings(ctx context.Context, filter BookingFilter, pag *Pagination) ([]*types.Booking, *PageInfo, error) {
+	query, err := s.filterToBSON(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	var booking types.Booking
-	if err := s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&booking); err != nil {
-		return nil, err
+	return findPage(ctx, s.coll, notDeleted(ctx, query), pag, func(b *types.Booking) bson.ObjectID { return b.ID })
+}
 
+func (s *MongoBookingStore) filterToBSON(ctx context.Context, f BookingFilter) (bson.M, error) {
+	filter := bson.M{}
+	if !f.UserID.IsZero() {
+		filter["userID"] = f.UserID
 	}
-	return &booking, nil
+	if !f.RoomID.IsZero() {
+		filter["roomID"] = f.RoomID
+	}
+	if !f.HotelID.IsZero() {
+		// Bookings only reference rooms, so resolve the hotel's rooms first.
+		roomIDs, err := s.hotelRoomIDs(ctx, f.HotelID)
+		if err != nil {
+			return nil, err
+		}
+		// $and keeps this from clobbering an explicit roomID condition.
+		filter["$and"] = bson.A{bson.M{"roomID": bson.M{"$in": roomIDs}}}
+	}
+	if !f.From.IsZero() {
+		filter["tillDate"] = bson.M{"$gt": f.From}
+	}
+	if !f.Till.IsZero() {
+		filter["fromDate"] = bson.M{"$lt": f.Till}
+	}
+	switch f.Status {
+	case BookingStatusActive:
+		filter["canceled"] = false
+	case BookingStatusCanceled:
+		filter["canceled"] = true
+	}
+	return filter, nil
 }
-func (s *MongoBookingStore) GetBookings(ctx context.Context, filter bson.M) ([]*types.Booking, error) {
-	curr, err := s.coll.Find(ctx, filter)
+
+// hotelRoomIDs includes deleted rooms, whose bookings still belong to the
+// hotel.
+func (s *MongoBookingStore) hotelRoomIDs(ctx context.Context, hotelID bson.ObjectID) ([]bson.ObjectID, error) {
+	cur, err := s.rooms.Find(ctx, bson.M{"hotelID": hotelID}, options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
 		return nil, err
 	}
-	var booking []*types.Booking
-	if err := curr.All(ctx, &booking); err != nil {
+	var rooms []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &rooms); err != nil {
 		return nil, err
 	}
-	fmt.Println(booking)
-	return booking, nil
+	ids := make([]bson.ObjectID, 0, len(rooms))
+	for _, room := range rooms {
+		ids = append(ids, room.ID)
+	}
+	return ids, nil
 }
-func (s *MongoBookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
-	resp, err := s.coll.InsertOne(ctx, booking)
+func (s *MongoBookingStore) CancelBooking(ctx context.Context, id string) error {
+	oid, err := ParseID(id)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	res, err := s.coll.UpdateByID(ctx, oid, bson.M{"$set": bson.M{"canceled": true, "updatedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return NotFound("booking")
+	}
+	_, err = s.nights.DeleteMany(ctx, bson.M{"bookingID": oid})
+	return err
+}
+
+func (s *MongoBookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	if booking.ID.IsZero() {
+		booking.ID = bson.NewObjectID()
+	}
+	booking.CreatedAt = time.Now()
+	booking.UpdatedAt = booking.CreatedAt
+	if !booking.Canceled {
+		if err := s.claimNights(ctx, booking); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.coll.InsertOne(ctx, booking); err != nil {
+		return nil, errors.Join(mongoErr("booking", err), s.releaseNights(ctx, booking.ID))
 	}
-	booking.ID = resp.InsertedID.(bson.ObjectID)
 	return booking, nil
+}
+
+// releaseNights frees the nights claimed for a booking that was not
+// stored. It goes ahead even if ctx is done, since nights left behind
+// block the room for good.
+func (s *MongoBookingStore) releaseNights(ctx context.Context, id bson.ObjectID) error {
+	if _, err := s.nights.DeleteMany(context.WithoutCancel(ctx), bson.M{"bookingID": id}); err != nil {
+		return fmt.Errorf("releasing the nights of booking %s: %w", id.Hex(), err)
+	}
+	return nil
+}
 
+// claimNights inserts one ledger entry per night. On a duplicate key the
+// nights claimed so far are released again so the booking fails cleanly.
+func (s *MongoBookingStore) claimNights(ctx context.Context, booking *types.Booking) error {
+	var docs []roomNight
+	for _, night := range BookingNights(booking.FromDate, booking.TillDate) {
+		docs = append(docs, roomNight{
+			RoomID:    booking.RoomID,
+			Date:      night,
+			BookingID: booking.ID,
+		})
+	}
+	if _, err := s.nights.InsertMany(ctx, docs); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			err = ErrConflict
+		}
+		return errors.Join(err, s.releaseNights(ctx, booking.ID))
+	}
+	return nil
 }
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/raminfathi/GoTel/types"
+)
+
+// CacheFamily is a family of cached reads and the prefix of its keys.
+type CacheFamily struct {
+	Name   string
+	Prefix string
+}
+
+// CacheFamilies lists every family the cached stores fill. No prefix is a
+// prefix of another, so each key belongs to exactly one family.
+var CacheFamilies = []CacheFamily{
+	{Name: "hotel", Prefix: hotelKeyPrefix},
+	{Name: "hotels", Prefix: hotelsKeyPrefix},
+	{Name: "room", Prefix: roomKeyPrefix},
+	{Name: "rooms", Prefix: roomsKeyPrefix},
+	{Name: "hotel-rooms", Prefix: hotelRoomsKeyPrefix},
+	{Name: "booking", Prefix: bookingKeyPrefix},
+	{Name: "bookings", Prefix: bookingsKeyPrefix},
+}
+
+// CacheFamilyByName returns the family called name.
+func CacheFamilyByName(name string) (CacheFamily, bool) {
+	for _, family := range CacheFamilies {
+		if family.Name == name {
+			return family, true
+		}
+	}
+	return CacheFamily{}, false
+}
+
+// CacheFamilyOf returns the family key belongs to.
+func CacheFamilyOf(key string) (CacheFamily, bool) {
+	for _, family := range CacheFamilies {
+		if strings.HasPrefix(key, family.Prefix) {
+			return family, true
+		}
+	}
+	return CacheFamily{}, false
+}
+
+// FlushCache drops every key the cached stores may have set.
+func FlushCache(ctx context.Context, cache CacheStore) error {
+	for _, family := range CacheFamilies {
+		if err := cache.DeletePrefix(ctx, family.Prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CacheStats counts how the cached reads of each family were served by
+// this instance since it started. Reads that bypass the cache are not
+// counted.
+type CacheStats struct {
+	counters []cacheCounters // by index in CacheFamilies
+}
+
+type cacheCounters struct {
+	hits, stale, misses atomic.Int64
+}
+
+func NewCacheStats() *CacheStats {
+	return &CacheStats{counters: make([]cacheCounters, len(CacheFamilies))}
+}
+
+type cacheOutcome int
+
+const (
+	cacheHit cacheOutcome = iota
+	cacheStaleHit
+	cacheMiss
+)
+
+func (s *CacheStats) record(key string, outcome cacheOutcome) {
+	for i, family := range CacheFamilies {
+		if !strings.HasPrefix(key, family.Prefix) {
+			continue
+		}
+		switch c := &s.counters[i]; outcome {
+		case cacheHit:
+			c.hits.Add(1)
+		case cacheStaleHit:
+			c.stale.Add(1)
+		case cacheMiss:
+			c.misses.Add(1)
+		}
+		return
+	}
+}
+
+// Families reports each family with the keys it has in cache.
+func (s *CacheStats) Families(ctx context.Context, cache CacheStore) ([]types.CacheFamilyStats, error) {
+	families := make([]types.CacheFamilyStats, len(CacheFamilies))
+	for i, family := range CacheFamilies {
+		keys, err := cache.CountPrefix(ctx, family.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		c := &s.counters[i]
+		stats := types.CacheFamilyStats{
+			Family:    family.Name,
+			Prefix:    family.Prefix,
+			Keys:      keys,
+			Hits:      c.hits.Load(),
+			StaleHits: c.stale.Load(),
+			Misses:    c.misses.Load(),
+		}
+		if lookups := stats.Hits + stats.StaleHits + stats.Misses; lookups > 0 {
+			stats.HitRatio = float64(stats.Hits+stats.StaleHits) / float64(lookups)
+		}
+		families[i] = stats
+	}
+	return families, nil
+}
+
+// HotelViewsRanking ranks hotels by how often they were viewed. It lives
+// outside the cached families, so purging them keeps it.
+const HotelViewsRanking = "views:hotels"
+
+// RecordHotelView counts a view of the hotel towards warming the cache.
+func RecordHotelView(ctx context.Context, cache CacheStore, id string) error {
+	if cache == nil {
+		return nil
+	}
+	return cache.IncrRank(ctx, HotelViewsRanking, id)
+}
+
+// WarmCacheEnvName is how many of the most viewed hotels the API loads
+// into the cache when it starts. Zero, the default, turns warming off.
+const WarmCacheEnvName = "CACHE_WARM_HOTELS"
+
+// WarmCache loads up to n of the most viewed hotels, and the first page of
+// their rooms as GET /hotel/:id/rooms asks for it, through the cached
+// store. It returns how many hotels it warmed; hotels gone since they were
+// viewed are skipped.
+func WarmCache(ctx context.Context, store *Store, n int) (int, error) {
+	ids, err := store.Cache.TopRanked(ctx, HotelViewsRanking, n)
+	if err != nil {
+		return 0, err
+	}
+	warmed := 0
+	for _, id := range ids {
+		hotel, err := store.Hotel.GetHotelByID(ctx, id)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidID) {
+			continue
+		}
+		if err != nil {
+			return warmed, err
+		}
+		if _, _, err := store.Room.GetRooms(ctx, RoomFilter{HotelID: hotel.ID}, &Pagination{}); err != nil {
+			return warmed, err
+		}
+		warmed++
+	}
+	return warmed, nil
+}
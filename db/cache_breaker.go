@@ -0,0 +1,343 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/types"
+)
+
+// CacheBreakerOptions tune a CacheBreaker. Timeout bounds every cache call;
+// Failures in a row open the breaker, which then pings the cache every
+// ProbeInterval until it answers.
+type CacheBreakerOptions struct {
+	Timeout       time.Duration
+	Failures      int
+	ProbeInterval time.Duration
+}
+
+var DefaultCacheBreakerOptions = CacheBreakerOptions{
+	Timeout:       200 * time.Millisecond,
+	Failures:      5,
+	ProbeInterval: 5 * time.Second,
+}
+
+// Environment variables overriding DefaultCacheBreakerOptions.
+const (
+	CacheTimeoutEnvName         = "CACHE_TIMEOUT"
+	CacheBreakerFailuresEnvName = "CACHE_BREAKER_FAILURES"
+	CacheBreakerProbeEnvName    = "CACHE_BREAKER_PROBE"
+)
+
+// CacheBreakerOptionsFromEnv returns DefaultCacheBreakerOptions with the
+// overrides set in the environment.
+func CacheBreakerOptionsFromEnv() (CacheBreakerOptions, error) {
+	opts := DefaultCacheBreakerOptions
+	for name, d := range map[string]*time.Duration{
+		CacheTimeoutEnvName:      &opts.Timeout,
+		CacheBreakerProbeEnvName: &opts.ProbeInterval,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				return opts, fmt.Errorf("%s must be a positive duration, got %q", name, value)
+			}
+			*d = parsed
+		}
+	}
+	if value := os.Getenv(CacheBreakerFailuresEnvName); value != "" {
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures <= 0 {
+			return opts, fmt.Errorf("%s must be a positive number, got %q", CacheBreakerFailuresEnvName, value)
+		}
+		opts.Failures = failures
+	}
+	return opts, nil
+}
+
+// ErrCacheBreakerOpen is returned while the breaker is open by the Redis
+// users that have no answer of their own to give, such as the rate limiter.
+var ErrCacheBreakerOpen = errors.New("cache breaker open")
+
+// Cache breaker states.
+const (
+	CacheBreakerClosed = "closed"
+	CacheBreakerOpen   = "open"
+)
+
+// CacheBreaker is a circuit breaker in front of a CacheStore. While closed
+// it passes calls on with a short timeout. Once Failures calls in a row
+// fail it opens: reads miss and writes are skipped without touching the
+// cache, so requests go straight to the database, and a background probe
+// pings the cache until it answers.
+//
+// Keys the cached stores meant to drop while the breaker was open, or
+// failed to drop, may still be cached, so the breaker flushes the cached
+// families before it closes again. In front of the Redis tier of a
+// TieredCacheStore it flushes Redis only; the local tiers drop what they
+// hold once it expires or the eviction channel is lost.
+type CacheBreaker struct {
+	cache CacheStore
+	ping  func(context.Context) error
+	opts  CacheBreakerOptions
+
+	mu       sync.Mutex
+	open     bool
+	failures int
+	since    time.Time
+	lastErr  error
+	// dirty is set when an invalidation may have been lost.
+	dirty   bool
+	probing bool
+
+	cancel context.CancelFunc
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewCacheBreaker wraps cache; ping tells whether the cache is reachable.
+func NewCacheBreaker(cache CacheStore, ping func(context.Context) error, opts CacheBreakerOptions) *CacheBreaker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CacheBreaker{
+		cache:  cache,
+		ping:   ping,
+		opts:   opts,
+		since:  time.Now(),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Close stops the background probe.
+func (b *CacheBreaker) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
+
+// Status reports the state of the breaker.
+func (b *CacheBreaker) Status() types.CacheHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := types.CacheHealth{
+		State:    CacheBreakerClosed,
+		Failures: b.failures,
+		Since:    b.since,
+	}
+	if b.open {
+		status.State = CacheBreakerOpen
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
+
+// Probe pings the cache now, closing the breaker if it answers and opening
+// it if not.
+func (b *CacheBreaker) Probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+	err := b.ping(ctx)
+	if err == nil {
+		err = b.recover(ctx)
+	}
+	if err != nil {
+		b.trip(err)
+		return err
+	}
+	return nil
+}
+
+// recover flushes what may be stale and closes the breaker.
+func (b *CacheBreaker) recover(ctx context.Context) error {
+	b.mu.Lock()
+	dirty := b.dirty
+	b.mu.Unlock()
+	if dirty {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+		if err := FlushCache(ctx, b.cache); err != nil {
+			return fmt.Errorf("flushing the cache: %w", err)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		log.Printf("cache is back, closing the breaker")
+		b.since = time.Now()
+	}
+	b.open, b.failures, b.lastErr = false, 0, nil
+	if dirty {
+		b.dirty = false
+	}
+	return nil
+}
+
+// trip opens the breaker and starts the probe, if not yet running.
+func (b *CacheBreaker) trip(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	if !b.open {
+		log.Printf("cache unavailable, bypassing it: %v", err)
+		b.open, b.since = true, time.Now()
+	}
+	if b.probing || b.ctx.Err() != nil {
+		return
+	}
+	b.probing = true
+	b.wg.Add(1)
+	go b.probe()
+}
+
+func (b *CacheBreaker) probe() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		b.mu.Lock()
+		if !b.open {
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+		b.Probe(b.ctx)
+	}
+}
+
+// call runs fn against the cache unless the breaker is open, which it
+// reports as skipped. A nil breaker runs fn as is.
+func (b *CacheBreaker) call(ctx context.Context, invalidates bool, fn func(context.Context) error) (skipped bool, err error) {
+	if b == nil {
+		return false, fn(ctx)
+	}
+	b.mu.Lock()
+	if b.open {
+		b.dirty = b.dirty || invalidates
+		b.mu.Unlock()
+		return true, nil
+	}
+	b.mu.Unlock()
+
+	callCtx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+	err = fn(callCtx)
+	if err == nil {
+		b.mu.Lock()
+		b.failures = 0
+		b.mu.Unlock()
+		return false, nil
+	}
+	if ctx.Err() != nil {
+		// The caller gave up; that says nothing about the cache.
+		return false, err
+	}
+	b.mu.Lock()
+	b.dirty = b.dirty || invalidates
+	b.failures++
+	b.lastErr = err
+	trip := b.failures >= b.opts.Failures
+	b.mu.Unlock()
+	if trip {
+		b.trip(err)
+	}
+	return false, err
+}
+
+func (b *CacheBreaker) Get(ctx context.Context, key string) (string, error) {
+	var val string
+	_, err := b.call(ctx, false, func(ctx context.Context) (err error) {
+		val, err = b.cache.Get(ctx, key)
+		return err
+	})
+	return val, err
+}
+
+func (b *CacheBreaker) GetMany(ctx context.Context, keys ...string) ([]string, error) {
+	var values []string
+	skipped, err := b.call(ctx, false, func(ctx context.Context) (err error) {
+		values, err = b.cache.GetMany(ctx, keys...)
+		return err
+	})
+	if skipped {
+		values = make([]string, len(keys))
+	}
+	return values, err
+}
+
+func (b *CacheBreaker) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	_, err := b.call(ctx, false, func(ctx context.Context) error {
+		return b.cache.Set(ctx, key, value, expiration)
+	})
+	return err
+}
+
+func (b *CacheBreaker) SetWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) error {
+	_, err := b.call(ctx, false, func(ctx context.Context) error {
+		return b.cache.SetWithTags(ctx, key, value, expiration, tags...)
+	})
+	return err
+}
+
+func (b *CacheBreaker) Delete(ctx context.Context, keys ...string) error {
+	_, err := b.call(ctx, true, func(ctx context.Context) error {
+		return b.cache.Delete(ctx, keys...)
+	})
+	return err
+}
+
+func (b *CacheBreaker) DeleteTags(ctx context.Context, tags ...string) ([]string, error) {
+	var keys []string
+	_, err := b.call(ctx, true, func(ctx context.Context) (err error) {
+		keys, err = b.cache.DeleteTags(ctx, tags...)
+		return err
+	})
+	return keys, err
+}
+
+func (b *CacheBreaker) DeletePrefix(ctx context.Context, prefix string) error {
+	_, err := b.call(ctx, true, func(ctx context.Context) error {
+		return b.cache.DeletePrefix(ctx, prefix)
+	})
+	return err
+}
+
+// CountPrefix reports no keys while the breaker is open.
+func (b *CacheBreaker) CountPrefix(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	_, err := b.call(ctx, false, func(ctx context.Context) (err error) {
+		n, err = b.cache.CountPrefix(ctx, prefix)
+		return err
+	})
+	return n, err
+}
+
+// IncrRank drops the increment while the breaker is open.
+func (b *CacheBreaker) IncrRank(ctx context.Context, ranking, member string) error {
+	_, err := b.call(ctx, false, func(ctx context.Context) error {
+		return b.cache.IncrRank(ctx, ranking, member)
+	})
+	return err
+}
+
+func (b *CacheBreaker) TopRanked(ctx context.Context, ranking string, n int) ([]string, error) {
+	members := []string{}
+	_, err := b.call(ctx, false, func(ctx context.Context) (err error) {
+		members, err = b.cache.TopRanked(ctx, ranking, n)
+		return err
+	})
+	return members, err
+}
@@ -0,0 +1,153 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/redis/go-redis/v9"
+)
+
+var errCacheDown = errors.New("cache down")
+
+// flakyCache fails every call while down and counts the calls it gets.
+type flakyCache struct {
+	db.CacheStore
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (c *flakyCache) err() error {
+	c.calls.Add(1)
+	if c.down.Load() {
+		return errCacheDown
+	}
+	return nil
+}
+
+func (c *flakyCache) Get(ctx context.Context, key string) (string, error) {
+	if err := c.err(); err != nil {
+		return "", err
+	}
+	return c.CacheStore.Get(ctx, key)
+}
+
+func (c *flakyCache) Delete(ctx context.Context, keys ...string) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+	return c.CacheStore.Delete(ctx, keys...)
+}
+
+func (c *flakyCache) ping(context.Context) error {
+	if c.down.Load() {
+		return errCacheDown
+	}
+	return nil
+}
+
+func TestCacheBreaker(t *testing.T) {
+	ctx := context.Background()
+	cache := &flakyCache{CacheStore: memory.NewCacheStore()}
+	breaker := db.NewCacheBreaker(cache, cache.ping, db.CacheBreakerOptions{
+		Timeout:       time.Second,
+		Failures:      2,
+		ProbeInterval: 10 * time.Millisecond,
+	})
+	defer breaker.Close()
+
+	cache.Set(ctx, "hotel-1", "cached", 0)
+	if val, err := breaker.Get(ctx, "hotel-1"); err != nil || val != "cached" {
+		t.Fatalf("expected the cached value but got %q, %v", val, err)
+	}
+
+	cache.down.Store(true)
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Get(ctx, "hotel-1"); !errors.Is(err, errCacheDown) {
+			t.Fatalf("expected the cache error while closed but got %v", err)
+		}
+	}
+	if status := breaker.Status(); status.State != db.CacheBreakerOpen || status.LastError != errCacheDown.Error() {
+		t.Fatalf("expected the breaker to open after 2 failures but got %+v", status)
+	}
+
+	calls := cache.calls.Load()
+	if val, err := breaker.Get(ctx, "hotel-1"); err != nil || val != "" {
+		t.Errorf("expected an open breaker to miss but got %q, %v", val, err)
+	}
+	// The hotel changes while its key cannot be dropped.
+	if err := breaker.Delete(ctx, "hotel-1"); err != nil {
+		t.Errorf("expected an open breaker to skip deletes but got %v", err)
+	}
+	if cache.calls.Load() != calls {
+		t.Error("expected an open breaker not to call the cache")
+	}
+
+	cache.down.Store(false)
+	deadline := time.Now().Add(time.Second)
+	for breaker.Status().State != db.CacheBreakerClosed {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the probe to close the breaker")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if val, _ := breaker.Get(ctx, "hotel-1"); val != "" {
+		t.Errorf("expected the key whose delete was skipped to be flushed but got %q", val)
+	}
+}
+
+func TestCacheBreakerOptionsFromEnv(t *testing.T) {
+	t.Setenv(db.CacheTimeoutEnvName, "50ms")
+	t.Setenv(db.CacheBreakerFailuresEnvName, "3")
+	opts, err := db.CacheBreakerOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Timeout != 50*time.Millisecond || opts.Failures != 3 || opts.ProbeInterval != db.DefaultCacheBreakerOptions.ProbeInterval {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	t.Setenv(db.CacheBreakerFailuresEnvName, "0")
+	if _, err := db.CacheBreakerOptionsFromEnv(); err == nil {
+		t.Error("expected 0 failures to be rejected")
+	}
+}
+
+// unreachableRedis returns a client that cannot connect and a breaker on
+// it that is already open.
+func unreachableRedis(t *testing.T) (*redis.Client, *db.CacheBreaker) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { client.Close() })
+	breaker := db.NewCacheBreaker(db.NewRedisCacheStore(client), func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}, db.CacheBreakerOptions{Timeout: time.Second, Failures: 1, ProbeInterval: time.Minute})
+	t.Cleanup(func() { breaker.Close() })
+	if err := breaker.Probe(context.Background()); err == nil {
+		t.Fatal("expected the probe to fail")
+	}
+	return client, breaker
+}
+
+func TestRateLimiterBreakerOpen(t *testing.T) {
+	client, breaker := unreachableRedis(t)
+	limiter := db.NewRedisRateLimiter(client, breaker)
+	if _, err := limiter.Allow(context.Background(), "ratelimit:api:ip:1", 10, time.Minute); !errors.Is(err, db.ErrCacheBreakerOpen) {
+		t.Errorf("expected the open breaker to fail the limiter at once but got %v", err)
+	}
+}
+
+func TestLoginAttemptStoreBreakerOpen(t *testing.T) {
+	client, breaker := unreachableRedis(t)
+	store := db.NewRedisLoginAttemptStore(client, breaker)
+	ctx := context.Background()
+	if _, err := store.LoginAttempts(ctx, "login:ip:1"); !errors.Is(err, db.ErrCacheBreakerOpen) {
+		t.Errorf("expected the open breaker to fail reads at once but got %v", err)
+	}
+	if _, err := store.RecordLoginFailure(ctx, "login:ip:1", time.Minute); !errors.Is(err, db.ErrCacheBreakerOpen) {
+		t.Errorf("expected the open breaker to fail counts at once but got %v", err)
+	}
+}
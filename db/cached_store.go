@@ -0,0 +1,578 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache key families. Records are cached under the family prefix and their
+// id, lists under the prefix and a digest of their filter and page.
+const (
+	hotelKeyPrefix      = "hotel-"
+	hotelsKeyPrefix     = "hotels-"
+	roomKeyPrefix       = "room-"
+	roomsKeyPrefix      = "rooms-"
+	hotelRoomsKeyPrefix = "hotelrooms-"
+	bookingKeyPrefix    = "booking-"
+	bookingsKeyPrefix   = "bookings-"
+)
+
+// Cache tags. A record is tagged with its own tag and those of the records
+// it belongs to, so that a write can drop everything it affects: HotelTag
+// covers the hotel, its rooms and the lists of its rooms. Every list is
+// also tagged with its family's list tag.
+const (
+	hotelsTag   = "hotels"
+	roomsTag    = "rooms"
+	bookingsTag = "bookings"
+)
+
+func HotelTag(id string) string   { return "hotel:" + id }
+func RoomTag(id string) string    { return "room:" + id }
+func BookingTag(id string) string { return "booking:" + id }
+
+// CachePolicy sets how a family of reads is cached. A zero TTL turns
+// caching of the family off.
+//
+// Stale lets a value be served for that long past its TTL while a single
+// background load refreshes it; writes still drop it at once. Collapse
+// makes concurrent misses of a key wait for one load instead of each going
+// to the database.
+type CachePolicy struct {
+	TTL      time.Duration
+	Stale    time.Duration
+	Collapse bool
+}
+
+// CacheConfig holds the policy of each cached read.
+type CacheConfig struct {
+	Hotel      CachePolicy // GetHotelByID
+	Hotels     CachePolicy // GetHotels
+	Room       CachePolicy // GetRoomByID
+	Rooms      CachePolicy // GetRooms
+	HotelRooms CachePolicy // GetRooms of one hotel, without other filters
+	Booking    CachePolicy // GetBookingByID
+	Bookings   CachePolicy // GetBookings
+}
+
+var DefaultCacheConfig = CacheConfig{
+	Hotel:      CachePolicy{TTL: 5 * time.Minute, Stale: time.Minute, Collapse: true},
+	Hotels:     CachePolicy{TTL: 30 * time.Second, Stale: 30 * time.Second, Collapse: true},
+	Room:       CachePolicy{TTL: time.Minute, Collapse: true},
+	Rooms:      CachePolicy{TTL: time.Minute, Collapse: true},
+	HotelRooms: CachePolicy{TTL: time.Minute, Stale: 30 * time.Second, Collapse: true},
+	Booking:    CachePolicy{TTL: time.Minute, Collapse: true},
+	Bookings:   CachePolicy{TTL: 30 * time.Second},
+}
+
+// families names the policies of a CacheConfig for the environment.
+func (c *CacheConfig) families() map[string]*CachePolicy {
+	return map[string]*CachePolicy{
+		"HOTEL":       &c.Hotel,
+		"HOTELS":      &c.Hotels,
+		"ROOM":        &c.Room,
+		"ROOMS":       &c.Rooms,
+		"HOTEL_ROOMS": &c.HotelRooms,
+		"BOOKING":     &c.Booking,
+		"BOOKINGS":    &c.Bookings,
+	}
+}
+
+// CacheConfigFromEnv returns DefaultCacheConfig with the overrides set in
+// the environment. For each family (HOTEL, HOTELS, ROOM, ROOMS,
+// HOTEL_ROOMS, BOOKING and BOOKINGS) CACHE_TTL_<family> and
+// CACHE_STALE_<family> are Go durations such as "90s", and
+// CACHE_COLLAPSE_<family> is a boolean.
+func CacheConfigFromEnv() (CacheConfig, error) {
+	config := DefaultCacheConfig
+	for family, policy := range config.families() {
+		for name, d := range map[string]*time.Duration{
+			"CACHE_TTL_" + family:   &policy.TTL,
+			"CACHE_STALE_" + family: &policy.Stale,
+		} {
+			value := os.Getenv(name)
+			if value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return config, fmt.Errorf("%s must be a non-negative duration, got %q", name, value)
+			}
+			*d = parsed
+		}
+		name := "CACHE_COLLAPSE_" + family
+		if value := os.Getenv(name); value != "" {
+			collapse, err := strconv.ParseBool(value)
+			if err != nil {
+				return config, fmt.Errorf("%s must be true or false, got %q", name, value)
+			}
+			policy.Collapse = collapse
+		}
+	}
+	return config, nil
+}
+
+// NewCachedStore returns a copy of store whose hotel, room and booking reads
+// go through cache. Indexes must be ensured on store itself.
+func NewCachedStore(store *Store, cache CacheStore, config CacheConfig) *Store {
+	keys := newCacheKeys(cache)
+	return &Store{
+		User:       store.User,
+		Hotel:      &CachedHotelStore{HotelStore: store.Hotel, cache: keys, config: config},
+		Room:       &CachedRoomStore{RoomStore: store.Room, cache: keys, config: config},
+		Booking:    &CachedBookingStore{BookingStore: store.Booking, cache: keys, config: config},
+		Cache:      cache,
+		CacheStats: keys.stats,
+	}
+}
+
+// CachedHotelStore is a read-through cache in front of a HotelStore. Hotels
+// and lists of them are cached; every write drops what it may have changed.
+// Reads under WithDeleted bypass the cache, which only holds live records.
+type CachedHotelStore struct {
+	HotelStore
+	cache  cacheKeys
+	config CacheConfig
+}
+
+func NewCachedHotelStore(store HotelStore, cache CacheStore, config CacheConfig) *CachedHotelStore {
+	return &CachedHotelStore{
+		HotelStore: store,
+		cache:      newCacheKeys(cache),
+		config:     config,
+	}
+}
+
+func (s *CachedHotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	return readThrough(ctx, s.cache, hotelKeyPrefix+id, s.config.Hotel, tagged[*types.Hotel](HotelTag(id)), func(ctx context.Context) (*types.Hotel, error) {
+		return s.HotelStore.GetHotelByID(ctx, id)
+	})
+}
+
+func (s *CachedHotelStore) GetHotels(ctx context.Context, filter HotelFilter, pag *Pagination) ([]*types.Hotel, *PageInfo, error) {
+	key := listKey(hotelsKeyPrefix, filter, pag)
+	page, err := readThrough(ctx, s.cache, key, s.config.Hotels, tagged[cachedPage[types.Hotel]](hotelsTag), func(ctx context.Context) (cachedPage[types.Hotel], error) {
+		hotels, info, err := s.HotelStore.GetHotels(ctx, filter, pag)
+		return cachedPage[types.Hotel]{hotels, info}, err
+	})
+	return page.Items, page.Info, err
+}
+
+func (s *CachedHotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	defer s.cache.invalidate(ctx, hotelsTag)
+	return s.HotelStore.InsertHotel(ctx, hotel)
+}
+
+func (s *CachedHotelStore) UpdateHotel(ctx context.Context, id string, params types.UpdateHotelParams, version int64) error {
+	defer s.cache.hotelChanged(ctx, id)
+	return s.HotelStore.UpdateHotel(ctx, id, params, version)
+}
+
+func (s *CachedHotelStore) UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error {
+	defer s.cache.hotelChanged(ctx, hotelID.Hex())
+	return s.HotelStore.UpdateHotelsRooms(ctx, hotelID, roomIDs...)
+}
+
+func (s *CachedHotelStore) RemoveHotelRoom(ctx context.Context, hotelID, roomID bson.ObjectID) error {
+	defer s.cache.hotelChanged(ctx, hotelID.Hex())
+	return s.HotelStore.RemoveHotelRoom(ctx, hotelID, roomID)
+}
+
+func (s *CachedHotelStore) DeleteHotel(ctx context.Context, id string) error {
+	defer s.cache.hotelChanged(ctx, id)
+	return s.HotelStore.DeleteHotel(ctx, id)
+}
+
+// CachedRoomStore is a read-through cache in front of a RoomStore. Adding
+// or deleting a room also drops its hotel, whose Rooms and version change.
+type CachedRoomStore struct {
+	RoomStore
+	cache  cacheKeys
+	config CacheConfig
+}
+
+func NewCachedRoomStore(store RoomStore, cache CacheStore, config CacheConfig) *CachedRoomStore {
+	return &CachedRoomStore{
+		RoomStore: store,
+		cache:     newCacheKeys(cache),
+		config:    config,
+	}
+}
+
+func (s *CachedRoomStore) GetRoomByID(ctx context.Context, id string) (*types.Room, error) {
+	tags := func(room *types.Room) []string {
+		return []string{RoomTag(id), HotelTag(room.HotelID.Hex())}
+	}
+	return readThrough(ctx, s.cache, roomKeyPrefix+id, s.config.Room, tags, func(ctx context.Context) (*types.Room, error) {
+		return s.RoomStore.GetRoomByID(ctx, id)
+	})
+}
+
+func (s *CachedRoomStore) GetRooms(ctx context.Context, filter RoomFilter, pag *Pagination) ([]*types.Room, *PageInfo, error) {
+	key, policy, tags := listKey(roomsKeyPrefix, filter, pag), s.config.Rooms, []string{roomsTag}
+	if !filter.HotelID.IsZero() {
+		tags = append(tags, HotelTag(filter.HotelID.Hex()))
+		if filter == (RoomFilter{HotelID: filter.HotelID}) {
+			// A hotel's rooms, as the hotel page lists them.
+			key = listKey(hotelRoomsKeyPrefix+filter.HotelID.Hex()+"-", nil, pag)
+			policy = s.config.HotelRooms
+		}
+	}
+	page, err := readThrough(ctx, s.cache, key, policy, tagged[cachedPage[types.Room]](tags...), func(ctx context.Context) (cachedPage[types.Room], error) {
+		rooms, info, err := s.RoomStore.GetRooms(ctx, filter, pag)
+		return cachedPage[types.Room]{rooms, info}, err
+	})
+	return page.Items, page.Info, err
+}
+
+func (s *CachedRoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
+	defer s.cache.roomsAdded(ctx, room.HotelID)
+	return s.RoomStore.InsertRoom(ctx, room)
+}
+
+func (s *CachedRoomStore) InsertRooms(ctx context.Context, hotelID bson.ObjectID, rooms []*types.Room) ([]*types.Room, error) {
+	defer s.cache.roomsAdded(ctx, hotelID)
+	return s.RoomStore.InsertRooms(ctx, hotelID, rooms)
+}
+
+func (s *CachedRoomStore) UpdateRoom(ctx context.Context, id string, params types.UpdateRoomParams, version int64) error {
+	defer s.cache.roomChanged(ctx, id)
+	return s.RoomStore.UpdateRoom(ctx, id, params, version)
+}
+
+func (s *CachedRoomStore) DeleteRoom(ctx context.Context, id string) error {
+	// The room is read from the store itself to learn its hotel.
+	room, err := s.RoomStore.GetRoomByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer s.cache.invalidate(ctx, RoomTag(id), roomsTag, HotelTag(room.HotelID.Hex()), hotelsTag)
+	return s.RoomStore.DeleteRoom(ctx, id)
+}
+
+// CachedBookingStore is a read-through cache in front of a BookingStore.
+// Every booking write drops all lists of bookings, as a booking may belong
+// to lists by user, room, hotel and dates alike.
+type CachedBookingStore struct {
+	BookingStore
+	cache  cacheKeys
+	config CacheConfig
+}
+
+func NewCachedBookingStore(store BookingStore, cache CacheStore, config CacheConfig) *CachedBookingStore {
+	return &CachedBookingStore{
+		BookingStore: store,
+		cache:        newCacheKeys(cache),
+		config:       config,
+	}
+}
+
+func (s *CachedBookingStore) GetBookingByID(ctx context.Context, id string) (*types.Booking, error) {
+	return readThrough(ctx, s.cache, bookingKeyPrefix+id, s.config.Booking, tagged[*types.Booking](BookingTag(id)), func(ctx context.Context) (*types.Booking, error) {
+		return s.BookingStore.GetBookingByID(ctx, id)
+	})
+}
+
+func (s *CachedBookingStore) GetBookings(ctx context.Context, filter BookingFilter, pag *Pagination) ([]*types.Booking, *PageInfo, error) {
+	key := listKey(bookingsKeyPrefix, filter, pag)
+	page, err := readThrough(ctx, s.cache, key, s.config.Bookings, tagged[cachedPage[types.Booking]](bookingsTag), func(ctx context.Context) (cachedPage[types.Booking], error) {
+		bookings, info, err := s.BookingStore.GetBookings(ctx, filter, pag)
+		return cachedPage[types.Booking]{bookings, info}, err
+	})
+	return page.Items, page.Info, err
+}
+
+func (s *CachedBookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	defer s.cache.invalidate(ctx, bookingsTag)
+	return s.BookingStore.InsertBooking(ctx, booking)
+}
+
+func (s *CachedBookingStore) CancelBooking(ctx context.Context, id string) error {
+	defer s.cache.invalidate(ctx, BookingTag(id), bookingsTag)
+	return s.BookingStore.CancelBooking(ctx, id)
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context under which the cached stores read from
+// the store underneath and cache nothing. It is meant for one-off reads,
+// such as exports, that would only fill the cache with entries never read
+// again.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// bypassesCache reports whether reads under ctx skip the cache.
+func bypassesCache(ctx context.Context) bool {
+	if IncludesDeleted(ctx) {
+		return true
+	}
+	skip, _ := ctx.Value(noCacheKey{}).(bool)
+	return skip
+}
+
+type purgedKeysKey struct{}
+
+// PurgedKeys collects the cache keys dropped by writes under a context
+// from WithPurgedKeys.
+type PurgedKeys struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// WithPurgedKeys returns a context under which the cached stores record
+// the keys their writes drop, so that a caller can report them.
+func WithPurgedKeys(ctx context.Context) (context.Context, *PurgedKeys) {
+	purged := &PurgedKeys{keys: map[string]struct{}{}}
+	return context.WithValue(ctx, purgedKeysKey{}, purged), purged
+}
+
+func (p *PurgedKeys) add(keys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range keys {
+		p.keys[key] = struct{}{}
+	}
+}
+
+// Keys returns the keys dropped so far, sorted.
+func (p *PurgedKeys) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.keys))
+	for key := range p.keys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// cachedPage is how a page of a list is cached.
+type cachedPage[T any] struct {
+	Items []*T
+	Info  *PageInfo
+}
+
+// refreshTimeout bounds a load that no request waits for.
+const refreshTimeout = 10 * time.Second
+
+// cacheEntry is how a value is cached. It is served without a refresh
+// until Fresh and kept up to policy.Stale longer.
+type cacheEntry[T any] struct {
+	Value T         `json:"value"`
+	Fresh time.Time `json:"fresh"`
+}
+
+// readThrough returns the value cached under key, or loads it and caches
+// it under the tags it is given, following policy. Cache failures only
+// cost the load; errors are not cached.
+//
+// Loads shared by several callers, or run in the background, get a ctx that
+// outlives the request that started them, so one caller giving up does not
+// fail the others.
+func readThrough[T any](ctx context.Context, cache cacheKeys, key string, policy CachePolicy, tags func(T) []string, load func(context.Context) (T, error)) (T, error) {
+	if policy.TTL <= 0 || bypassesCache(ctx) {
+		return load(ctx)
+	}
+	fill := func(ctx context.Context) ([]byte, error) {
+		start := cache.fills.begin()
+		defer cache.fills.end(start)
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		serialized, err := json.Marshal(cacheEntry[T]{Value: v, Fresh: time.Now().Add(policy.TTL)})
+		if err != nil {
+			return nil, err
+		}
+		// A write that dropped the value's tags while it loaded may have
+		// made it stale. Checking again after the Set catches a write whose
+		// drop ran between the first check and the Set.
+		valueTags := tags(v)
+		if cache.fills.changedSince(start, valueTags) {
+			return serialized, nil
+		}
+		cache.SetWithTags(ctx, key, serialized, policy.TTL+policy.Stale, valueTags...)
+		if cache.fills.changedSince(start, valueTags) {
+			cache.Delete(ctx, key)
+		}
+		return serialized, nil
+	}
+
+	var entry cacheEntry[T]
+	val, err := cache.Get(ctx, key)
+	if err == nil && val != "" && json.Unmarshal([]byte(val), &entry) == nil && !entry.Fresh.IsZero() {
+		if time.Now().After(entry.Fresh) {
+			// Stale: serve it while a single load refreshes it. DoChan
+			// only starts a load if none is running for key.
+			cache.stats.record(key, cacheStaleHit)
+			cache.flight.DoChan(key, func() (any, error) {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+				defer cancel()
+				return fill(ctx)
+			})
+		} else {
+			cache.stats.record(key, cacheHit)
+		}
+		return entry.Value, nil
+	}
+	cache.stats.record(key, cacheMiss)
+
+	var serialized any
+	if policy.Collapse {
+		serialized, err, _ = cache.flight.Do(key, func() (any, error) {
+			return fill(context.WithoutCancel(ctx))
+		})
+	} else {
+		serialized, err = fill(ctx)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	// Each caller decodes its own copy, as they may change what they get.
+	entry = cacheEntry[T]{}
+	err = json.Unmarshal(serialized.([]byte), &entry)
+	return entry.Value, err
+}
+
+// tagged returns tags that do not depend on the value cached.
+func tagged[T any](tags ...string) func(T) []string {
+	return func(T) []string { return tags }
+}
+
+// listKey returns the key of a page of the family's list.
+func listKey(family string, filter any, pag *Pagination) string {
+	query, _ := json.Marshal(struct {
+		Filter     any
+		Pagination *Pagination
+	}{filter, pag})
+	digest := sha256.Sum256(query)
+	return family + hex.EncodeToString(digest[:12])
+}
+
+// cacheKeys reads and drops the keys of the cached stores. Failing to drop
+// a key leaves it stale until its TTL runs out; writes do not fail for it.
+type cacheKeys struct {
+	CacheStore
+	// flight collapses concurrent loads of a key.
+	flight *singleflight.Group
+	fills  *fillGuard
+	stats  *CacheStats
+}
+
+func newCacheKeys(cache CacheStore) cacheKeys {
+	return cacheKeys{CacheStore: cache, flight: &singleflight.Group{}, fills: newFillGuard(), stats: NewCacheStats()}
+}
+
+// invalidate drops the keys filed under the tags, recording them for
+// WithPurgedKeys.
+func (k cacheKeys) invalidate(ctx context.Context, tags ...string) {
+	k.fills.invalidated(tags...)
+	keys, _ := k.DeleteTags(ctx, tags...)
+	if purged, ok := ctx.Value(purgedKeysKey{}).(*PurgedKeys); ok {
+		purged.add(keys)
+	}
+}
+
+func (k cacheKeys) hotelChanged(ctx context.Context, id string) {
+	k.invalidate(ctx, HotelTag(id), hotelsTag)
+}
+
+func (k cacheKeys) roomChanged(ctx context.Context, id string) {
+	k.invalidate(ctx, RoomTag(id), roomsTag)
+}
+
+// roomsAdded drops the lists new rooms may join and their hotel, whose Rooms
+// and version change.
+func (k cacheKeys) roomsAdded(ctx context.Context, hotelID bson.ObjectID) {
+	k.invalidate(ctx, roomsTag, HotelTag(hotelID.Hex()), hotelsTag)
+}
+
+// fillGuard keeps a load that started before a write from caching what it
+// read once the write has dropped the keys under its tags. Writes count an
+// epoch up and record it for the tags they drop; a fill whose tags were
+// dropped after the epoch it started at does not cache its value.
+//
+// Only writes through this process are seen. A write through another
+// instance can still be overwritten by a load running here, and the value
+// then stays cached for its TTL.
+type fillGuard struct {
+	mu       sync.Mutex
+	epoch    uint64
+	inflight map[uint64]int    // loads running, by the epoch they started at
+	dropped  map[string]uint64 // the epoch each tag was last dropped at
+}
+
+func newFillGuard() *fillGuard {
+	return &fillGuard{
+		inflight: map[uint64]int{},
+		dropped:  map[string]uint64{},
+	}
+}
+
+// begin registers a load and returns the epoch it started at.
+func (g *fillGuard) begin() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inflight[g.epoch]++
+	return g.epoch
+}
+
+// end unregisters a load and forgets the drops no running load can be
+// affected by.
+func (g *fillGuard) end(start uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inflight[start]--; g.inflight[start] > 0 {
+		return
+	}
+	delete(g.inflight, start)
+	oldest := g.epoch
+	for epoch := range g.inflight {
+		oldest = min(oldest, epoch)
+	}
+	for tag, epoch := range g.dropped {
+		if epoch <= oldest {
+			delete(g.dropped, tag)
+		}
+	}
+}
+
+// invalidated records that the tags are being dropped.
+func (g *fillGuard) invalidated(tags ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.epoch++
+	if len(g.inflight) == 0 {
+		// Loads starting from now on read what the write left.
+		return
+	}
+	for _, tag := range tags {
+		g.dropped[tag] = g.epoch
+	}
+}
+
+// changedSince reports whether any of the tags was dropped after start.
+func (g *fillGuard) changedSince(start uint64, tags []string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, tag := range tags {
+		if g.dropped[tag] > start {
+			return true
+		}
+	}
+	return false
+}
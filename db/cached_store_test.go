@@ -0,0 +1,359 @@
+package db_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCachedStores(t *testing.T) {
+	ctx := context.Background()
+	backend := memory.NewStore()
+	cache := memory.NewCacheStore()
+	store := db.NewCachedStore(backend, cache, db.DefaultCacheConfig)
+
+	hotel, err := store.Hotel.InsertHotel(ctx, &types.Hotel{Name: "Grand Hotel", Location: "London", Rooms: []bson.ObjectID{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := hotel.ID.Hex()
+	if _, err := store.Hotel.GetHotelByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := cache.Get(ctx, "hotel-"+id); val == "" {
+		t.Fatal("expected the hotel to be cached after a read")
+	}
+
+	// A write behind the decorator's back is not seen until the TTL runs out.
+	if err := backend.Hotel.UpdateHotel(ctx, id, types.UpdateHotelParams{Name: "Hidden"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Grand Hotel" {
+		t.Errorf("expected the cached hotel but got %s", got.Name)
+	}
+	got, err = store.Hotel.GetHotelByID(db.WithDeleted(ctx), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Hidden" {
+		t.Errorf("expected WithDeleted to bypass the cache but got %s", got.Name)
+	}
+
+	hotels, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 1 {
+		t.Fatalf("expected 1 hotel but got %d", len(hotels))
+	}
+
+	// Adding a room through the decorator drops the hotel and every list.
+	room, err := store.Room.InsertRoom(ctx, &types.Room{HotelID: hotel.ID, Type: types.Double, Price: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Hidden" || len(got.Rooms) != 1 || got.Rooms[0] != room.ID {
+		t.Errorf("expected the stored hotel with its new room but got %+v", got)
+	}
+	if _, err := store.Hotel.InsertHotel(ctx, &types.Hotel{Name: "Budget Inn", Location: "Paris", Rooms: []bson.ObjectID{}}); err != nil {
+		t.Fatal(err)
+	}
+	hotels, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 2 {
+		t.Errorf("expected the new hotel to be listed but got %d hotels", len(hotels))
+	}
+
+	if _, err := store.Room.GetRoomByID(ctx, room.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Room.DeleteRoom(ctx, room.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Room.GetRoomByID(ctx, room.ID.Hex()); err == nil {
+		t.Error("expected the deleted room not to be served from the cache")
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rooms) != 0 {
+		t.Errorf("expected the hotel to lose its deleted room but got %v", got.Rooms)
+	}
+
+	// Booking writes drop every cached list of bookings.
+	room, err = store.Room.InsertRoom(ctx, &types.Room{HotelID: hotel.ID, Type: types.Single, Price: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookings, _, err := store.Booking.GetBookings(ctx, db.BookingFilter{RoomID: room.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 0 {
+		t.Fatalf("expected no bookings but got %d", len(bookings))
+	}
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	booking, err := store.Booking.InsertBooking(ctx, &types.Booking{RoomID: room.ID, FromDate: from, TillDate: from.AddDate(0, 0, 2), NumPersons: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookings, _, err = store.Booking.GetBookings(ctx, db.BookingFilter{RoomID: room.ID, Status: db.BookingStatusActive}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Fatalf("expected the new booking to be listed but got %d", len(bookings))
+	}
+	if _, err := store.Booking.GetBookingByID(ctx, booking.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Booking.CancelBooking(ctx, booking.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := store.Booking.GetBookingByID(ctx, booking.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookings, _, err = store.Booking.GetBookings(ctx, db.BookingFilter{RoomID: room.ID, Status: db.BookingStatusActive}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.Canceled || len(bookings) != 0 {
+		t.Errorf("expected the canceled booking to show as canceled and leave the active list but got %+v, %d", canceled, len(bookings))
+	}
+}
+
+// slowHotelStore counts the hotels it loads, each taking a while.
+type slowHotelStore struct {
+	db.HotelStore
+	loads atomic.Int32
+}
+
+func (s *slowHotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	s.loads.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return s.HotelStore.GetHotelByID(ctx, id)
+}
+
+func TestCachedStoreCollapsesMisses(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowHotelStore{HotelStore: memory.NewHotelStore()}
+	hotel, err := backend.InsertHotel(ctx, &types.Hotel{Name: "Grand Hotel", Location: "London", Rooms: []bson.ObjectID{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, collapse := range []bool{true, false} {
+		backend.loads.Store(0)
+		config := db.CacheConfig{Hotel: db.CachePolicy{TTL: time.Minute, Collapse: collapse}}
+		store := db.NewCachedHotelStore(backend, memory.NewCacheStore(), config)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.GetHotelByID(ctx, hotel.ID.Hex()); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if loads := backend.loads.Load(); collapse && loads != 1 || !collapse && loads < 2 {
+			t.Errorf("expected collapse=%t to load the hotel once only if set but it was loaded %d times", collapse, loads)
+		}
+	}
+}
+
+func TestCachedStoreServesStale(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowHotelStore{HotelStore: memory.NewHotelStore()}
+	hotel, err := backend.InsertHotel(ctx, &types.Hotel{Name: "Grand Hotel", Location: "London", Rooms: []bson.ObjectID{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := hotel.ID.Hex()
+	config := db.CacheConfig{Hotel: db.CachePolicy{TTL: 50 * time.Millisecond, Stale: time.Minute}}
+	store := db.NewCachedHotelStore(backend, memory.NewCacheStore(), config)
+	if _, err := store.GetHotelByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed behind the decorator's back, so only expiry can reveal it.
+	if err := backend.UpdateHotel(ctx, id, types.UpdateHotelParams{Name: "Grander Hotel"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		got, err := store.GetHotelByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Grand Hotel" {
+			t.Fatalf("expected the stale hotel while it refreshes but got %s", got.Name)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, err := store.GetHotelByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name == "Grander Hotel" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background refresh to replace the stale hotel")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if loads := backend.loads.Load(); loads != 2 {
+		t.Errorf("expected one load and one refresh but got %d loads", loads)
+	}
+}
+
+// pausedHotelStore reads a hotel, then waits for release before returning
+// it, as a load a write overtakes.
+type pausedHotelStore struct {
+	db.HotelStore
+	read, release chan struct{}
+}
+
+func (s *pausedHotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	hotel, err := s.HotelStore.GetHotelByID(ctx, id)
+	s.read <- struct{}{}
+	<-s.release
+	return hotel, err
+}
+
+func TestCachedStoreSkipsFillOvertakenByWrite(t *testing.T) {
+	ctx := context.Background()
+	backend := &pausedHotelStore{HotelStore: memory.NewHotelStore(), read: make(chan struct{}), release: make(chan struct{})}
+	hotel, err := backend.InsertHotel(ctx, &types.Hotel{Name: "Grand Hotel", Location: "London", Rooms: []bson.ObjectID{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := hotel.ID.Hex()
+	cache := memory.NewCacheStore()
+	store := db.NewCachedHotelStore(backend, cache, db.CacheConfig{Hotel: db.CachePolicy{TTL: time.Minute, Collapse: true}})
+
+	done := make(chan error)
+	go func() {
+		_, err := store.GetHotelByID(ctx, id)
+		done <- err
+	}()
+	<-backend.read
+	if err := store.UpdateHotel(ctx, id, types.UpdateHotelParams{Name: "Grander Hotel"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	family, _ := db.CacheFamilyByName("hotel")
+	if val, err := cache.Get(ctx, family.Prefix+id); err != nil || val != "" {
+		t.Errorf("expected the hotel read before the update not to be cached but got %q, %v", val, err)
+	}
+	// Loads that start after the write cache again.
+	go func() { <-backend.read }()
+	got, err := store.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Grander Hotel" {
+		t.Errorf("expected the updated hotel but got %s", got.Name)
+	}
+	if val, err := cache.Get(ctx, family.Prefix+id); err != nil || val == "" {
+		t.Errorf("expected the updated hotel cached but got %q, %v", val, err)
+	}
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	t.Setenv("CACHE_TTL_HOTEL", "90s")
+	t.Setenv("CACHE_STALE_HOTEL_ROOMS", "0")
+	t.Setenv("CACHE_COLLAPSE_ROOMS", "false")
+	config, err := db.CacheConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Hotel.TTL != 90*time.Second || config.Hotel.Stale != db.DefaultCacheConfig.Hotel.Stale {
+		t.Errorf("unexpected hotel policy %+v", config.Hotel)
+	}
+	if config.HotelRooms.Stale != 0 || config.Rooms.Collapse {
+		t.Errorf("unexpected room policies %+v, %+v", config.HotelRooms, config.Rooms)
+	}
+	t.Setenv("CACHE_TTL_BOOKING", "soon")
+	if _, err := db.CacheConfigFromEnv(); err == nil {
+		t.Error("expected a malformed TTL to be rejected")
+	}
+}
+
+func TestCacheStatsAndWarming(t *testing.T) {
+	ctx := context.Background()
+	backend := memory.NewStore()
+	cache := memory.NewCacheStore()
+	store := db.NewCachedStore(backend, cache, db.DefaultCacheConfig)
+
+	var ids []string
+	for _, name := range []string{"Grand Hotel", "City Lodge", "Harbour View"} {
+		hotel, err := backend.Hotel.InsertHotel(ctx, &types.Hotel{Name: name, Location: "London", Rooms: []bson.ObjectID{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, hotel.ID.Hex())
+	}
+	// City Lodge is the most viewed, then Grand Hotel.
+	for _, i := range []int{1, 0, 1, 2, 1, 0} {
+		db.RecordHotelView(ctx, cache, ids[i])
+	}
+	db.RecordHotelView(ctx, cache, bson.NewObjectID().Hex())
+
+	warmed, err := db.WarmCache(ctx, store, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warmed != 2 {
+		t.Errorf("expected the 2 top hotels still there to be warmed but got %d", warmed)
+	}
+	if _, err := store.Hotel.GetHotelByID(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := store.CacheStats.Families(ctx, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]types.CacheFamilyStats{}
+	for _, family := range families {
+		byName[family.Family] = family
+	}
+	// Warming missed the 2 hotels and the viewed hotel that is gone, and
+	// the later read hit.
+	if hotel := byName["hotel"]; hotel.Keys != 2 || hotel.Hits != 1 || hotel.Misses != 3 || hotel.HitRatio != 0.25 {
+		t.Errorf("unexpected hotel family %+v", hotel)
+	}
+	if rooms := byName["hotel-rooms"]; rooms.Keys != 2 || rooms.Misses != 2 {
+		t.Errorf("expected the rooms of both hotels to be warmed but got %+v", rooms)
+	}
+	if hotels := byName["hotels"]; hotels.Keys != 0 || hotels.HitRatio != 0 {
+		t.Errorf("expected no hotel lists but got %+v", hotels)
+	}
+}
@@ -2,14 +2,16 @@ package db
 
 const MongoDBNameEnvName = "MONGO_DB_NAME"
 
-type Pagination struct {
-	Limit int64
-	Page  int64
-}
+// BackendEnvName selects the storage backend: "mongo" (the default) or
+// "sqlite".
+const BackendEnvName = "DB_BACKEND"
+
 type Store struct {
 	User    UserStore
 	Hotel   HotelStore
 	Room    RoomStore
 	Booking BookingStore
 	Cache   CacheStore
+	// CacheStats is set by NewCachedStore.
+	CacheStats *CacheStats
 }
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Errors returned by every store implementation. Callers should test for
+// them with errors.Is, as stores wrap them with the resource involved.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID is returned when an id is not a valid ObjectID.
+	ErrInvalidID = errors.New("invalid id")
+
+	// ErrDuplicate is returned when a write violates a unique index, such as
+	// registering an email that is already taken.
+	ErrDuplicate = errors.New("already exists")
+
+	// ErrConflict is returned when a write collides with existing data, such
+	// as booking a room night that is already taken.
+	ErrConflict = errors.New("conflict")
+
+	// ErrInvalidCursor is returned by list methods given a malformed cursor.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrStaleVersion is returned when an update names a version that is no
+	// longer current because someone else wrote the record in between.
+	ErrStaleVersion = errors.New("stale version")
+)
+
+// ParseID converts a hex id, reporting malformed ids as ErrInvalidID.
+func ParseID(id string) (bson.ObjectID, error) {
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return oid, fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	return oid, nil
+}
+
+// NotFound returns ErrNotFound wrapped with the resource that is missing.
+func NotFound(resource string) error {
+	return fmt.Errorf("%s %w", resource, ErrNotFound)
+}
+
+// StaleVersion returns ErrStaleVersion wrapped with the resource involved.
+func StaleVersion(resource string) error {
+	return fmt.Errorf("%s %w", resource, ErrStaleVersion)
+}
+
+// mongoErr translates driver errors into the sentinel errors above.
+func mongoErr(resource string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound(resource)
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%s %w", resource, ErrDuplicate)
+	}
+	return err
+}
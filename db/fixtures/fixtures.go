@@ -42,15 +42,25 @@ func AddRoom(store *db.Store, roomType types.RoomType, basePrice float64, hid bs
 }
 
 func AddHotel(store *db.Store, name string, loc string, rating int, rooms []bson.ObjectID) *types.Hotel {
+	return insertHotel(store, name, loc, rating, rooms, nil)
+}
+
+// AddHotelAt adds a hotel without rooms at the given coordinates.
+func AddHotelAt(store *db.Store, name string, loc string, rating int, lat, lng float64) *types.Hotel {
+	return insertHotel(store, name, loc, rating, nil, types.NewGeoPoint(lat, lng))
+}
+
+func insertHotel(store *db.Store, name string, loc string, rating int, rooms []bson.ObjectID, coords *types.GeoPoint) *types.Hotel {
 	var roomIDS = rooms
 	if rooms == nil {
 		roomIDS = []bson.ObjectID{}
 	}
 	hotel := types.Hotel{
-		Name:     name,
-		Location: loc,
-		Rooms:    roomIDS,
-		Rating:   rating,
+		Name:        name,
+		Location:    loc,
+		Rooms:       roomIDS,
+		Rating:      rating,
+		Coordinates: coords,
 	}
 	insertedHotel, err := store.Hotel.InsertHotel(context.TODO(), &hotel)
 	if err != nil {
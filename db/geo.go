@@ -0,0 +1,103 @@
+package db
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"math"
+	"slices"
+
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// EarthRadius is the radius in meters Mongo uses for spherical geometry.
+// The other backends use it too so distances agree across them.
+const EarthRadius = 6378100.0
+
+// Distance returns the great-circle distance in meters between a and b.
+func Distance(a, b types.GeoPoint) float64 {
+	lat1, lat2 := radians(a.Lat()), radians(b.Lat())
+	dLat := lat2 - lat1
+	dLng := radians(b.Lng() - a.Lng())
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// geoNearPage runs a $geoNear search over the 2dsphere index on
+// coordinates, nearest first, with the distance in meters filled in.
+func geoNearPage(ctx context.Context, coll *mongo.Collection, query bson.M, near *types.GeoPoint, radius float64, pag *Pagination) ([]*types.Hotel, *PageInfo, error) {
+	geoNear := bson.M{
+		"near":          near,
+		"key":           "coordinates",
+		"distanceField": "distance",
+		"spherical":     true,
+		"query":         query,
+	}
+	if radius > 0 {
+		geoNear["maxDistance"] = radius
+	}
+	info := &PageInfo{}
+	// Ties are broken by id so pages do not overlap.
+	items := bson.A{bson.M{"$sort": bson.D{{Key: "distance", Value: 1}, {Key: "_id", Value: 1}}}}
+	if pag != nil {
+		limit, page := pag.Bounds()
+		info.Limit, info.Page = limit, page
+		items = append(items, bson.M{"$skip": (page - 1) * limit}, bson.M{"$limit": limit})
+	}
+	pipeline := bson.A{
+		bson.M{"$geoNear": geoNear},
+		bson.M{"$facet": bson.M{
+			"items": items,
+			"total": bson.A{bson.M{"$count": "n"}},
+		}},
+	}
+	cur, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
+	var result []struct {
+		Items []*types.Hotel `bson:"items"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+	}
+	if err := cur.All(ctx, &result); err != nil {
+		return nil, nil, err
+	}
+	hotels := []*types.Hotel{}
+	if len(result) > 0 {
+		hotels = append(hotels, result[0].Items...)
+		if len(result[0].Total) > 0 {
+			info.Total = result[0].Total[0].N
+		}
+	}
+	return hotels, info, nil
+}
+
+// nearest keeps the hotels with coordinates within radius meters of near
+// (any distance if radius is not positive), nearest first, with their
+// Distance set.
+func nearest(hotels []*types.Hotel, near *types.GeoPoint, radius float64) []*types.Hotel {
+	found := []*types.Hotel{}
+	for _, hotel := range hotels {
+		if hotel.Coordinates == nil {
+			continue
+		}
+		d := Distance(*near, *hotel.Coordinates)
+		if radius > 0 && d > radius {
+			continue
+		}
+		hotel.Distance = &d
+		found = append(found, hotel)
+	}
+	slices.SortFunc(found, func(a, b *types.Hotel) int {
+		return cmp.Or(cmp.Compare(*a.Distance, *b.Distance), bytes.Compare(a.ID[:], b.ID[:]))
+	})
+	return found
+}
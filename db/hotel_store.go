@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
-	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/raminfathi/GoTel/types"
 
@@ -13,10 +15,38 @@ import (
 
 type HotelStore interface {
 	InsertHotel(context.Context, *types.Hotel) (*types.Hotel, error)
-	UpdateHotel(context.Context, Map, Map) error
-	GetHotels(context.Context, Map, *Pagination) ([]*types.Hotel, error)
+	// UpdateHotel changes the given fields of a hotel. version is the
+	// version the caller read, or 0 to update unconditionally.
+	UpdateHotel(ctx context.Context, id string, params types.UpdateHotelParams, version int64) error
+	GetHotels(context.Context, HotelFilter, *Pagination) ([]*types.Hotel, *PageInfo, error)
 	GetHotelByID(context.Context, string) (*types.Hotel, error)
-	UpdateHotelsRooms(context.Context, bson.ObjectID, bson.ObjectID) error
+	// SuggestLocations lists up to limit distinct locations starting with
+	// prefix, ignoring case, those with the most hotels first.
+	SuggestLocations(ctx context.Context, prefix string, limit int) ([]types.LocationSuggestion, error)
+	// UpdateHotelsRooms appends roomIDs to the hotel's Rooms in one write.
+	UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error
+	// RemoveHotelRoom takes roomID off the hotel's Rooms.
+	RemoveHotelRoom(ctx context.Context, hotelID, roomID bson.ObjectID) error
+	// DeleteHotel soft-deletes the hotel only; its rooms are left to the
+	// caller.
+	DeleteHotel(context.Context, string) error
+}
+
+// HotelFilter selects hotels. Zero fields match every hotel; Location
+// matches case-insensitively anywhere in the hotel's location.
+//
+// A non-nil Near limits the results to hotels with coordinates, within
+// Radius meters of Near if Radius is positive, and orders them nearest
+// first with Distance set. A non-empty Query keeps the hotels whose name,
+// location or description contain any of its words (see SearchTerms) and
+// orders them by relevance with Score set. Near and Query exclude each other
+// and their results page by number only.
+type HotelFilter struct {
+	Rating   int
+	Location string
+	Near     *types.GeoPoint
+	Radius   float64
+	Query    string
 }
 
 type MongoHotelStore struct {
@@ -35,50 +65,118 @@ func NewMongoHotelStore(client *mongo.Client) *MongoHotelStore {
 		coll:   client.Database(dbname).Collection("hotels"),
 	}
 }
-func (s *MongoHotelStore) UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomID bson.ObjectID) error {
-	filter := bson.M{"_id": hotelID}
 
-	update := bson.M{"$push": bson.M{"rooms": roomID}}
+// Indexes declares the indexes the hotels collection needs.
+func (s *MongoHotelStore) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "rating", Value: 1}}},
+		{Keys: bson.D{{Key: "coordinates", Value: "2dsphere"}}},
+		textIndex(),
+	}
+}
+
+func (s *MongoHotelStore) EnsureIndexes(ctx context.Context) error {
+	return ensureIndexes(ctx, s.coll, s.Indexes())
+}
 
-	_, err := s.coll.UpdateOne(ctx, filter, update)
-	return err
+func (s *MongoHotelStore) UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error {
+	return versionedUpdate(ctx, s.coll, "hotel", hotelID, 0, bson.M{"$push": bson.M{"rooms": bson.M{"$each": roomIDs}}})
+}
+func (s *MongoHotelStore) DeleteHotel(ctx context.Context, id string) error {
+	oid, err := ParseID(id)
+	if err != nil {
+		return err
+	}
+	return softDelete(ctx, s.coll, "hotel", oid)
+}
+
+func (s *MongoHotelStore) RemoveHotelRoom(ctx context.Context, hotelID bson.ObjectID, roomID bson.ObjectID) error {
+	return versionedUpdate(ctx, s.coll, "hotel", hotelID, 0, bson.M{"$pull": bson.M{"rooms": roomID}})
 }
-func (s *MongoHotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
-	fmt.Println(id)
 
-	oid, err := bson.ObjectIDFromHex(id)
+func (s *MongoHotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	oid, err := ParseID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	var hotel *types.Hotel
-	err = s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&hotel)
+	err = s.coll.FindOne(ctx, notDeleted(ctx, bson.M{"_id": oid})).Decode(&hotel)
 	if err != nil {
-		return nil, err
+		return nil, mongoErr("hotel", err)
 	}
-	fmt.Println(hotel)
 	return hotel, nil
 }
 
-func (s *MongoHotelStore) GetHotels(ctx context.Context, filter Map, pag *Pagination) ([]*types.Hotel, error) {
-	resp, err := s.coll.Find(ctx, filter)
+func (s *MongoHotelStore) GetHotels(ctx context.Context, filter HotelFilter, pag *Pagination) ([]*types.Hotel, *PageInfo, error) {
+	if err := checkRankedSearch(filter, pag); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case filter.Near != nil:
+		return geoNearPage(ctx, s.coll, notDeleted(ctx, hotelFilterToBSON(filter)), filter.Near, filter.Radius, pag)
+	case filter.Query != "":
+		return textSearchPage(ctx, s.coll, notDeleted(ctx, hotelFilterToBSON(filter)), pag)
+	}
+	return findPage(ctx, s.coll, notDeleted(ctx, hotelFilterToBSON(filter)), pag, func(h *types.Hotel) bson.ObjectID { return h.ID })
+}
+
+func (s *MongoHotelStore) SuggestLocations(ctx context.Context, prefix string, limit int) ([]types.LocationSuggestion, error) {
+	pipeline := bson.A{
+		bson.M{"$match": notDeleted(ctx, bson.M{"location": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix), "$options": "i"}})},
+		bson.M{"$group": bson.M{"_id": "$location", "hotels": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "hotels", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": limit},
+	}
+	cur, err := s.coll.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
-
-	var hotels []*types.Hotel
-	if err := resp.All(ctx, &hotels); err != nil {
+	suggestions := []types.LocationSuggestion{}
+	if err := cur.All(ctx, &suggestions); err != nil {
 		return nil, err
 	}
-	return hotels, nil
+	return suggestions, nil
 }
-func (s *MongoHotelStore) UpdateHotel(ctx context.Context, filter Map, update Map) error {
-	doc := bson.M{"$set": update}
-	_, err := s.coll.UpdateOne(ctx, filter, doc)
-	return err
+
+func hotelFilterToBSON(f HotelFilter) bson.M {
+	filter := bson.M{}
+	if f.Rating > 0 {
+		filter["rating"] = f.Rating
+	}
+	if f.Location != "" {
+		filter["location"] = bson.M{"$regex": regexp.QuoteMeta(f.Location), "$options": "i"}
+	}
+	if f.Query != "" {
+		// Joining the terms drops the phrase and negation syntax of $search,
+		// which the other backends do not support.
+		filter["$text"] = bson.M{"$search": strings.Join(SearchTerms(f.Query), " ")}
+	}
+	return filter
+}
+
+func (s *MongoHotelStore) UpdateHotel(ctx context.Context, id string, params types.UpdateHotelParams, version int64) error {
+	oid, err := ParseID(id)
+	if err != nil {
+		return err
+	}
+	set := bson.M{}
+	if params.Name != "" {
+		set["name"] = params.Name
+	}
+	if params.Location != "" {
+		set["location"] = params.Location
+	}
+	if params.Description != "" {
+		set["description"] = params.Description
+	}
+	return versionedUpdate(ctx, s.coll, "hotel", oid, version, bson.M{"$set": set})
 }
 
 func (s *MongoHotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	hotel.CreatedAt = time.Now()
+	hotel.UpdatedAt = hotel.CreatedAt
+	hotel.Version = 1
 	resp, err := s.coll.InsertOne(ctx, hotel)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,292 @@
+// Package importer adds hotels and their rooms in bulk from CSV or JSON,
+// for the admin import endpoint and the import command.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+var ErrUnknownFormat = errors.New("import format must be csv or json")
+
+// ParseFormat accepts a format name, a file name or a content type.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(s)
+	switch {
+	case s == "csv", strings.HasSuffix(s, ".csv"), strings.HasPrefix(s, "text/csv"):
+		return CSV, nil
+	case s == "json", strings.HasSuffix(s, ".json"), strings.HasPrefix(s, "application/json"):
+		return JSON, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Read parses the hotels of an import. It only fails if the input as a
+// whole cannot be read; fields that cannot be parsed are recorded in the
+// Errors of their hotel or room.
+//
+// JSON input is an array of types.ImportHotel. CSV input has a header row
+// naming its columns, in any order:
+//
+//	name,location,description,lat,lng,roomType,basePrice
+//
+// Only name and location are required. Each row adds a room, if it has a
+// room type or price, to the hotel with its name and location; the first
+// row of a hotel provides its description and coordinates.
+func Read(r io.Reader, format Format) ([]types.ImportHotel, error) {
+	switch format {
+	case CSV:
+		return readCSV(r)
+	case JSON:
+		return readJSON(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func readJSON(r io.Reader) ([]types.ImportHotel, error) {
+	var hotels []types.ImportHotel
+	if err := json.NewDecoder(r).Decode(&hotels); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for i := range hotels {
+		hotels[i].Row = i + 1
+		for j := range hotels[i].Rooms {
+			hotels[i].Rooms[j].Row = j + 1
+		}
+	}
+	return hotels, nil
+}
+
+var csvColumns = []string{"name", "location", "description", "lat", "lng", "roomType", "basePrice"}
+
+func readCSV(r io.Reader) ([]types.ImportHotel, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		for _, column := range csvColumns {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				index[column] = i
+			}
+		}
+	}
+	for _, column := range []string{"name", "location"} {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("CSV header lacks the %s column", column)
+		}
+	}
+
+	hotels := []types.ImportHotel{}
+	byKey := map[string]int{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := index[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		key := field("name") + "\x00" + field("location")
+		i, ok := byKey[key]
+		if !ok {
+			hotel := types.ImportHotel{
+				Row:    line,
+				Errors: map[string]string{},
+				CreateHotelParams: types.CreateHotelParams{
+					Name:        field("name"),
+					Location:    field("location"),
+					Description: field("description"),
+				},
+				Rooms: []types.ImportRoom{},
+			}
+			hotel.Lat = parseFloat(field("lat"), "lat", hotel.Errors)
+			hotel.Lng = parseFloat(field("lng"), "lng", hotel.Errors)
+			i = len(hotels)
+			byKey[key] = i
+			hotels = append(hotels, hotel)
+		}
+
+		roomType, basePrice := field("roomType"), field("basePrice")
+		if roomType == "" && basePrice == "" {
+			continue
+		}
+		room := types.ImportRoom{
+			Row:              line,
+			Errors:           map[string]string{},
+			CreateRoomParams: types.CreateRoomParams{Type: roomType},
+		}
+		if price := parseFloat(basePrice, "basePrice", room.Errors); price != nil {
+			room.BasePrice = *price
+		}
+		hotels[i].Rooms = append(hotels[i].Rooms, room)
+	}
+	return hotels, nil
+}
+
+// parseFloat parses an optional number, noting a malformed one in errs.
+func parseFloat(s, field string, errs map[string]string) *float64 {
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		errs[field] = field + " must be a number"
+		return nil
+	}
+	return &f
+}
+
+// Import validates every hotel and room and, unless dryRun is set, adds the
+// hotels that are valid throughout, each with its rooms in one batch.
+func Import(ctx context.Context, store *db.Store, hotels []types.ImportHotel, dryRun bool) *types.ImportReport {
+	report := &types.ImportReport{DryRun: dryRun, Results: []types.ImportResult{}}
+	for _, hotel := range hotels {
+		result := importHotel(ctx, store, hotel, dryRun)
+		switch result.Status {
+		case types.ImportCreated, types.ImportValid:
+			report.Hotels++
+			report.Rooms += len(result.Rooms)
+		default:
+			report.Rejected++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func importHotel(ctx context.Context, store *db.Store, params types.ImportHotel, dryRun bool) types.ImportResult {
+	// The id is chosen up front so the rooms validate as rooms of the hotel.
+	hotelID := bson.NewObjectID()
+	result := types.ImportResult{
+		Row:    params.Row,
+		Name:   params.Name,
+		Errors: validate(params.Errors, params.Validate()),
+		Rooms:  []types.ImportResult{},
+	}
+	valid := len(result.Errors) == 0
+	rooms := make([]*types.Room, 0, len(params.Rooms))
+	for _, roomParams := range params.Rooms {
+		roomParams.HotelID = hotelID.Hex()
+		room := types.ImportResult{
+			Row:    roomParams.Row,
+			Errors: validate(roomParams.Errors, roomParams.Validate()),
+		}
+		roomType, known := types.ParseRoomType(roomParams.Type)
+		if _, ok := room.Errors["type"]; !ok && !known {
+			if room.Errors == nil {
+				room.Errors = map[string]string{}
+			}
+			room.Errors["type"] = fmt.Sprintf("unknown room type %q; use single, double, seaview or kingsuite", roomParams.Type)
+		}
+		if len(room.Errors) > 0 {
+			valid = false
+		}
+		result.Rooms = append(result.Rooms, room)
+		rooms = append(rooms, &types.Room{
+			Type:      roomType,
+			BasePrice: roomParams.BasePrice,
+			Price:     roomParams.BasePrice,
+		})
+	}
+
+	switch {
+	case !valid:
+		if result.Errors == nil {
+			result.Errors = map[string]string{"rooms": "some rooms are invalid"}
+		}
+		setStatus(&result, types.ImportInvalid, types.ImportSkipped)
+		return result
+	case dryRun:
+		setStatus(&result, types.ImportValid, types.ImportValid)
+		return result
+	}
+
+	hotel := &types.Hotel{
+		ID:          hotelID,
+		Name:        params.Name,
+		Location:    params.Location,
+		Description: params.Description,
+		Coordinates: params.Coordinates(),
+		Rooms:       []bson.ObjectID{},
+	}
+	if _, err := store.Hotel.InsertHotel(ctx, hotel); err != nil {
+		result.Errors = map[string]string{"store": err.Error()}
+		setStatus(&result, types.ImportFailed, types.ImportSkipped)
+		return result
+	}
+	if _, err := store.Room.InsertRooms(ctx, hotelID, rooms); err != nil {
+		result.Errors = map[string]string{"store": err.Error()}
+		// Do not leave the hotel live without the rooms it came with.
+		// Deleting it only marks it deleted, so its ID is reported either
+		// way.
+		if err := store.Hotel.DeleteHotel(ctx, hotelID.Hex()); err != nil {
+			result.Errors["rollback"] = "the hotel was added without its rooms and could not be deleted: " + err.Error()
+		}
+		result.ID = hotelID.Hex()
+		setStatus(&result, types.ImportFailed, types.ImportFailed)
+		return result
+	}
+	result.ID = hotelID.Hex()
+	setStatus(&result, types.ImportCreated, types.ImportCreated)
+	for i, room := range rooms {
+		result.Rooms[i].ID = room.ID.Hex()
+	}
+	return result
+}
+
+// validate merges the errors found while reading a row with those of its
+// Validate method, returning nil if there are none.
+func validate(read, invalid map[string]string) map[string]string {
+	if len(read) == 0 && len(invalid) == 0 {
+		return nil
+	}
+	errs := maps.Clone(read)
+	if errs == nil {
+		errs = map[string]string{}
+	}
+	maps.Copy(errs, invalid)
+	return errs
+}
+
+// setStatus sets the status of the hotel, and that of its rooms which have
+// not been found invalid.
+func setStatus(result *types.ImportResult, hotel, rooms types.ImportStatus) {
+	result.Status = hotel
+	for i := range result.Rooms {
+		if result.Rooms[i].Errors != nil {
+			result.Rooms[i].Status = types.ImportInvalid
+		} else {
+			result.Rooms[i].Status = rooms
+		}
+	}
+}
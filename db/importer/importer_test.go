@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const hotelsCSV = `Name,Location,Description,Lat,Lng,RoomType,BasePrice
+Harbour View,Sydney,By the water,-33.86,151.21,single,120
+City Lodge,Melbourne,,,,,
+Harbour View,Sydney,,,,double,180
+Broken Inn,Perth,,north,,seaview,-5
+`
+
+func TestReadCSV(t *testing.T) {
+	hotels, err := Read(strings.NewReader(hotelsCSV), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 3 {
+		t.Fatalf("expected 3 hotels but got %d", len(hotels))
+	}
+	harbour := hotels[0]
+	if harbour.Row != 2 || harbour.Description != "By the water" || harbour.Coordinates() == nil {
+		t.Errorf("expected the first row to describe the hotel but got %+v", harbour)
+	}
+	if len(harbour.Rooms) != 2 || harbour.Rooms[0].Row != 2 || harbour.Rooms[1].Row != 4 || harbour.Rooms[1].Type != "double" {
+		t.Errorf("expected rooms from rows 2 and 4 but got %+v", harbour.Rooms)
+	}
+	if len(hotels[1].Rooms) != 0 {
+		t.Errorf("expected a row without room columns to add no room but got %+v", hotels[1].Rooms)
+	}
+	if _, ok := hotels[2].Errors["lat"]; !ok {
+		t.Errorf("expected a lat error but got %v", hotels[2].Errors)
+	}
+
+	if _, err := Read(strings.NewReader("name,rating\nGrand,5\n"), CSV); err == nil {
+		t.Error("expected a header without location to be rejected")
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	hotels, err := Read(strings.NewReader(`[
+		{"name": "Harbour View", "location": "Sydney", "rooms": [{"type": "single", "basePrice": 120}, {"type": "double", "basePrice": 180}]},
+		{"name": "Half Built", "location": "Sydney", "rooms": [{"type": "single", "basePrice": 90}, {"type": "x", "basePrice": 0}]},
+		{"name": "No", "location": "Perth", "lat": 12}
+	]`), JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Import(ctx, store, hotels, true)
+	if report.Hotels != 1 || report.Rooms != 2 || report.Rejected != 2 {
+		t.Errorf("unexpected dry run counts %+v", report)
+	}
+	all, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("expected a dry run to add nothing but found %d hotels", len(all))
+	}
+
+	report = Import(ctx, store, hotels, false)
+	harbour, halfBuilt, no := report.Results[0], report.Results[1], report.Results[2]
+	if harbour.Status != types.ImportCreated || harbour.ID == "" || harbour.Rooms[1].Status != types.ImportCreated {
+		t.Errorf("expected the valid hotel and its rooms to be created but got %+v", harbour)
+	}
+	if halfBuilt.Status != types.ImportInvalid || halfBuilt.Rooms[0].Status != types.ImportSkipped || halfBuilt.Rooms[1].Status != types.ImportInvalid || halfBuilt.Rooms[1].Row != 2 {
+		t.Errorf("expected a hotel with an invalid room to be skipped whole but got %+v", halfBuilt)
+	}
+	if no.Status != types.ImportInvalid || no.Errors["name"] == "" || no.Errors["coordinates"] == "" {
+		t.Errorf("expected name and coordinates errors but got %+v", no)
+	}
+
+	hotel, err := store.Hotel.GetHotelByID(ctx, harbour.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotel.Rooms) != 2 || hotel.Rooms[0].Hex() != harbour.Rooms[0].ID {
+		t.Errorf("expected the hotel to list its 2 imported rooms but got %v", hotel.Rooms)
+	}
+	rooms, _, err := store.Room.GetRooms(ctx, db.RoomFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 {
+		t.Errorf("expected only the 2 valid rooms to be added but got %d", len(rooms))
+	}
+}
+
+func TestImportRoomTypes(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	hotels, err := Read(strings.NewReader(`[
+		{"name": "Royal Court", "location": "London", "rooms": [{"type": "kingsuite", "basePrice": 500}]},
+		{"name": "Typo Inn", "location": "London", "rooms": [{"type": "dubble", "basePrice": 90}]}
+	]`), JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := Import(ctx, store, hotels, false)
+	royal, typo := report.Results[0], report.Results[1]
+	if royal.Status != types.ImportCreated {
+		t.Fatalf("expected the king suite hotel to be created but got %+v", royal)
+	}
+	room, err := store.Room.GetRoomByID(ctx, royal.Rooms[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Type != types.KingSuite {
+		t.Errorf("expected a king suite but got %s", room.Type)
+	}
+	if typo.Status != types.ImportInvalid || typo.Rooms[0].Errors["type"] == "" {
+		t.Errorf("expected an unknown room type to be reported on its row but got %+v", typo)
+	}
+}
+
+// failingRoomStore refuses to add rooms and failingHotelStore to delete
+// hotels.
+type failingRoomStore struct{ db.RoomStore }
+
+func (failingRoomStore) InsertRooms(context.Context, bson.ObjectID, []*types.Room) ([]*types.Room, error) {
+	return nil, errors.New("rooms refused")
+}
+
+type failingHotelStore struct{ db.HotelStore }
+
+func (failingHotelStore) DeleteHotel(context.Context, string) error {
+	return errors.New("delete refused")
+}
+
+func TestImportRollback(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	store.Room = failingRoomStore{store.Room}
+	store.Hotel = failingHotelStore{store.Hotel}
+	hotels, err := Read(strings.NewReader(`[{"name": "Harbour View", "location": "Sydney", "rooms": [{"type": "single", "basePrice": 120}]}]`), JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Import(ctx, store, hotels, false).Results[0]
+	if result.Status != types.ImportFailed || result.Errors["store"] == "" || result.Errors["rollback"] == "" || result.ID == "" {
+		t.Errorf("expected the failed rollback to be reported with the hotel left behind but got %+v", result)
+	}
+}
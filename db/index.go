@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Indexer is implemented by stores that need indexes on their collections.
+type Indexer interface {
+	EnsureIndexes(context.Context) error
+}
+
+// EnsureIndexes creates the indexes declared by every store that implements
+// Indexer. Creating an index that already exists is a no-op, so it is safe
+// to run on every startup.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	for _, store := range []any{s.User, s.Hotel, s.Room, s.Booking} {
+		indexer, ok := store.(Indexer)
+		if !ok {
+			continue
+		}
+		if err := indexer.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureIndexes(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	return err
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttempts is what is known about the failed logins under a key.
+// Blocked is how long logins under it are refused for, or zero.
+type LoginAttempts struct {
+	Failures int
+	Blocked  time.Duration
+}
+
+// LoginAttemptStore counts failed logins per key, such as an account or a
+// client address, and blocks keys for a while.
+type LoginAttemptStore interface {
+	// LoginAttempts returns the state of each key, in order.
+	LoginAttempts(ctx context.Context, keys ...string) ([]LoginAttempts, error)
+	// RecordLoginFailure counts a failure under key and returns the count.
+	// Failures are forgotten window after the last one.
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// ForgetLoginFailure takes back one failure counted under key, as for
+	// an attempt counted in advance that succeeded.
+	ForgetLoginFailure(ctx context.Context, key string) error
+	// BlockLogin refuses logins under key for d.
+	BlockLogin(ctx context.Context, key string, d time.Duration) error
+	// ResetLogin forgets the failures and blocks of the keys.
+	ResetLogin(ctx context.Context, keys ...string) error
+}
+
+// RedisLoginAttemptStore keeps the attempts in Redis. Its calls go through
+// breaker, which may be nil, and fail with ErrCacheBreakerOpen at once
+// while it is open.
+type RedisLoginAttemptStore struct {
+	client  *redis.Client
+	breaker *CacheBreaker
+}
+
+func NewRedisLoginAttemptStore(client *redis.Client, breaker *CacheBreaker) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+// call runs fn through the breaker.
+func (s *RedisLoginAttemptStore) call(ctx context.Context, fn func(context.Context) error) error {
+	skipped, err := s.breaker.call(ctx, false, fn)
+	if skipped {
+		return ErrCacheBreakerOpen
+	}
+	return err
+}
+
+// blockKey is the key whose expiry is the block of key.
+func blockKey(key string) string {
+	return key + ":block"
+}
+
+func (s *RedisLoginAttemptStore) LoginAttempts(ctx context.Context, keys ...string) ([]LoginAttempts, error) {
+	attempts := make([]LoginAttempts, len(keys))
+	if len(keys) == 0 {
+		return attempts, nil
+	}
+	var (
+		get  = make([]*redis.StringCmd, len(keys))
+		pttl = make([]*redis.DurationCmd, len(keys))
+	)
+	err := s.call(ctx, func(ctx context.Context) error {
+		_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				get[i] = pipe.Get(ctx, key)
+				pttl[i] = pipe.PTTL(ctx, blockKey(key))
+			}
+			return nil
+		})
+		if err == redis.Nil {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		attempts[i].Failures, _ = get[i].Int()
+		if ttl := pttl[i].Val(); ttl > 0 {
+			attempts[i].Blocked = ttl
+		}
+	}
+	return attempts, nil
+}
+
+func (s *RedisLoginAttemptStore) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	err := s.call(ctx, func(ctx context.Context) error {
+		_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			incr = pipe.Incr(ctx, key)
+			pipe.PExpire(ctx, key, window)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// forgetFailureScript decrements a failure count that is still there, so
+// an expired one is not brought back without an expiry.
+var forgetFailureScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisLoginAttemptStore) ForgetLoginFailure(ctx context.Context, key string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return forgetFailureScript.Run(ctx, s.client, []string{key}).Err()
+	})
+}
+
+func (s *RedisLoginAttemptStore) BlockLogin(ctx context.Context, key string, d time.Duration) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.client.Set(ctx, blockKey(key), 1, d).Err()
+	})
+}
+
+func (s *RedisLoginAttemptStore) ResetLogin(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	all := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		all = append(all, key, blockKey(key))
+	}
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.client.Del(ctx, all...).Err()
+	})
+}
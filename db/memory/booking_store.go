@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type roomNight struct {
+	roomID bson.ObjectID
+	date   time.Time
+}
+
+type BookingStore struct {
+	mu       sync.RWMutex
+	bookings map[bson.ObjectID]types.Booking
+	// nights is the room-night ledger, mapping each held night to the
+	// booking that holds it.
+	nights map[roomNight]bson.ObjectID
+
+	// RoomStore resolves HotelID filters, since bookings only know their room.
+	RoomStore db.RoomStore
+}
+
+func NewBookingStore(roomStore db.RoomStore) *BookingStore {
+	return &BookingStore{
+		bookings:  map[bson.ObjectID]types.Booking{},
+		nights:    map[roomNight]bson.ObjectID{},
+		RoomStore: roomStore,
+	}
+}
+
+func (s *BookingStore) IsRoomAvailable(ctx context.Context, roomID bson.ObjectID, from, till time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, booking := range s.bookings {
+		if booking.RoomID != roomID || booking.Canceled {
+			continue
+		}
+		// Same overlap rule as the Mongo query: fromDate < till && tillDate > from.
+		if booking.FromDate.Before(till) && booking.TillDate.After(from) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *BookingStore) GetBookingByID(ctx context.Context, id string) (*types.Booking, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	booking, ok := s.bookings[oid]
+	if !ok || !visible(ctx, booking.DeletedAt) {
+		return nil, db.NotFound("booking")
+	}
+	return &booking, nil
+}
+
+func (s *BookingStore) GetBookings(ctx context.Context, filter db.BookingFilter, pag *db.Pagination) ([]*types.Booking, *db.PageInfo, error) {
+	var hotelRooms map[bson.ObjectID]bool
+	if !filter.HotelID.IsZero() {
+		// Deleted rooms' bookings still belong to the hotel.
+		rooms, _, err := s.RoomStore.GetRooms(db.WithDeleted(ctx), db.RoomFilter{HotelID: filter.HotelID}, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		hotelRooms = map[bson.ObjectID]bool{}
+		for _, room := range rooms {
+			hotelRooms[room.ID] = true
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bookings := []*types.Booking{}
+	for _, booking := range s.bookings {
+		if hotelRooms != nil && !hotelRooms[booking.RoomID] {
+			continue
+		}
+		if visible(ctx, booking.DeletedAt) && matchBooking(&booking, filter) {
+			bookings = append(bookings, &booking)
+		}
+	}
+	id := func(b *types.Booking) bson.ObjectID { return b.ID }
+	sortByID(bookings, id)
+	return paginate(bookings, pag, id)
+}
+
+func (s *BookingStore) CancelBooking(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	booking, ok := s.bookings[oid]
+	if !ok {
+		return db.NotFound("booking")
+	}
+	booking.Canceled = true
+	booking.UpdatedAt = time.Now()
+	s.bookings[oid] = booking
+	for night, bookingID := range s.nights {
+		if bookingID == oid {
+			delete(s.nights, night)
+		}
+	}
+	return nil
+}
+
+func (s *BookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if booking.ID.IsZero() {
+		booking.ID = bson.NewObjectID()
+	}
+	booking.CreatedAt = time.Now()
+	booking.UpdatedAt = booking.CreatedAt
+	if !booking.Canceled {
+		nights := db.BookingNights(booking.FromDate, booking.TillDate)
+		for _, date := range nights {
+			if _, taken := s.nights[roomNight{booking.RoomID, date}]; taken {
+				return nil, db.ErrConflict
+			}
+		}
+		for _, date := range nights {
+			s.nights[roomNight{booking.RoomID, date}] = booking.ID
+		}
+	}
+	s.bookings[booking.ID] = *booking
+	return booking, nil
+}
+
+// matchBooking applies every BookingFilter field except HotelID, which
+// GetBookings resolves through the room store.
+func matchBooking(booking *types.Booking, filter db.BookingFilter) bool {
+	if !filter.UserID.IsZero() && booking.UserID != filter.UserID {
+		return false
+	}
+	if !filter.RoomID.IsZero() && booking.RoomID != filter.RoomID {
+		return false
+	}
+	if !filter.From.IsZero() && !booking.TillDate.After(filter.From) {
+		return false
+	}
+	if !filter.Till.IsZero() && !booking.FromDate.Before(filter.Till) {
+		return false
+	}
+	switch filter.Status {
+	case db.BookingStatusActive:
+		return !booking.Canceled
+	case db.BookingStatusCanceled:
+		return booking.Canceled
+	}
+	return true
+}
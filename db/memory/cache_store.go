@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// CacheStore mirrors RedisCacheStore: values are stored as strings, a
+// zero expiration keeps the key forever and a miss returns "" with no error.
+type CacheStore struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// tags maps a tag to the keys filed under it. Keys that expired or were
+	// deleted may linger until the tag is deleted.
+	tags     map[string]map[string]struct{}
+	rankings map[string]map[string]float64
+}
+
+func NewCacheStore() *CacheStore {
+	return &CacheStore{
+		entries:  map[string]cacheEntry{},
+		tags:     map[string]map[string]struct{}{},
+		rankings: map[string]map[string]float64{},
+	}
+}
+
+func (c *CacheStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.SetWithTags(ctx, key, value, expiration)
+}
+
+func (c *CacheStore) SetWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) error {
+	entry := cacheEntry{value: toCacheString(value)}
+	if expiration > 0 {
+		entry.expires = time.Now().Add(expiration)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+func (c *CacheStore) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key, time.Now()), nil
+}
+
+func (c *CacheStore) GetMany(ctx context.Context, keys ...string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = c.get(key, now)
+	}
+	return values, nil
+}
+
+// get returns the live value of key, dropping it if it has expired. The
+// caller holds c.mu.
+func (c *CacheStore) get(key string, now time.Time) string {
+	entry, ok := c.entries[key]
+	if !ok {
+		return ""
+	}
+	if entry.expired(now) {
+		delete(c.entries, key)
+		return ""
+	}
+	return entry.value
+}
+
+func (c *CacheStore) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+		delete(c.rankings, key)
+	}
+	return nil
+}
+
+// DeleteTags returns only the keys that had not expired, as Redis does.
+func (c *CacheStore) DeleteTags(ctx context.Context, tags ...string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	deleted := []string{}
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if entry, ok := c.entries[key]; ok && !entry.expired(now) {
+				deleted = append(deleted, key)
+			}
+			delete(c.entries, key)
+		}
+		delete(c.tags, tag)
+	}
+	return deleted, nil
+}
+
+func (c *CacheStore) DeletePrefix(ctx context.Context, prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.rankings {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.rankings, key)
+		}
+	}
+	return nil
+}
+
+func (c *CacheStore) CountPrefix(ctx context.Context, prefix string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for key, entry := range c.entries {
+		if strings.HasPrefix(key, prefix) && !entry.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *CacheStore) IncrRank(ctx context.Context, ranking, member string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rankings[ranking] == nil {
+		c.rankings[ranking] = map[string]float64{}
+	}
+	c.rankings[ranking][member]++
+	return nil
+}
+
+// TopRanked breaks ties like Redis does, by member in reverse order.
+func (c *CacheStore) TopRanked(ctx context.Context, ranking string, n int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scores := c.rankings[ranking]
+	members := make([]string, 0, len(scores))
+	for member := range scores {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if scores[members[i]] != scores[members[j]] {
+			return scores[members[i]] > scores[members[j]]
+		}
+		return members[i] > members[j]
+	})
+	return members[:min(max(n, 0), len(members))], nil
+}
+
+// toCacheString converts a value the way go-redis writes it to the wire.
+func toCacheString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
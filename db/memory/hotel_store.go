@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type HotelStore struct {
+	mu     sync.RWMutex
+	hotels map[bson.ObjectID]types.Hotel
+}
+
+func NewHotelStore() *HotelStore {
+	return &HotelStore{
+		hotels: map[bson.ObjectID]types.Hotel{},
+	}
+}
+
+func (s *HotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hotel.ID.IsZero() {
+		hotel.ID = bson.NewObjectID()
+	}
+	hotel.CreatedAt = time.Now()
+	hotel.UpdatedAt = hotel.CreatedAt
+	hotel.Version = 1
+	s.hotels[hotel.ID] = cloneHotel(*hotel)
+	return hotel, nil
+}
+
+func (s *HotelStore) UpdateHotel(ctx context.Context, id string, params types.UpdateHotelParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hotel, ok := s.hotels[oid]
+	if !ok || hotel.DeletedAt != nil {
+		return db.NotFound("hotel")
+	}
+	if version > 0 && hotel.Version != version {
+		return db.StaleVersion("hotel")
+	}
+	hotel.Version++
+	hotel.UpdatedAt = time.Now()
+	if params.Name != "" {
+		hotel.Name = params.Name
+	}
+	if params.Location != "" {
+		hotel.Location = params.Location
+	}
+	if params.Description != "" {
+		hotel.Description = params.Description
+	}
+	s.hotels[oid] = hotel
+	return nil
+}
+
+func (s *HotelStore) GetHotels(ctx context.Context, filter db.HotelFilter, pag *db.Pagination) ([]*types.Hotel, *db.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hotels := []*types.Hotel{}
+	for _, hotel := range s.hotels {
+		if visible(ctx, hotel.DeletedAt) && matchHotel(&hotel, filter) {
+			hotel := cloneHotel(hotel)
+			hotels = append(hotels, &hotel)
+		}
+	}
+	id := func(h *types.Hotel) bson.ObjectID { return h.ID }
+	sortByID(hotels, id)
+	if filter.Near != nil || filter.Query != "" {
+		return db.RankHotels(hotels, filter, pag)
+	}
+	return paginate(hotels, pag, id)
+}
+
+func (s *HotelStore) SuggestLocations(ctx context.Context, prefix string, limit int) ([]types.LocationSuggestion, error) {
+	s.mu.RLock()
+	counts := map[string]int{}
+	for _, hotel := range s.hotels {
+		if visible(ctx, hotel.DeletedAt) && strings.HasPrefix(strings.ToLower(hotel.Location), strings.ToLower(prefix)) {
+			counts[hotel.Location]++
+		}
+	}
+	s.mu.RUnlock()
+	suggestions := []types.LocationSuggestion{}
+	for location, n := range counts {
+		suggestions = append(suggestions, types.LocationSuggestion{Location: location, Hotels: n})
+	}
+	slices.SortFunc(suggestions, func(a, b types.LocationSuggestion) int {
+		return cmp.Or(cmp.Compare(b.Hotels, a.Hotels), strings.Compare(a.Location, b.Location))
+	})
+	return suggestions[:min(limit, len(suggestions))], nil
+}
+
+func (s *HotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hotel, ok := s.hotels[oid]
+	if !ok || !visible(ctx, hotel.DeletedAt) {
+		return nil, db.NotFound("hotel")
+	}
+	hotel = cloneHotel(hotel)
+	return &hotel, nil
+}
+
+func (s *HotelStore) UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hotel, ok := s.hotels[hotelID]
+	if !ok || hotel.DeletedAt != nil {
+		return db.NotFound("hotel")
+	}
+	hotel.Rooms = append(slices.Clone(hotel.Rooms), roomIDs...)
+	hotel.Version++
+	hotel.UpdatedAt = time.Now()
+	s.hotels[hotelID] = hotel
+	return nil
+}
+
+func (s *HotelStore) DeleteHotel(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hotel, ok := s.hotels[oid]
+	if !ok || hotel.DeletedAt != nil {
+		return db.NotFound("hotel")
+	}
+	now := time.Now()
+	hotel.DeletedAt = &now
+	hotel.UpdatedAt = now
+	hotel.Version++
+	s.hotels[oid] = hotel
+	return nil
+}
+
+func (s *HotelStore) RemoveHotelRoom(ctx context.Context, hotelID bson.ObjectID, roomID bson.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hotel, ok := s.hotels[hotelID]
+	if !ok || hotel.DeletedAt != nil {
+		return db.NotFound("hotel")
+	}
+	hotel.Rooms = slices.DeleteFunc(slices.Clone(hotel.Rooms), func(id bson.ObjectID) bool { return id == roomID })
+	hotel.Version++
+	hotel.UpdatedAt = time.Now()
+	s.hotels[hotelID] = hotel
+	return nil
+}
+
+func cloneHotel(hotel types.Hotel) types.Hotel {
+	hotel.Rooms = slices.Clone(hotel.Rooms)
+	if hotel.Coordinates != nil {
+		point := *hotel.Coordinates
+		point.Coordinates = slices.Clone(point.Coordinates)
+		hotel.Coordinates = &point
+	}
+	return hotel
+}
+
+// matchHotel mirrors the Mongo filter: exact rating and a case-insensitive
+// substring match on location.
+func matchHotel(hotel *types.Hotel, filter db.HotelFilter) bool {
+	if filter.Rating > 0 && hotel.Rating != filter.Rating {
+		return false
+	}
+	if filter.Location != "" && !strings.Contains(strings.ToLower(hotel.Location), strings.ToLower(filter.Location)) {
+		return false
+	}
+	return true
+}
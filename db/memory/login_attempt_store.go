@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+)
+
+type loginAttempts struct {
+	failures int
+	forget   time.Time
+	blocked  time.Time
+}
+
+// LoginAttemptStore mirrors db.RedisLoginAttemptStore in process.
+type LoginAttemptStore struct {
+	mu   sync.Mutex
+	keys map[string]*loginAttempts
+}
+
+func NewLoginAttemptStore() *LoginAttemptStore {
+	return &LoginAttemptStore{
+		keys: map[string]*loginAttempts{},
+	}
+}
+
+// get returns the live state of key, creating it. The caller holds s.mu.
+func (s *LoginAttemptStore) get(key string, now time.Time) *loginAttempts {
+	a, ok := s.keys[key]
+	if !ok {
+		a = &loginAttempts{}
+		s.keys[key] = a
+	}
+	if !now.Before(a.forget) {
+		a.failures = 0
+	}
+	return a
+}
+
+func (s *LoginAttemptStore) LoginAttempts(ctx context.Context, keys ...string) ([]db.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	attempts := make([]db.LoginAttempts, len(keys))
+	for i, key := range keys {
+		a, ok := s.keys[key]
+		if !ok {
+			continue
+		}
+		if now.Before(a.forget) {
+			attempts[i].Failures = a.failures
+		}
+		if now.Before(a.blocked) {
+			attempts[i].Blocked = a.blocked.Sub(now)
+		}
+	}
+	return attempts, nil
+}
+
+func (s *LoginAttemptStore) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	a := s.get(key, now)
+	a.failures++
+	a.forget = now.Add(window)
+	return a.failures, nil
+}
+
+func (s *LoginAttemptStore) ForgetLoginFailure(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.get(key, time.Now()); a.failures > 0 {
+		a.failures--
+	}
+	return nil
+}
+
+func (s *LoginAttemptStore) BlockLogin(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.get(key, now).blocked = now.Add(d)
+	return nil
+}
+
+func (s *LoginAttemptStore) ResetLogin(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.keys, key)
+	}
+	return nil
+}
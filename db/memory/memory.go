@@ -0,0 +1,75 @@
+// Package memory provides in-memory implementations of the db store
+// interfaces. They need no outside services and are meant for tests and
+// local development; data lives only as long as the process.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// NewStore returns a db.Store where every store is backed by memory.
+func NewStore() *db.Store {
+	hotelStore := NewHotelStore()
+	roomStore := NewRoomStore(hotelStore)
+	return &db.Store{
+		User:    NewUserStore(),
+		Hotel:   hotelStore,
+		Room:    roomStore,
+		Booking: NewBookingStore(roomStore),
+		Cache:   NewCacheStore(),
+	}
+}
+
+// visible reports whether a record with the given deletion time should be
+// returned under ctx, following db.WithDeleted.
+func visible(ctx context.Context, deletedAt *time.Time) bool {
+	return deletedAt == nil || db.IncludesDeleted(ctx)
+}
+
+// sortByID orders items by their ObjectID, which matches the natural
+// insertion order Mongo returns documents in.
+func sortByID[T any](items []T, id func(T) bson.ObjectID) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := id(items[i]), id(items[j])
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+}
+
+// paginate cuts the window pag selects out of items, which must already be
+// sorted by id. It mirrors the Mongo stores' page and cursor handling.
+func paginate[T any](items []*T, pag *db.Pagination, id func(*T) bson.ObjectID) ([]*T, *db.PageInfo, error) {
+	info := &db.PageInfo{Total: int64(len(items))}
+	if pag == nil {
+		return items, info, nil
+	}
+	limit, page := pag.Bounds()
+	info.Limit = limit
+
+	start := 0
+	if pag.Cursor != "" {
+		after, err := db.DecodeCursor(pag.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		start = sort.Search(len(items), func(i int) bool {
+			oid := id(items[i])
+			return bytes.Compare(oid[:], after[:]) > 0
+		})
+	} else {
+		info.Page = page
+		start = int(min((page-1)*limit, int64(len(items))))
+	}
+
+	end := min(start+int(limit), len(items))
+	window := items[start:end]
+	if end < len(items) {
+		info.NextCursor = db.EncodeCursor(id(window[len(window)-1]))
+	}
+	return window, info, nil
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *db.Store {
+		return NewStore()
+	})
+}
+
+// TestCachedConformance runs the suite through the cached stores, which
+// must be indistinguishable from the stores they wrap.
+func TestCachedConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *db.Store {
+		return db.NewCachedStore(NewStore(), NewCacheStore(), db.DefaultCacheConfig)
+	})
+}
+
+func TestRateLimiterConformance(t *testing.T) {
+	storetest.RunRateLimiter(t, NewRateLimiter())
+}
+
+func TestLoginAttemptConformance(t *testing.T) {
+	storetest.RunLoginAttempts(t, NewLoginAttemptStore())
+}
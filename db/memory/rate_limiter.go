@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+)
+
+// RateLimiter mirrors db.RedisRateLimiter in process.
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		requests: map[string][]time.Time{},
+	}
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (db.RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	requests := l.requests[key]
+	for len(requests) > 0 && !requests[0].After(now.Add(-window)) {
+		requests = requests[1:]
+	}
+	res := db.RateLimitResult{Reset: window}
+	if len(requests) < limit {
+		requests = append(requests, now)
+		res.Allowed = true
+	}
+	res.Remaining = max(limit-len(requests), 0)
+	if len(requests) > 0 {
+		res.Reset = requests[0].Add(window).Sub(now)
+	}
+	if len(requests) == 0 {
+		delete(l.requests, key)
+	} else {
+		l.requests[key] = requests
+	}
+	return res, nil
+}
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type RoomStore struct {
+	mu    sync.RWMutex
+	rooms map[bson.ObjectID]types.Room
+
+	HotelStore db.HotelStore
+}
+
+func NewRoomStore(hotelStore db.HotelStore) *RoomStore {
+	return &RoomStore{
+		rooms:      map[bson.ObjectID]types.Room{},
+		HotelStore: hotelStore,
+	}
+}
+
+func (s *RoomStore) GetRooms(ctx context.Context, filter db.RoomFilter, pag *db.Pagination) ([]*types.Room, *db.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := []*types.Room{}
+	for _, room := range s.rooms {
+		if visible(ctx, room.DeletedAt) && matchRoom(&room, filter) {
+			rooms = append(rooms, &room)
+		}
+	}
+	id := func(r *types.Room) bson.ObjectID { return r.ID }
+	sortByID(rooms, id)
+	return paginate(rooms, pag, id)
+}
+
+func (s *RoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
+	s.mu.Lock()
+	if room.ID.IsZero() {
+		room.ID = bson.NewObjectID()
+	}
+	room.CreatedAt = time.Now()
+	room.UpdatedAt = room.CreatedAt
+	room.Version = 1
+	s.rooms[room.ID] = *room
+	s.mu.Unlock()
+
+	if err := s.HotelStore.UpdateHotelsRooms(ctx, room.HotelID, room.ID); err != nil {
+		s.mu.Lock()
+		delete(s.rooms, room.ID)
+		s.mu.Unlock()
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *RoomStore) InsertRooms(ctx context.Context, hotelID bson.ObjectID, rooms []*types.Room) ([]*types.Room, error) {
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+	now := time.Now()
+	ids := make([]bson.ObjectID, len(rooms))
+	s.mu.Lock()
+	for i, room := range rooms {
+		if room.ID.IsZero() {
+			room.ID = bson.NewObjectID()
+		}
+		room.HotelID = hotelID
+		room.CreatedAt = now
+		room.UpdatedAt = now
+		room.Version = 1
+		s.rooms[room.ID] = *room
+		ids[i] = room.ID
+	}
+	s.mu.Unlock()
+
+	if err := s.HotelStore.UpdateHotelsRooms(ctx, hotelID, ids...); err != nil {
+		s.mu.Lock()
+		for _, id := range ids {
+			delete(s.rooms, id)
+		}
+		s.mu.Unlock()
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *RoomStore) GetRoomByID(ctx context.Context, id string) (*types.Room, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[oid]
+	if !ok || !visible(ctx, room.DeletedAt) {
+		return nil, db.NotFound("room")
+	}
+	return &room, nil
+}
+
+func (s *RoomStore) UpdateRoom(ctx context.Context, id string, params types.UpdateRoomParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.rooms[oid]
+	if !ok || room.DeletedAt != nil {
+		return db.NotFound("room")
+	}
+	if version > 0 && room.Version != version {
+		return db.StaleVersion("room")
+	}
+	room.Version++
+	room.UpdatedAt = time.Now()
+	if params.Type != 0 {
+		room.Type = params.Type
+	}
+	if params.BasePrice > 0 {
+		room.BasePrice = params.BasePrice
+	}
+	if params.Price > 0 {
+		room.Price = params.Price
+	}
+	s.rooms[oid] = room
+	return nil
+}
+
+func (s *RoomStore) DeleteRoom(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	room, ok := s.rooms[oid]
+	if !ok || room.DeletedAt != nil {
+		s.mu.Unlock()
+		return db.NotFound("room")
+	}
+	now := time.Now()
+	room.DeletedAt = &now
+	room.UpdatedAt = now
+	room.Version++
+	s.rooms[oid] = room
+	s.mu.Unlock()
+
+	// A hotel that is already gone has nothing left to unlink.
+	if err := s.HotelStore.RemoveHotelRoom(ctx, room.HotelID, room.ID); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func matchRoom(room *types.Room, filter db.RoomFilter) bool {
+	if !filter.HotelID.IsZero() && room.HotelID != filter.HotelID {
+		return false
+	}
+	if filter.Type != 0 && room.Type != filter.Type {
+		return false
+	}
+	if filter.MinPrice > 0 && room.Price < filter.MinPrice {
+		return false
+	}
+	if filter.MaxPrice > 0 && room.Price > filter.MaxPrice {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type UserStore struct {
+	mu    sync.RWMutex
+	users map[bson.ObjectID]types.User
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users: map[bson.ObjectID]types.User{},
+	}
+}
+
+func (s *UserStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = map[bson.ObjectID]types.User{}
+	return nil
+}
+
+func (s *UserStore) GetUserByID(ctx context.Context, id string) (*types.User, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[oid]
+	if !ok || !visible(ctx, user.DeletedAt) {
+		return nil, db.NotFound("user")
+	}
+	return &user, nil
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if user.Email == email && visible(ctx, user.DeletedAt) {
+			return &user, nil
+		}
+	}
+	return nil, db.NotFound("user")
+}
+
+func (s *UserStore) GetUsers(ctx context.Context, pag *db.Pagination) ([]*types.User, *db.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]*types.User, 0, len(s.users))
+	for _, user := range s.users {
+		if visible(ctx, user.DeletedAt) {
+			users = append(users, &user)
+		}
+	}
+	id := func(u *types.User) bson.ObjectID { return u.ID }
+	sortByID(users, id)
+	return paginate(users, pag, id)
+}
+
+func (s *UserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return nil, fmt.Errorf("user %w", db.ErrDuplicate)
+		}
+	}
+	if user.ID.IsZero() {
+		user.ID = bson.NewObjectID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	s.users[user.ID] = *user
+	return user, nil
+}
+
+func (s *UserStore) DeleteUser(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[oid]
+	if !ok || user.DeletedAt != nil {
+		return db.NotFound("user")
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	user.Version++
+	s.users[oid] = user
+	return nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, id string, params types.UpdateUserParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[oid]
+	if !ok || user.DeletedAt != nil {
+		return db.NotFound("user")
+	}
+	if version > 0 && user.Version != version {
+		return db.StaleVersion("user")
+	}
+	user.Version++
+	user.UpdatedAt = time.Now()
+	if len(params.FirstName) > 0 {
+		user.FirstName = params.FirstName
+	}
+	if len(params.LastName) > 0 {
+		user.LastName = params.LastName
+	}
+	s.users[oid] = user
+	return nil
+}
@@ -0,0 +1,198 @@
+// Package migrate applies ordered, versioned schema migrations to the Mongo
+// database and records each applied version in the migrations collection.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const migrationColl = "migrations"
+
+// ErrIrreversible is returned by Down for a migration without a Down step.
+var ErrIrreversible = errors.New("migration cannot be reverted")
+
+// Migration changes existing documents from one shape to the next. Down may
+// be nil when the change cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(context.Context, *mongo.Database) error
+	Down    func(context.Context, *mongo.Database) error
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	coll       *mongo.Collection
+	migrations []Migration
+
+	// DryRun makes Up and Down report what they would do without touching
+	// any data or the migrations collection.
+	DryRun bool
+}
+
+func NewMigrator(database *mongo.Database, migrations []Migration) (*Migrator, error) {
+	if err := validate(migrations); err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         database,
+		coll:       database.Collection(migrationColl),
+		migrations: migrations,
+	}, nil
+}
+
+// validate makes sure versions are positive, unique and listed in order.
+func validate(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q: version must be positive", m.Name)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %s: missing Up", m)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %s: versions must be unique and ascending", m)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]record, error) {
+	cur, err := m.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		r, ok := applied[mig.Version]
+		statuses = append(statuses, Status{
+			Migration: mig,
+			Applied:   ok,
+			AppliedAt: r.AppliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied, oldest first.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies up to steps pending migrations (all of them when steps <= 0)
+// and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	if m.DryRun {
+		return pending, nil
+	}
+	var done []Migration
+	for _, mig := range pending {
+		if err := mig.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %s: %w", mig, err)
+		}
+		r := record{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}
+		if _, err := m.coll.InsertOne(ctx, r); err != nil {
+			return done, fmt.Errorf("migration %s: recording: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations (one when steps <= 0),
+// newest first, and returns the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, s := range statuses {
+		if s.Applied {
+			applied = append(applied, s.Migration)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Version > applied[j].Version })
+	if steps <= 0 {
+		steps = 1
+	}
+	if steps < len(applied) {
+		applied = applied[:steps]
+	}
+	for _, mig := range applied {
+		if mig.Down == nil {
+			return nil, fmt.Errorf("migration %s: %w", mig, ErrIrreversible)
+		}
+	}
+	if m.DryRun {
+		return applied, nil
+	}
+	var done []Migration
+	for _, mig := range applied {
+		if err := mig.Down(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %s: %w", mig, err)
+		}
+		if _, err := m.coll.DeleteOne(ctx, bson.M{"_id": mig.Version}); err != nil {
+			return done, fmt.Errorf("migration %s: recording: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestRegisteredMigrationsAreValid(t *testing.T) {
+	if err := validate(Migrations); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRejectsOutOfOrder(t *testing.T) {
+	noop := func(context.Context, *mongo.Database) error { return nil }
+	migrations := []Migration{
+		{Version: 2, Name: "second", Up: noop},
+		{Version: 1, Name: "first", Up: noop},
+	}
+	if err := validate(migrations); err == nil {
+		t.Fatal("expected out of order versions to be rejected")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	uri := os.Getenv("MONGO_DB_URL_TEST")
+	if uri == "" {
+		t.Skip("MONGO_DB_URL_TEST not set")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	database := client.Database(fmt.Sprintf("hotel_db_migrate_%d", time.Now().UnixNano()))
+	defer database.Drop(ctx)
+
+	var ran []string
+	step := func(name string) func(context.Context, *mongo.Database) error {
+		return func(context.Context, *mongo.Database) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	migrator, err := NewMigrator(database, []Migration{
+		{Version: 1, Name: "one", Up: step("up1"), Down: step("down1")},
+		{Version: 2, Name: "two", Up: step("up2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator.DryRun = true
+	planned, err := migrator.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 2 || len(ran) != 0 {
+		t.Fatalf("expected a dry run to plan 2 migrations and run none, planned %d ran %v", len(planned), ran)
+	}
+
+	migrator.DryRun = false
+	if _, err := migrator.Up(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("expected only version 2 pending but got %v", pending)
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Down(ctx, 1); err == nil {
+		t.Fatal("expected reverting an irreversible migration to fail")
+	}
+	if _, err := database.Collection(migrationColl).DeleteOne(ctx, bson.M{"_id": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"up1", "up2", "down1"}
+	if fmt.Sprint(ran) != fmt.Sprint(want) {
+		t.Errorf("expected steps %v but got %v", want, ran)
+	}
+}
@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/raminfathi/GoTel/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Migrations lists every migration in version order. New migrations are
+// appended here with the next version number; released ones never change.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "booking_canceled_default",
+		Up:      bookingCanceledDefault,
+	},
+	{
+		Version: 2,
+		Name:    "backfill_room_nights",
+		Up:      backfillRoomNights,
+		Down:    dropRoomNights,
+	},
+	{
+		Version: 3,
+		Name:    "version_default",
+		Up:      versionDefault,
+	},
+	{
+		Version: 4,
+		Name:    "audit_timestamps",
+		Up:      auditTimestamps,
+	},
+}
+
+// bookingCanceledDefault sets canceled=false on bookings written before the
+// field existed; the availability query only matches an explicit false.
+func bookingCanceledDefault(ctx context.Context, database *mongo.Database) error {
+	_, err := database.Collection("bookings").UpdateMany(ctx,
+		bson.M{"canceled": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"canceled": false}},
+	)
+	return err
+}
+
+// versionDefault starts hotels, rooms and users written before versioning
+// at version 1, so If-Match checks can match them.
+func versionDefault(ctx context.Context, database *mongo.Database) error {
+	for _, coll := range []string{"hotels", "rooms", "users"} {
+		_, err := database.Collection(coll).UpdateMany(ctx,
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditTimestamps gives records written before audit timestamps existed a
+// createdAt taken from their ObjectID, and an updatedAt equal to it.
+func auditTimestamps(ctx context.Context, database *mongo.Database) error {
+	for _, coll := range []string{"hotels", "rooms", "bookings", "users"} {
+		_, err := database.Collection(coll).UpdateMany(ctx,
+			bson.M{"updatedAt": bson.M{"$exists": false}},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"createdAt": bson.M{"$ifNull": bson.A{"$createdAt", bson.M{"$toDate": "$_id"}}}}}},
+				{{Key: "$set", Value: bson.M{"updatedAt": "$createdAt"}}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillRoomNights claims ledger nights for bookings made before the
+// room-night ledger existed. Nights already claimed are left alone.
+func backfillRoomNights(ctx context.Context, database *mongo.Database) error {
+	cur, err := database.Collection("bookings").Find(ctx, bson.M{"canceled": false})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	nights := database.Collection("roomNights")
+	for cur.Next(ctx) {
+		var booking struct {
+			ID       bson.ObjectID `bson:"_id"`
+			RoomID   bson.ObjectID `bson:"roomID"`
+			FromDate bson.DateTime `bson:"fromDate"`
+			TillDate bson.DateTime `bson:"tillDate"`
+		}
+		if err := cur.Decode(&booking); err != nil {
+			return err
+		}
+		var docs []bson.M
+		for _, night := range db.BookingNights(booking.FromDate.Time(), booking.TillDate.Time()) {
+			docs = append(docs, bson.M{
+				"roomID":    booking.RoomID,
+				"date":      night,
+				"bookingID": booking.ID,
+			})
+		}
+		_, err := nights.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// dropRoomNights empties the ledger. It only holds data derived from
+// bookings, so running Up again rebuilds it.
+func dropRoomNights(ctx context.Context, database *mongo.Database) error {
+	_, err := database.Collection("roomNights").DeleteMany(ctx, bson.M{})
+	return err
+}
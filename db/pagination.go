@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+)
+
+// Pagination selects a window of a listing. A non-empty Cursor takes
+// precedence over Page and continues right after the item it was issued for.
+// List methods given a nil *Pagination return every match.
+type Pagination struct {
+	Limit  int64  `query:"limit" json:"limit"`
+	Page   int64  `query:"page" json:"page"`
+	Cursor string `query:"cursor" json:"cursor"`
+}
+
+// Bounds returns the effective limit and page, applying defaults and caps.
+func (p *Pagination) Bounds() (limit, page int64) {
+	limit, page = p.Limit, p.Page
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	if page <= 0 {
+		page = 1
+	}
+	return limit, page
+}
+
+// PageInfo describes the window a list method returned. Page is zero when
+// the window was selected by cursor, and NextCursor is empty on the last page.
+type PageInfo struct {
+	Total      int64
+	Page       int64
+	Limit      int64
+	NextCursor string
+}
+
+// EncodeCursor returns the opaque cursor that continues after id.
+func EncodeCursor(id bson.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+func DecodeCursor(cursor string) (bson.ObjectID, error) {
+	var id bson.ObjectID
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != len(id) {
+		return id, ErrInvalidCursor
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// findPage runs a paginated find ordered by _id, which keeps page and
+// cursor navigation consistent with each other.
+func findPage[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, pag *Pagination, id func(*T) bson.ObjectID) ([]*T, *PageInfo, error) {
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &PageInfo{Total: total}
+
+	query := filter
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if pag != nil {
+		limit, page := pag.Bounds()
+		info.Limit = limit
+		if pag.Cursor != "" {
+			after, err := DecodeCursor(pag.Cursor)
+			if err != nil {
+				return nil, nil, err
+			}
+			query = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": after}}}}
+		} else {
+			info.Page = page
+			opts.SetSkip((page - 1) * limit)
+		}
+		// One extra document tells us whether there is a next page.
+		opts.SetLimit(limit + 1)
+	}
+
+	cur, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := []*T{}
+	if err := cur.All(ctx, &items); err != nil {
+		return nil, nil, err
+	}
+	if pag != nil && int64(len(items)) > info.Limit {
+		items = items[:info.Limit]
+		info.NextCursor = EncodeCursor(id(items[len(items)-1]))
+	}
+	return items, info, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RateLimitResult is the outcome of counting a request against a limit.
+// Remaining is how many more requests the window allows; Reset is how long
+// until the oldest request counted leaves the window, freeing a slot.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	Reset     time.Duration
+}
+
+// RateLimiter counts requests per key over a sliding window.
+type RateLimiter interface {
+	// Allow counts a request under key if fewer than limit were counted
+	// in the last window, and reports the state of the window.
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RedisRateLimiter keeps its counters in Redis. Its calls go through
+// breaker, which may be nil, and fail with ErrCacheBreakerOpen at once
+// while it is open.
+type RedisRateLimiter struct {
+	client  *redis.Client
+	breaker *CacheBreaker
+}
+
+func NewRedisRateLimiter(client *redis.Client, breaker *CacheBreaker) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+// slidingWindowScript keeps the times of the requests in the window in a
+// sorted set. It drops those that left the window, adds the new request
+// if there is room, and returns whether it did, the room left and the
+// milliseconds until the oldest request leaves.
+var slidingWindowScript = redis.NewScript(`
+local now, window, limit = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, math.max(limit - count, 0), reset}
+`)
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now().UnixMilli()
+	// Requests in the same millisecond each need their own member.
+	member := strconv.FormatInt(now, 10) + "-" + bson.NewObjectID().Hex()
+	var res []int64
+	skipped, err := l.breaker.call(ctx, false, func(ctx context.Context) (err error) {
+		res, err = slidingWindowScript.Run(ctx, l.client, []string{key}, now, window.Milliseconds(), limit, member).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if skipped {
+		return RateLimitResult{}, ErrCacheBreakerOpen
+	}
+	return RateLimitResult{
+		Allowed:   res[0] == 1,
+		Remaining: int(res[1]),
+		Reset:     time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
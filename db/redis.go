@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -9,8 +10,28 @@ import (
 
 type CacheStore interface {
 	Get(context.Context, string) (string, error)
+	// GetMany returns the values of keys in order, with "" for misses.
+	GetMany(context.Context, ...string) ([]string, error)
 	Set(context.Context, string, interface{}, time.Duration) error
+	// SetWithTags sets a key like Set and files it under each tag, so that
+	// DeleteTags removes it.
+	SetWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) error
+	// Delete removes the keys; missing keys are not an error.
+	Delete(context.Context, ...string) error
+	// DeleteTags removes every key filed under any of the tags and returns
+	// the keys it removed.
+	DeleteTags(context.Context, ...string) ([]string, error)
+	// DeletePrefix removes every key starting with prefix.
+	DeletePrefix(context.Context, string) error
+	// CountPrefix returns how many keys start with prefix.
+	CountPrefix(context.Context, string) (int64, error)
+	// IncrRank adds one to the score of member in a ranking, which is
+	// kept until deleted.
+	IncrRank(ctx context.Context, ranking, member string) error
+	// TopRanked returns up to n members of a ranking, highest score first.
+	TopRanked(ctx context.Context, ranking string, n int) ([]string, error)
 }
+
 type RedisCacheStore struct {
 	client *redis.Client
 }
@@ -22,10 +43,34 @@ func NewRedisCacheStore(client *redis.Client) *RedisCacheStore {
 
 }
 
+// tagKey is the set holding the keys filed under tag.
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
 func (c *RedisCacheStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return c.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetWithTags keeps each tag set at least as long as the keys in it, so a
+// tag never forgets a key that is still cached.
+func (c *RedisCacheStore) SetWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) error {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, expiration)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), key)
+			if expiration > 0 {
+				pipe.ExpireNX(ctx, tagKey(tag), expiration)
+				pipe.ExpireGT(ctx, tagKey(tag), expiration)
+			} else {
+				pipe.Persist(ctx, tagKey(tag))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
 func (c *RedisCacheStore) Get(ctx context.Context, key string) (string, error) {
 	val, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -35,3 +80,126 @@ func (c *RedisCacheStore) Get(ctx context.Context, key string) (string, error) {
 	}
 	return val, nil
 }
+
+// getWithTTL returns the values of keys with the time each has left, or a
+// negative duration for keys that do not expire, in one round trip.
+func (c *RedisCacheStore) getWithTTL(ctx context.Context, keys ...string) ([]string, []time.Duration, error) {
+	values := make([]string, len(keys))
+	ttls := make([]time.Duration, len(keys))
+	if len(keys) == 0 {
+		return values, ttls, nil
+	}
+	var (
+		get  *redis.SliceCmd
+		pttl = make([]*redis.DurationCmd, len(keys))
+	)
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.MGet(ctx, keys...)
+		for i, key := range keys {
+			pttl[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, val := range get.Val() {
+		values[i], _ = val.(string)
+		ttls[i] = pttl[i].Val()
+	}
+	return values, ttls, nil
+}
+
+func (c *RedisCacheStore) GetMany(ctx context.Context, keys ...string) ([]string, error) {
+	if len(keys) == 0 {
+		return []string{}, nil
+	}
+	vals, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(vals))
+	for i, val := range vals {
+		values[i], _ = val.(string)
+	}
+	return values, nil
+}
+
+func (c *RedisCacheStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
+
+// deleteTagScript removes the keys in a tag set and the set itself in one
+// step, so a key filed in between is not left behind. It returns the keys
+// that were still there to remove.
+var deleteTagScript = redis.NewScript(`
+local deleted = {}
+for _, key in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	if redis.call('DEL', key) == 1 then
+		deleted[#deleted + 1] = key
+	end
+end
+redis.call('DEL', KEYS[1])
+return deleted
+`)
+
+func (c *RedisCacheStore) DeleteTags(ctx context.Context, tags ...string) ([]string, error) {
+	deleted := []string{}
+	for _, tag := range tags {
+		keys, err := deleteTagScript.Run(ctx, c.client, []string{tagKey(tag)}).StringSlice()
+		if err != nil && err != redis.Nil {
+			return deleted, err
+		}
+		deleted = append(deleted, keys...)
+	}
+	return deleted, nil
+}
+
+// globEscaper quotes the characters SCAN MATCH treats as a pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (c *RedisCacheStore) DeletePrefix(ctx context.Context, prefix string) error {
+	iter := c.scanPrefix(ctx, prefix)
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 500 {
+			if err := c.Delete(ctx, keys...); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return c.Delete(ctx, keys...)
+}
+
+func (c *RedisCacheStore) scanPrefix(ctx context.Context, prefix string) *redis.ScanIterator {
+	return c.client.Scan(ctx, 0, globEscaper.Replace(prefix)+"*", 500).Iterator()
+}
+
+// CountPrefix walks the keyspace, so it is meant for occasional use.
+func (c *RedisCacheStore) CountPrefix(ctx context.Context, prefix string) (int64, error) {
+	iter := c.scanPrefix(ctx, prefix)
+	var n int64
+	for iter.Next(ctx) {
+		n++
+	}
+	return n, iter.Err()
+}
+
+func (c *RedisCacheStore) IncrRank(ctx context.Context, ranking, member string) error {
+	return c.client.ZIncrBy(ctx, ranking, 1, member).Err()
+}
+
+func (c *RedisCacheStore) TopRanked(ctx context.Context, ranking string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	return c.client.ZRevRange(ctx, ranking, 0, int64(n-1)).Result()
+}
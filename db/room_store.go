@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"errors"
 	"os"
+	"time"
 
 	"github.com/raminfathi/GoTel/types"
 
@@ -12,7 +14,26 @@ import (
 
 type RoomStore interface {
 	InsertRoom(context.Context, *types.Room) (*types.Room, error)
-	GetRooms(context.Context, bson.M) ([]*types.Room, error)
+	// InsertRooms adds rooms to one hotel as a batch, updating the hotel
+	// once rather than per room. It sets each room's HotelID.
+	InsertRooms(ctx context.Context, hotelID bson.ObjectID, rooms []*types.Room) ([]*types.Room, error)
+	GetRooms(context.Context, RoomFilter, *Pagination) ([]*types.Room, *PageInfo, error)
+	GetRoomByID(context.Context, string) (*types.Room, error)
+	// UpdateRoom changes the given fields of a room. version is the version
+	// the caller read, or 0 to update unconditionally.
+	UpdateRoom(ctx context.Context, id string, params types.UpdateRoomParams, version int64) error
+	// DeleteRoom soft-deletes the room and takes it off its hotel's Rooms. It does
+	// not look at bookings; callers must check for upcoming ones first.
+	DeleteRoom(context.Context, string) error
+}
+
+// RoomFilter selects rooms. Zero fields match every room; the price range
+// applies to the current price and both bounds are inclusive.
+type RoomFilter struct {
+	HotelID  bson.ObjectID
+	Type     types.RoomType
+	MinPrice float64
+	MaxPrice float64
 }
 
 type MongoRoomStore struct {
@@ -34,19 +55,47 @@ func NewMongoRoomStore(client *mongo.Client, HotelStore HotelStore) *MongoRoomSt
 		HotelStore: HotelStore,
 	}
 }
-func (s *MongoRoomStore) GetRooms(ctx context.Context, filter bson.M) ([]*types.Room, error) {
-	resp, err := s.coll.Find(ctx, filter)
-	if err != nil {
-		return nil, err
+
+// Indexes declares the indexes the rooms collection needs.
+func (s *MongoRoomStore) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hotelID", Value: 1}}},
 	}
-	var rooms []*types.Room
-	if err := resp.All(ctx, &rooms); err != nil {
-		return nil, err
+}
+
+func (s *MongoRoomStore) EnsureIndexes(ctx context.Context) error {
+	return ensureIndexes(ctx, s.coll, s.Indexes())
+}
+
+func (s *MongoRoomStore) GetRooms(ctx context.Context, filter RoomFilter, pag *Pagination) ([]*types.Room, *PageInfo, error) {
+	return findPage(ctx, s.coll, notDeleted(ctx, roomFilterToBSON(filter)), pag, func(r *types.Room) bson.ObjectID { return r.ID })
+}
+
+func roomFilterToBSON(f RoomFilter) bson.M {
+	filter := bson.M{}
+	if !f.HotelID.IsZero() {
+		filter["hotelID"] = f.HotelID
 	}
-	return rooms, nil
+	if f.Type != 0 {
+		filter["type"] = f.Type
+	}
+	price := bson.M{}
+	if f.MinPrice > 0 {
+		price["$gte"] = f.MinPrice
+	}
+	if f.MaxPrice > 0 {
+		price["$lte"] = f.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+	return filter
 }
 func (s *MongoRoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
 	// 1. اتاق رو اینسرت کن
+	room.CreatedAt = time.Now()
+	room.UpdatedAt = room.CreatedAt
+	room.Version = 1
 	resp, err := s.coll.InsertOne(ctx, room)
 	if err != nil {
 		return nil, err
@@ -54,8 +103,84 @@ func (s *MongoRoomStore) InsertRoom(ctx context.Context, room *types.Room) (*typ
 	room.ID = resp.InsertedID.(bson.ObjectID)
 
 	if err := s.HotelStore.UpdateHotelsRooms(ctx, room.HotelID, room.ID); err != nil {
+		// Don't leave a room behind that no hotel refers to.
+		s.coll.DeleteOne(ctx, bson.M{"_id": room.ID})
 		return nil, err
 	}
 
 	return room, nil
 }
+
+func (s *MongoRoomStore) InsertRooms(ctx context.Context, hotelID bson.ObjectID, rooms []*types.Room) ([]*types.Room, error) {
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+	now := time.Now()
+	docs := make([]any, len(rooms))
+	ids := make([]bson.ObjectID, len(rooms))
+	for i, room := range rooms {
+		if room.ID.IsZero() {
+			room.ID = bson.NewObjectID()
+		}
+		room.HotelID = hotelID
+		room.CreatedAt = now
+		room.UpdatedAt = now
+		room.Version = 1
+		docs[i] = room
+		ids[i] = room.ID
+	}
+	if _, err := s.coll.InsertMany(ctx, docs); err != nil {
+		s.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		return nil, err
+	}
+	if err := s.HotelStore.UpdateHotelsRooms(ctx, hotelID, ids...); err != nil {
+		s.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *MongoRoomStore) GetRoomByID(ctx context.Context, id string) (*types.Room, error) {
+	oid, err := ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var room types.Room
+	if err := s.coll.FindOne(ctx, notDeleted(ctx, bson.M{"_id": oid})).Decode(&room); err != nil {
+		return nil, mongoErr("room", err)
+	}
+	return &room, nil
+}
+
+func (s *MongoRoomStore) UpdateRoom(ctx context.Context, id string, params types.UpdateRoomParams, version int64) error {
+	oid, err := ParseID(id)
+	if err != nil {
+		return err
+	}
+	set := bson.M{}
+	if params.Type != 0 {
+		set["type"] = params.Type
+	}
+	if params.BasePrice > 0 {
+		set["basePrice"] = params.BasePrice
+	}
+	if params.Price > 0 {
+		set["price"] = params.Price
+	}
+	return versionedUpdate(ctx, s.coll, "room", oid, version, bson.M{"$set": set})
+}
+
+func (s *MongoRoomStore) DeleteRoom(ctx context.Context, id string) error {
+	room, err := s.GetRoomByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := softDelete(ctx, s.coll, "room", room.ID); err != nil {
+		return err
+	}
+	// A hotel that is already gone has nothing left to unlink.
+	if err := s.HotelStore.RemoveHotelRoom(ctx, room.HotelID, room.ID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
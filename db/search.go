@@ -0,0 +1,174 @@
+package db
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Near and text searches order hotels by distance or relevance rather than
+// by id, so they page by number only. They cannot be combined, as Mongo
+// serves them from different indexes.
+
+var (
+	errRankedCursor = fmt.Errorf("near and text searches page by number: %w", ErrInvalidCursor)
+	errNearAndQuery = errors.New("near and text searches cannot be combined")
+)
+
+func checkRankedSearch(filter HotelFilter, pag *Pagination) error {
+	if filter.Near != nil && filter.Query != "" {
+		return errNearAndQuery
+	}
+	if (filter.Near != nil || filter.Query != "") && pag != nil && pag.Cursor != "" {
+		return errRankedCursor
+	}
+	return nil
+}
+
+// textFields are the fields a text search looks at, with their weights. A
+// term in the name counts for more than one in the location, and both for
+// more than one in the description.
+var textFields = []struct {
+	key    string
+	weight int
+	text   func(*types.Hotel) string
+}{
+	{"name", 10, func(h *types.Hotel) string { return h.Name }},
+	{"location", 5, func(h *types.Hotel) string { return h.Location }},
+	{"description", 1, func(h *types.Hotel) string { return h.Description }},
+}
+
+// textIndex is the Mongo text index behind HotelFilter.Query. Its language
+// is "none" so that, like the other backends, it neither stems words nor
+// drops stop words.
+func textIndex() mongo.IndexModel {
+	var keys, weights bson.D
+	for _, field := range textFields {
+		keys = append(keys, bson.E{Key: field.key, Value: "text"})
+		weights = append(weights, bson.E{Key: field.key, Value: field.weight})
+	}
+	return mongo.IndexModel{
+		Keys: keys,
+		Options: options.Index().
+			SetName("hotels_text").
+			SetWeights(weights).
+			SetDefaultLanguage("none"),
+	}
+}
+
+// SearchTerms splits a text query into the distinct lower-case words it
+// searches for. Everything but letters and digits separates words.
+func SearchTerms(query string) []string {
+	terms := words(query)
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textSearchPage runs a $text search, best match first, with the relevance
+// filled in as Score.
+func textSearchPage(ctx context.Context, coll *mongo.Collection, filter bson.M, pag *Pagination) ([]*types.Hotel, *PageInfo, error) {
+	info := &PageInfo{}
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	info.Total = total
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}})
+	if pag != nil {
+		limit, page := pag.Bounds()
+		info.Limit, info.Page = limit, page
+		opts.SetSkip((page - 1) * limit).SetLimit(limit)
+	}
+	cur, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	hotels := []*types.Hotel{}
+	if err := cur.All(ctx, &hotels); err != nil {
+		return nil, nil, err
+	}
+	return hotels, info, nil
+}
+
+// RankHotels runs a near or text search in Go, for backends without the
+// indexes Mongo uses. hotels must already match the rest of the filter.
+func RankHotels(hotels []*types.Hotel, filter HotelFilter, pag *Pagination) ([]*types.Hotel, *PageInfo, error) {
+	if err := checkRankedSearch(filter, pag); err != nil {
+		return nil, nil, err
+	}
+	found := hotels
+	switch {
+	case filter.Near != nil:
+		found = nearest(hotels, filter.Near, filter.Radius)
+	case filter.Query != "":
+		found = relevant(hotels, SearchTerms(filter.Query))
+	}
+	info := &PageInfo{Total: int64(len(found))}
+	if pag == nil {
+		return found, info, nil
+	}
+	limit, page := pag.Bounds()
+	info.Limit, info.Page = limit, page
+	start := int(min((page-1)*limit, int64(len(found))))
+	end := min(start+int(limit), len(found))
+	return found[start:end], info, nil
+}
+
+// relevant keeps the hotels matching any of terms, best match first, with
+// their Score set.
+func relevant(hotels []*types.Hotel, terms []string) []*types.Hotel {
+	found := []*types.Hotel{}
+	for _, hotel := range hotels {
+		score := textScore(hotel, terms)
+		if score == 0 {
+			continue
+		}
+		hotel.Score = &score
+		found = append(found, hotel)
+	}
+	slices.SortFunc(found, func(a, b *types.Hotel) int {
+		return cmp.Or(cmp.Compare(*b.Score, *a.Score), bytes.Compare(a.ID[:], b.ID[:]))
+	})
+	return found
+}
+
+// textScore approximates Mongo's text score: each term found in a field
+// adds the field's weight, scaled up a little by how much of the field the
+// term makes up.
+func textScore(hotel *types.Hotel, terms []string) float64 {
+	var score float64
+	for _, field := range textFields {
+		fieldWords := words(field.text(hotel))
+		for _, term := range terms {
+			n := 0
+			for _, word := range fieldWords {
+				if word == term {
+					n++
+				}
+			}
+			if n > 0 {
+				score += float64(field.weight) * (0.5 + 0.5*float64(n)/float64(len(fieldWords)))
+			}
+		}
+	}
+	return score
+}
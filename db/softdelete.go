@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Deleting a user, hotel or room only sets its DeletedAt. Get and list
+// methods skip deleted records unless the context comes from WithDeleted,
+// and updates treat them as missing.
+
+type includeDeletedKey struct{}
+
+// WithDeleted returns a context under which get and list methods also
+// return soft-deleted records. It is meant for admin views.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// IncludesDeleted reports whether ctx came from WithDeleted.
+func IncludesDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
+}
+
+// notDeleted adds the soft-delete condition to filter unless ctx asks for
+// deleted records. A nil deletedAt also matches documents without one.
+func notDeleted(ctx context.Context, filter bson.M) bson.M {
+	if !IncludesDeleted(ctx) {
+		filter["deletedAt"] = nil
+	}
+	return filter
+}
+
+// softDelete marks the document deleted, which counts as a write.
+func softDelete(ctx context.Context, coll *mongo.Collection, resource string, oid bson.ObjectID) error {
+	return versionedUpdate(ctx, coll, resource, oid, 0, bson.M{"$set": bson.M{"deletedAt": time.Now()}})
+}
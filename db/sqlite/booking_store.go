@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const bookingColumns = "id, user_id, room_id, num_persons, from_date, till_date, canceled, created_at, updated_at, deleted_at"
+
+type BookingStore struct {
+	conn *sql.DB
+}
+
+func NewBookingStore(conn *sql.DB) *BookingStore {
+	return &BookingStore{
+		conn: conn,
+	}
+}
+
+func scanBooking(row scanner) (*types.Booking, error) {
+	var booking types.Booking
+	err := row.Scan(
+		objectID{&booking.ID},
+		objectID{&booking.UserID},
+		objectID{&booking.RoomID},
+		&booking.NumPersons,
+		unixTime{&booking.FromDate},
+		unixTime{&booking.TillDate},
+		&booking.Canceled,
+		unixTime{&booking.CreatedAt},
+		unixTime{&booking.UpdatedAt},
+		optionalTime{&booking.DeletedAt},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// InsertBooking checks for an overlapping booking and inserts the new one in
+// the same transaction. Transactions begin IMMEDIATE, taking the write lock
+// up front, so two bookings cannot both pass the check.
+func (s *BookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	if booking.ID.IsZero() {
+		booking.ID = bson.NewObjectID()
+	}
+	booking.CreatedAt = time.Now()
+	booking.UpdatedAt = booking.CreatedAt
+	nights := db.BookingNights(booking.FromDate, booking.TillDate)
+	firstNight := nights[0]
+	endNight := nights[len(nights)-1].AddDate(0, 0, 1)
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if !booking.Canceled {
+		var taken bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM bookings
+				WHERE room_id = ? AND canceled = 0 AND first_night < ? AND end_night > ?
+			)`,
+			booking.RoomID.Hex(), endNight.UnixNano(), firstNight.UnixNano(),
+		).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, db.ErrConflict
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO bookings ("+bookingColumns+", first_night, end_night) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, ?)",
+		booking.ID.Hex(), booking.UserID.Hex(), booking.RoomID.Hex(), booking.NumPersons,
+		booking.FromDate.UnixNano(), booking.TillDate.UnixNano(), booking.Canceled,
+		toUnix(booking.CreatedAt), toUnix(booking.UpdatedAt),
+		firstNight.UnixNano(), endNight.UnixNano(),
+	)
+	if err != nil {
+		return nil, sqliteErr("booking", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+func (s *BookingStore) GetBookingByID(ctx context.Context, id string) (*types.Booking, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var w where
+	w.add("id = ?", oid.Hex())
+	notDeleted(ctx, &w)
+	row := s.conn.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings"+w.String(), w.args...)
+	booking, err := scanBooking(row)
+	return booking, sqliteErr("booking", err)
+}
+
+func (s *BookingStore) GetBookings(ctx context.Context, filter db.BookingFilter, pag *db.Pagination) ([]*types.Booking, *db.PageInfo, error) {
+	var w where
+	notDeleted(ctx, &w)
+	if !filter.UserID.IsZero() {
+		w.add("user_id = ?", filter.UserID.Hex())
+	}
+	if !filter.RoomID.IsZero() {
+		w.add("room_id = ?", filter.RoomID.Hex())
+	}
+	if !filter.HotelID.IsZero() {
+		w.add("room_id IN (SELECT id FROM rooms WHERE hotel_id = ?)", filter.HotelID.Hex())
+	}
+	if !filter.From.IsZero() {
+		w.add("till_date > ?", filter.From.UnixNano())
+	}
+	if !filter.Till.IsZero() {
+		w.add("from_date < ?", filter.Till.UnixNano())
+	}
+	switch filter.Status {
+	case db.BookingStatusActive:
+		w.add("canceled = 0")
+	case db.BookingStatusCanceled:
+		w.add("canceled = 1")
+	}
+	return selectPage(ctx, s.conn, "bookings", bookingColumns, w, pag, scanBooking, func(b *types.Booking) bson.ObjectID { return b.ID })
+}
+
+func (s *BookingStore) CancelBooking(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := s.conn.ExecContext(ctx, "UPDATE bookings SET canceled = 1, updated_at = ? WHERE id = ?", time.Now().UnixNano(), oid.Hex())
+	return affected(res, err, "booking")
+}
+
+func (s *BookingStore) IsRoomAvailable(ctx context.Context, roomID bson.ObjectID, from, till time.Time) (bool, error) {
+	var taken bool
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM bookings
+			WHERE room_id = ? AND canceled = 0 AND from_date < ? AND till_date > ?
+		)`,
+		roomID.Hex(), till.UnixNano(), from.UnixNano(),
+	).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+	return !taken, nil
+}
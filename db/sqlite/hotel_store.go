@@ -0,0 +1,329 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const hotelColumns = "id, name, location, rating, version, created_at, updated_at, deleted_at, lat, lng, description"
+
+type HotelStore struct {
+	conn *sql.DB
+}
+
+func NewHotelStore(conn *sql.DB) *HotelStore {
+	return &HotelStore{
+		conn: conn,
+	}
+}
+
+func scanHotel(row scanner) (*types.Hotel, error) {
+	hotel := types.Hotel{Rooms: []bson.ObjectID{}}
+	var lat, lng sql.NullFloat64
+	if err := row.Scan(
+		objectID{&hotel.ID},
+		&hotel.Name,
+		&hotel.Location,
+		&hotel.Rating,
+		&hotel.Version,
+		unixTime{&hotel.CreatedAt},
+		unixTime{&hotel.UpdatedAt},
+		optionalTime{&hotel.DeletedAt},
+		&lat,
+		&lng,
+		&hotel.Description,
+	); err != nil {
+		return nil, err
+	}
+	if lat.Valid && lng.Valid {
+		hotel.Coordinates = types.NewGeoPoint(lat.Float64, lng.Float64)
+	}
+	return &hotel, nil
+}
+
+func (s *HotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	if hotel.ID.IsZero() {
+		hotel.ID = bson.NewObjectID()
+	}
+	hotel.CreatedAt = time.Now()
+	hotel.UpdatedAt = hotel.CreatedAt
+	hotel.Version = 1
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var lat, lng any
+	if hotel.Coordinates != nil {
+		lat, lng = hotel.Coordinates.Lat(), hotel.Coordinates.Lng()
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO hotels ("+hotelColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, NULL, ?, ?, ?)",
+		hotel.ID.Hex(), hotel.Name, hotel.Location, hotel.Rating, hotel.Version,
+		toUnix(hotel.CreatedAt), toUnix(hotel.UpdatedAt), lat, lng, hotel.Description,
+	)
+	if err != nil {
+		return nil, sqliteErr("hotel", err)
+	}
+	for _, roomID := range hotel.Rooms {
+		_, err := tx.ExecContext(ctx,
+			"INSERT OR IGNORE INTO hotel_rooms (hotel_id, room_id) VALUES (?, ?)",
+			hotel.ID.Hex(), roomID.Hex(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return hotel, nil
+}
+
+func (s *HotelStore) UpdateHotel(ctx context.Context, id string, params types.UpdateHotelParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	return versionedUpdate(ctx, s.conn, "hotel", `
+		name = COALESCE(NULLIF(?, ''), name),
+		location = COALESCE(NULLIF(?, ''), location),
+		description = COALESCE(NULLIF(?, ''), description)`,
+		oid, version, params.Name, params.Location, params.Description,
+	)
+}
+
+func (s *HotelStore) GetHotels(ctx context.Context, filter db.HotelFilter, pag *db.Pagination) ([]*types.Hotel, *db.PageInfo, error) {
+	var w where
+	notDeleted(ctx, &w)
+	if filter.Rating > 0 {
+		w.add("rating = ?", filter.Rating)
+	}
+	if filter.Location != "" {
+		// LIKE is case-insensitive for ASCII, like the Mongo regex filter.
+		w.add(`location LIKE ? ESCAPE '\'`, "%"+escapeLike(filter.Location)+"%")
+	}
+	if filter.Near != nil || filter.Query != "" {
+		return s.getRankedHotels(ctx, w, filter, pag)
+	}
+	hotels, info, err := selectPage(ctx, s.conn, "hotels", hotelColumns, w, pag, scanHotel, func(h *types.Hotel) bson.ObjectID { return h.ID })
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.loadRooms(ctx, hotels...); err != nil {
+		return nil, nil, err
+	}
+	return hotels, info, nil
+}
+
+// getRankedHotels narrows the candidates of a near or text search in SQL
+// and leaves the ranking to db.RankHotels. Near searches look in a bounding
+// box around the point, on the (lat, lng) index; text searches look for
+// rows containing any of the terms.
+func (s *HotelStore) getRankedHotels(ctx context.Context, w where, filter db.HotelFilter, pag *db.Pagination) ([]*types.Hotel, *db.PageInfo, error) {
+	if filter.Query != "" {
+		var conds []string
+		var args []any
+		for _, term := range db.SearchTerms(filter.Query) {
+			pattern := "%" + escapeLike(term) + "%"
+			conds = append(conds, `name LIKE ? ESCAPE '\' OR location LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\'`)
+			args = append(args, pattern, pattern, pattern)
+		}
+		if len(conds) == 0 {
+			conds = append(conds, "0")
+		}
+		w.add("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	if filter.Near != nil {
+		w.add("lat IS NOT NULL AND lng IS NOT NULL")
+	}
+	if filter.Near != nil && filter.Radius > 0 {
+		lat, lng := filter.Near.Lat(), filter.Near.Lng()
+		dLat := filter.Radius / db.EarthRadius * 180 / math.Pi
+		// Close to a pole, or across the antimeridian, the box would wrap,
+		// so only latitude is bounded there.
+		if lat-dLat > -90 && lat+dLat < 90 {
+			w.add("lat BETWEEN ? AND ?", lat-dLat, lat+dLat)
+			dLng := dLat / math.Cos(lat*math.Pi/180)
+			if lng-dLng > -180 && lng+dLng < 180 {
+				w.add("lng BETWEEN ? AND ?", lng-dLng, lng+dLng)
+			}
+		} else {
+			w.add("lat >= ?", max(lat-dLat, -90))
+			w.add("lat <= ?", min(lat+dLat, 90))
+		}
+	}
+	candidates, _, err := selectPage(ctx, s.conn, "hotels", hotelColumns, w, nil, scanHotel, func(h *types.Hotel) bson.ObjectID { return h.ID })
+	if err != nil {
+		return nil, nil, err
+	}
+	hotels, info, err := db.RankHotels(candidates, filter, pag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.loadRooms(ctx, hotels...); err != nil {
+		return nil, nil, err
+	}
+	return hotels, info, nil
+}
+
+func (s *HotelStore) GetHotelByID(ctx context.Context, id string) (*types.Hotel, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var w where
+	w.add("id = ?", oid.Hex())
+	notDeleted(ctx, &w)
+	row := s.conn.QueryRowContext(ctx, "SELECT "+hotelColumns+" FROM hotels"+w.String(), w.args...)
+	hotel, err := scanHotel(row)
+	if err != nil {
+		return nil, sqliteErr("hotel", err)
+	}
+	if err := s.loadRooms(ctx, hotel); err != nil {
+		return nil, err
+	}
+	return hotel, nil
+}
+
+func (s *HotelStore) UpdateHotelsRooms(ctx context.Context, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := addHotelRooms(ctx, tx, hotelID, roomIDs...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addHotelRooms appends roomIDs to the hotel's room list, which counts as a
+// single write to the hotel.
+func addHotelRooms(ctx context.Context, tx *sql.Tx, hotelID bson.ObjectID, roomIDs ...bson.ObjectID) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM hotels WHERE id = ? AND deleted_at IS NULL)", hotelID.Hex()).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return db.NotFound("hotel")
+	}
+	for _, roomID := range roomIDs {
+		_, err = tx.ExecContext(ctx,
+			"INSERT OR IGNORE INTO hotel_rooms (hotel_id, room_id) VALUES (?, ?)",
+			hotelID.Hex(), roomID.Hex(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE hotels SET version = version + 1, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now().UnixNano(), hotelID.Hex(),
+	)
+	return err
+}
+
+func (s *HotelStore) DeleteHotel(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	return softDelete(ctx, s.conn, "hotel", oid)
+}
+
+func (s *HotelStore) RemoveHotelRoom(ctx context.Context, hotelID bson.ObjectID, roomID bson.ObjectID) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := removeHotelRoom(ctx, tx, hotelID, roomID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeHotelRoom is the inverse of addHotelRooms and also bumps the hotel's
+// version.
+func removeHotelRoom(ctx context.Context, tx *sql.Tx, hotelID, roomID bson.ObjectID) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE hotels SET version = version + 1, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now().UnixNano(), hotelID.Hex(),
+	)
+	if err := affected(res, err, "hotel"); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM hotel_rooms WHERE hotel_id = ? AND room_id = ?",
+		hotelID.Hex(), roomID.Hex(),
+	)
+	return err
+}
+
+func (s *HotelStore) SuggestLocations(ctx context.Context, prefix string, limit int) ([]types.LocationSuggestion, error) {
+	var w where
+	w.add(`location LIKE ? ESCAPE '\'`, escapeLike(prefix)+"%")
+	notDeleted(ctx, &w)
+	rows, err := s.conn.QueryContext(ctx,
+		"SELECT location, COUNT(*) FROM hotels"+w.String()+" GROUP BY location ORDER BY COUNT(*) DESC, location LIMIT ?",
+		append(w.args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suggestions := []types.LocationSuggestion{}
+	for rows.Next() {
+		var suggestion types.LocationSuggestion
+		if err := rows.Scan(&suggestion.Location, &suggestion.Hotels); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+// loadRooms fills in the Rooms of each hotel. It runs after the hotel rows
+// are closed, as the pool only has one connection.
+func (s *HotelStore) loadRooms(ctx context.Context, hotels ...*types.Hotel) error {
+	if len(hotels) == 0 {
+		return nil
+	}
+	byID := make(map[bson.ObjectID]*types.Hotel, len(hotels))
+	args := make([]any, 0, len(hotels))
+	for _, hotel := range hotels {
+		byID[hotel.ID] = hotel
+		args = append(args, hotel.ID.Hex())
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := s.conn.QueryContext(ctx,
+		"SELECT hotel_id, room_id FROM hotel_rooms WHERE hotel_id IN ("+placeholders+") ORDER BY rowid",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hotelID, roomID bson.ObjectID
+		if err := rows.Scan(objectID{&hotelID}, objectID{&roomID}); err != nil {
+			return err
+		}
+		hotel := byID[hotelID]
+		hotel.Rooms = append(hotel.Rooms, roomID)
+	}
+	return rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
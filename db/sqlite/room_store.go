@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const roomColumns = "id, hotel_id, type, base_price, price, version, created_at, updated_at, deleted_at"
+
+type RoomStore struct {
+	conn *sql.DB
+}
+
+func NewRoomStore(conn *sql.DB) *RoomStore {
+	return &RoomStore{
+		conn: conn,
+	}
+}
+
+func scanRoom(row scanner) (*types.Room, error) {
+	var room types.Room
+	if err := row.Scan(
+		objectID{&room.ID},
+		objectID{&room.HotelID},
+		&room.Type,
+		&room.BasePrice,
+		&room.Price,
+		&room.Version,
+		unixTime{&room.CreatedAt},
+		unixTime{&room.UpdatedAt},
+		optionalTime{&room.DeletedAt},
+	); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s *RoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
+	if _, err := s.InsertRooms(ctx, room.HotelID, []*types.Room{room}); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// InsertRooms adds the rooms and links them to their hotel in one
+// transaction, so rooms of an unknown hotel leave nothing behind.
+func (s *RoomStore) InsertRooms(ctx context.Context, hotelID bson.ObjectID, rooms []*types.Room) ([]*types.Room, error) {
+	if len(rooms) == 0 {
+		return rooms, nil
+	}
+	now := time.Now()
+	ids := make([]bson.ObjectID, len(rooms))
+	for i, room := range rooms {
+		if room.ID.IsZero() {
+			room.ID = bson.NewObjectID()
+		}
+		room.HotelID = hotelID
+		room.CreatedAt = now
+		room.UpdatedAt = now
+		room.Version = 1
+		ids[i] = room.ID
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := addHotelRooms(ctx, tx, hotelID, ids...); err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO rooms ("+roomColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL)",
+			room.ID.Hex(), room.HotelID.Hex(), room.Type, room.BasePrice, room.Price, room.Version,
+			toUnix(room.CreatedAt), toUnix(room.UpdatedAt),
+		)
+		if err != nil {
+			return nil, sqliteErr("room", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *RoomStore) GetRooms(ctx context.Context, filter db.RoomFilter, pag *db.Pagination) ([]*types.Room, *db.PageInfo, error) {
+	var w where
+	notDeleted(ctx, &w)
+	if !filter.HotelID.IsZero() {
+		w.add("hotel_id = ?", filter.HotelID.Hex())
+	}
+	if filter.Type != 0 {
+		w.add("type = ?", filter.Type)
+	}
+	if filter.MinPrice > 0 {
+		w.add("price >= ?", filter.MinPrice)
+	}
+	if filter.MaxPrice > 0 {
+		w.add("price <= ?", filter.MaxPrice)
+	}
+	return selectPage(ctx, s.conn, "rooms", roomColumns, w, pag, scanRoom, func(r *types.Room) bson.ObjectID { return r.ID })
+}
+
+func (s *RoomStore) GetRoomByID(ctx context.Context, id string) (*types.Room, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var w where
+	w.add("id = ?", oid.Hex())
+	notDeleted(ctx, &w)
+	row := s.conn.QueryRowContext(ctx, "SELECT "+roomColumns+" FROM rooms"+w.String(), w.args...)
+	room, err := scanRoom(row)
+	if err != nil {
+		return nil, sqliteErr("room", err)
+	}
+	return room, nil
+}
+
+func (s *RoomStore) UpdateRoom(ctx context.Context, id string, params types.UpdateRoomParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	return versionedUpdate(ctx, s.conn, "room", `
+		type = COALESCE(NULLIF(?, 0), type),
+		base_price = COALESCE(NULLIF(?, 0), base_price),
+		price = COALESCE(NULLIF(?, 0), price)`,
+		oid, version, params.Type, params.BasePrice, params.Price,
+	)
+}
+
+// DeleteRoom soft-deletes the room and removes its hotel link in one
+// transaction.
+func (s *RoomStore) DeleteRoom(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var hotelID bson.ObjectID
+	now := time.Now().UnixNano()
+	err = tx.QueryRowContext(ctx, `
+		UPDATE rooms SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING hotel_id`,
+		now, now, oid.Hex(),
+	).Scan(objectID{&hotelID})
+	if err != nil {
+		return sqliteErr("room", err)
+	}
+	// A hotel that is already gone has nothing left to unlink.
+	if err := removeHotelRoom(ctx, tx, hotelID, oid); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,357 @@
+// Package sqlite implements the db store interfaces on an embedded SQLite
+// database. It suits single-property deployments and offline development
+// where running MongoDB is not worth it. Ids keep the ObjectID format so
+// the rest of the application does not notice the backend.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// PathEnvName names the variable holding the database file path.
+const PathEnvName = "SQLITE_PATH"
+
+// schema lists the schema changes in order. The database records how many
+// it has applied in PRAGMA user_version; released entries never change.
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS users (
+	id                 TEXT PRIMARY KEY,
+	first_name         TEXT NOT NULL DEFAULT '',
+	last_name          TEXT NOT NULL DEFAULT '',
+	email              TEXT NOT NULL UNIQUE,
+	encrypted_password TEXT NOT NULL DEFAULT '',
+	is_admin           INTEGER NOT NULL DEFAULT 0,
+	created_at         INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS hotels (
+	id       TEXT PRIMARY KEY,
+	name     TEXT NOT NULL DEFAULT '',
+	location TEXT NOT NULL DEFAULT '',
+	rating   INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS hotels_rating ON hotels (rating);
+
+-- hotel_rooms keeps Hotel.Rooms in insertion order (by rowid).
+CREATE TABLE IF NOT EXISTS hotel_rooms (
+	hotel_id TEXT NOT NULL REFERENCES hotels (id) ON DELETE CASCADE,
+	room_id  TEXT NOT NULL,
+	UNIQUE (hotel_id, room_id)
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+	id         TEXT PRIMARY KEY,
+	hotel_id   TEXT NOT NULL REFERENCES hotels (id),
+	type       INTEGER NOT NULL,
+	base_price REAL NOT NULL DEFAULT 0,
+	price      REAL NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS rooms_hotel_id ON rooms (hotel_id);
+
+-- first_night and end_night bound the nights a booking holds (see
+-- db.BookingNights); the overlap check in InsertBooking runs on them.
+CREATE TABLE IF NOT EXISTS bookings (
+	id          TEXT PRIMARY KEY,
+	user_id     TEXT NOT NULL,
+	room_id     TEXT NOT NULL,
+	num_persons INTEGER NOT NULL DEFAULT 0,
+	from_date   INTEGER NOT NULL,
+	till_date   INTEGER NOT NULL,
+	first_night INTEGER NOT NULL,
+	end_night   INTEGER NOT NULL,
+	canceled    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS bookings_room_nights ON bookings (room_id, first_night, end_night);
+CREATE INDEX IF NOT EXISTS bookings_user_id ON bookings (user_id);
+`, `
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE hotels ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE rooms ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+`, `
+ALTER TABLE users ADD COLUMN updated_at INTEGER;
+ALTER TABLE users ADD COLUMN deleted_at INTEGER;
+UPDATE users SET updated_at = created_at;
+ALTER TABLE hotels ADD COLUMN created_at INTEGER;
+ALTER TABLE hotels ADD COLUMN updated_at INTEGER;
+ALTER TABLE hotels ADD COLUMN deleted_at INTEGER;
+ALTER TABLE rooms ADD COLUMN created_at INTEGER;
+ALTER TABLE rooms ADD COLUMN updated_at INTEGER;
+ALTER TABLE rooms ADD COLUMN deleted_at INTEGER;
+ALTER TABLE bookings ADD COLUMN created_at INTEGER;
+ALTER TABLE bookings ADD COLUMN updated_at INTEGER;
+ALTER TABLE bookings ADD COLUMN deleted_at INTEGER;
+`, `
+ALTER TABLE hotels ADD COLUMN lat REAL;
+ALTER TABLE hotels ADD COLUMN lng REAL;
+CREATE INDEX IF NOT EXISTS hotels_lat_lng ON hotels (lat, lng);
+`, `
+ALTER TABLE hotels ADD COLUMN description TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS hotels_location ON hotels (location COLLATE NOCASE);
+`,
+}
+
+// Open opens (creating if needed) the database at path and brings its
+// schema up to date. Pass ":memory:" for a throwaway database.
+//
+// The pool is limited to one connection: SQLite allows a single writer
+// anyway, and an in-memory database only lives as long as its connection.
+func Open(ctx context.Context, path string) (*sql.DB, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+	if err := CreateSchema(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// CreateSchema applies the schema changes the database has not seen yet.
+func CreateSchema(ctx context.Context, conn *sql.DB) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var applied int
+	if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&applied); err != nil {
+		return err
+	}
+	if applied > len(schema) {
+		return fmt.Errorf("sqlite: database schema version %d is newer than this build (%d)", applied, len(schema))
+	}
+	for _, change := range schema[applied:] {
+		if _, err := tx.ExecContext(ctx, change); err != nil {
+			return err
+		}
+	}
+	// PRAGMA takes no bound parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", len(schema))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewStore returns a db.Store backed by conn. SQLite has no cache, so
+// Cache is left for the caller to fill in.
+func NewStore(conn *sql.DB) *db.Store {
+	return &db.Store{
+		User:    NewUserStore(conn),
+		Hotel:   NewHotelStore(conn),
+		Room:    NewRoomStore(conn),
+		Booking: NewBookingStore(conn),
+	}
+}
+
+// sqliteErr translates driver errors into the db sentinel errors.
+func sqliteErr(resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.NotFound(resource)
+	}
+	var serr *sqlite.Error
+	if errors.As(err, &serr) {
+		switch serr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%s %w", resource, db.ErrDuplicate)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return fmt.Errorf("%s is still referenced: %w", resource, db.ErrConflict)
+		}
+	}
+	return err
+}
+
+// where collects the conditions of a query, joined with AND.
+type where struct {
+	conds []string
+	args  []any
+}
+
+func (w *where) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// selectPage runs a paginated select ordered by id. It mirrors the Mongo
+// stores: ids are ObjectID hex strings, so ordering by id is insertion
+// order and cursors work the same way.
+func selectPage[T any](ctx context.Context, conn *sql.DB, table, columns string, w where, pag *db.Pagination, scan func(scanner) (*T, error), id func(*T) bson.ObjectID) ([]*T, *db.PageInfo, error) {
+	info := &db.PageInfo{}
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+w.String(), w.args...).Scan(&info.Total); err != nil {
+		return nil, nil, err
+	}
+
+	tail := " ORDER BY id"
+	if pag != nil {
+		limit, page := pag.Bounds()
+		info.Limit = limit
+		if pag.Cursor != "" {
+			after, err := db.DecodeCursor(pag.Cursor)
+			if err != nil {
+				return nil, nil, err
+			}
+			w.add("id > ?", after.Hex())
+			tail += " LIMIT ?"
+			w.args = append(w.args, limit+1)
+		} else {
+			info.Page = page
+			tail += " LIMIT ? OFFSET ?"
+			w.args = append(w.args, limit+1, (page-1)*limit)
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT "+columns+" FROM "+table+w.String()+tail, w.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	items := []*T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// One extra row tells us whether there is a next page.
+	if pag != nil && int64(len(items)) > info.Limit {
+		items = items[:info.Limit]
+		info.NextCursor = db.EncodeCursor(id(items[len(items)-1]))
+	}
+	return items, info, nil
+}
+
+// objectID scans a TEXT id column into an ObjectID.
+type objectID struct{ id *bson.ObjectID }
+
+func (o objectID) Scan(src any) error {
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("sqlite: cannot scan %T into an id", src)
+	}
+	oid, err := bson.ObjectIDFromHex(s)
+	if err != nil {
+		return err
+	}
+	*o.id = oid
+	return nil
+}
+
+// unixTime scans an INTEGER nanosecond column into a UTC time; NULL is the
+// zero time.
+type unixTime struct{ t *time.Time }
+
+func (u unixTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*u.t = time.Time{}
+	case int64:
+		*u.t = time.Unix(0, v).UTC()
+	default:
+		return fmt.Errorf("sqlite: cannot scan %T into a time", src)
+	}
+	return nil
+}
+
+// optionalTime scans a nullable INTEGER nanosecond column into a time
+// pointer that stays nil for NULL.
+type optionalTime struct{ t **time.Time }
+
+func (o optionalTime) Scan(src any) error {
+	if src == nil {
+		*o.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (unixTime{&t}).Scan(src); err != nil {
+		return err
+	}
+	*o.t = &t
+	return nil
+}
+
+// versionedUpdate applies set, a list of column assignments taking args, to
+// the live row of the resource's table with the given id. It also bumps the
+// version and stamps updated_at, provided a non-zero version still matches,
+// and reports why nothing matched.
+func versionedUpdate(ctx context.Context, conn *sql.DB, resource, set string, id bson.ObjectID, version int64, args ...any) error {
+	table := resource + "s"
+	if set != "" {
+		set += ", "
+	}
+	query := "UPDATE " + table + " SET " + set + "updated_at = ?, version = version + 1" +
+		" WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)"
+	args = append(args, time.Now().UnixNano(), id.Hex(), version, version)
+	res, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return sqliteErr(resource, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if version > 0 {
+		var exists bool
+		if err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = ? AND deleted_at IS NULL)", id.Hex()).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return db.StaleVersion(resource)
+		}
+	}
+	return db.NotFound(resource)
+}
+
+// softDelete marks the live row of the resource's table deleted, which
+// counts as a write.
+func softDelete(ctx context.Context, conn *sql.DB, resource string, id bson.ObjectID) error {
+	return versionedUpdate(ctx, conn, resource, "deleted_at = ?", id, 0, time.Now().UnixNano())
+}
+
+// notDeleted adds the soft-delete condition to w unless ctx asks for
+// deleted rows (see db.WithDeleted).
+func notDeleted(ctx context.Context, w *where) {
+	if !db.IncludesDeleted(ctx) {
+		w.add("deleted_at IS NULL")
+	}
+}
+
+// toUnix stores t as nanoseconds, keeping the zero time as NULL.
+func toUnix(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/memory"
+	"github.com/raminfathi/GoTel/db/storetest"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *db.Store {
+		conn, err := Open(context.Background(), ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		store := NewStore(conn)
+		store.Cache = memory.NewCacheStore()
+		return store
+	})
+}
+
+func TestCreateSchemaTwice(t *testing.T) {
+	conn, err := Open(context.Background(), ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := CreateSchema(context.Background(), conn); err != nil {
+		t.Fatalf("expected creating an existing schema to be a no-op: %v", err)
+	}
+}
+
+func TestCreateSchemaUpgrades(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	// A database created before hotels had a version.
+	if _, err := conn.ExecContext(ctx, schema[0]+"PRAGMA user_version = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	id := bson.NewObjectID()
+	if _, err := conn.ExecContext(ctx, "INSERT INTO hotels (id, name) VALUES (?, 'Old Hotel')", id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreateSchema(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	hotel, err := NewHotelStore(conn).GetHotelByID(ctx, id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hotel.Version != 1 {
+		t.Errorf("expected existing hotels to start at version 1 but got %d", hotel.Version)
+	}
+}
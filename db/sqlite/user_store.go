@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const userColumns = "id, first_name, last_name, email, encrypted_password, is_admin, created_at, updated_at, deleted_at, version"
+
+type UserStore struct {
+	conn *sql.DB
+}
+
+func NewUserStore(conn *sql.DB) *UserStore {
+	return &UserStore{
+		conn: conn,
+	}
+}
+
+func scanUser(row scanner) (*types.User, error) {
+	var user types.User
+	err := row.Scan(
+		objectID{&user.ID},
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.EncryptedPassword,
+		&user.IsAdmin,
+		unixTime{&user.CreatedAt},
+		unixTime{&user.UpdatedAt},
+		optionalTime{&user.DeletedAt},
+		&user.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *UserStore) Drop(ctx context.Context) error {
+	_, err := s.conn.ExecContext(ctx, "DELETE FROM users")
+	return err
+}
+
+func (s *UserStore) GetUserByID(ctx context.Context, id string) (*types.User, error) {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var w where
+	w.add("id = ?", oid.Hex())
+	notDeleted(ctx, &w)
+	row := s.conn.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users"+w.String(), w.args...)
+	user, err := scanUser(row)
+	return user, sqliteErr("user", err)
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	var w where
+	w.add("email = ?", email)
+	notDeleted(ctx, &w)
+	row := s.conn.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users"+w.String(), w.args...)
+	user, err := scanUser(row)
+	return user, sqliteErr("user", err)
+}
+
+func (s *UserStore) GetUsers(ctx context.Context, pag *db.Pagination) ([]*types.User, *db.PageInfo, error) {
+	var w where
+	notDeleted(ctx, &w)
+	return selectPage(ctx, s.conn, "users", userColumns, w, pag, scanUser, func(u *types.User) bson.ObjectID { return u.ID })
+}
+
+func (s *UserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if user.ID.IsZero() {
+		user.ID = bson.NewObjectID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	_, err := s.conn.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL, ?)",
+		user.ID.Hex(), user.FirstName, user.LastName, user.Email, user.EncryptedPassword, user.IsAdmin,
+		toUnix(user.CreatedAt), toUnix(user.UpdatedAt), user.Version,
+	)
+	if err != nil {
+		return nil, sqliteErr("user", err)
+	}
+	return user, nil
+}
+
+func (s *UserStore) DeleteUser(ctx context.Context, id string) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	return softDelete(ctx, s.conn, "user", oid)
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, id string, params types.UpdateUserParams, version int64) error {
+	oid, err := db.ParseID(id)
+	if err != nil {
+		return err
+	}
+	// Empty fields keep their current value, as in the other backends.
+	return versionedUpdate(ctx, s.conn, "user", `
+		first_name = COALESCE(NULLIF(?, ''), first_name),
+		last_name = COALESCE(NULLIF(?, ''), last_name)`,
+		oid, version, params.FirstName, params.LastName,
+	)
+}
+
+// affected reports a statement that matched no row as ErrNotFound.
+func affected(res sql.Result, err error, resource string) error {
+	if err != nil {
+		return sqliteErr(resource, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.NotFound(resource)
+	}
+	return nil
+}
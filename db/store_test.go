@@ -0,0 +1,107 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/db/storetest"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TestMongoConformance runs the shared store suite against a real MongoDB.
+// It is skipped unless MONGO_DB_URL_TEST points at a server.
+func TestMongoConformance(t *testing.T) {
+	uri := os.Getenv("MONGO_DB_URL_TEST")
+	if uri == "" {
+		t.Skip("MONGO_DB_URL_TEST not set")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.TODO())
+
+	var redisClient *redis.Client
+	if addr := os.Getenv("REDIS_URL_TEST"); addr != "" {
+		redisClient = redis.NewClient(&redis.Options{Addr: addr})
+		defer redisClient.Close()
+	}
+
+	storetest.Run(t, func(t *testing.T) *db.Store {
+		dbname := fmt.Sprintf("hotel_db_conformance_%d", time.Now().UnixNano())
+		t.Setenv(db.MongoDBNameEnvName, dbname)
+		t.Cleanup(func() {
+			client.Database(dbname).Drop(context.TODO())
+		})
+
+		hotelStore := db.NewMongoHotelStore(client)
+		store := &db.Store{
+			User:    db.NewMongoUserStore(client),
+			Hotel:   hotelStore,
+			Room:    db.NewMongoRoomStore(client, hotelStore),
+			Booking: db.NewMongoBookingStore(client),
+		}
+		if err := store.EnsureIndexes(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if redisClient != nil {
+			store.Cache = db.NewRedisCacheStore(redisClient)
+		}
+		return store
+	})
+}
+
+// TestRedisCacheConformance runs the cache tests against Redis, alone and
+// behind a local tier. It is skipped unless REDIS_URL_TEST points at a
+// server.
+func TestRedisCacheConformance(t *testing.T) {
+	addr := os.Getenv("REDIS_URL_TEST")
+	if addr == "" {
+		t.Skip("REDIS_URL_TEST not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+
+	t.Run("Redis", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) *db.Store {
+			return &db.Store{Cache: db.NewRedisCacheStore(client)}
+		})
+	})
+	t.Run("Tiered", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) *db.Store {
+			cache := db.NewTieredCacheStore(client, nil, db.DefaultLocalCacheOptions)
+			t.Cleanup(func() { cache.Close() })
+			return &db.Store{Cache: cache}
+		})
+	})
+}
+
+// TestRedisRateLimiterConformance is skipped unless REDIS_URL_TEST points
+// at a server.
+func TestRedisRateLimiterConformance(t *testing.T) {
+	addr := os.Getenv("REDIS_URL_TEST")
+	if addr == "" {
+		t.Skip("REDIS_URL_TEST not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	storetest.RunRateLimiter(t, db.NewRedisRateLimiter(client, nil))
+}
+
+// TestRedisLoginAttemptConformance is skipped unless REDIS_URL_TEST points
+// at a server.
+func TestRedisLoginAttemptConformance(t *testing.T) {
+	addr := os.Getenv("REDIS_URL_TEST")
+	if addr == "" {
+		t.Skip("REDIS_URL_TEST not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	storetest.RunLoginAttempts(t, db.NewRedisLoginAttemptStore(client, nil))
+}
@@ -0,0 +1,1405 @@
+// Package storetest is a conformance suite for the db store interfaces.
+// Every backend runs the same tests so they stay interchangeable.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raminfathi/GoTel/db"
+	"github.com/raminfathi/GoTel/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Factory returns a fresh, empty store for a single test. Stores a backend
+// does not provide may be left nil and their tests are skipped.
+type Factory func(t *testing.T) *db.Store
+
+func Run(t *testing.T, newStore Factory) {
+	t.Run("User", func(t *testing.T) { testUser(t, newStore(t)) })
+	t.Run("Hotel", func(t *testing.T) { testHotel(t, newStore(t)) })
+	t.Run("Room", func(t *testing.T) { testRoom(t, newStore(t)) })
+	t.Run("RoomLifecycle", func(t *testing.T) { testRoomLifecycle(t, newStore(t)) })
+	t.Run("Booking", func(t *testing.T) { testBooking(t, newStore(t)) })
+	t.Run("RoomAvailability", func(t *testing.T) { testRoomAvailability(t, newStore(t)) })
+	t.Run("BookingLedger", func(t *testing.T) { testBookingLedger(t, newStore(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newStore(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, newStore(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newStore(t)) })
+	t.Run("Near", func(t *testing.T) { testNear(t, newStore(t)) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, newStore(t)) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, newStore(t)) })
+	t.Run("Cache", func(t *testing.T) { testCache(t, newStore(t)) })
+}
+
+func testUser(t *testing.T, store *db.Store) {
+	if store.User == nil {
+		t.Skip("backend has no user store")
+	}
+	ctx := context.Background()
+
+	user, err := store.User.InsertUser(ctx, &types.User{
+		FirstName: "James",
+		LastName:  "Bond",
+		Email:     "james@bond.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID.IsZero() {
+		t.Fatal("expected inserted user to get an id")
+	}
+
+	got, err := store.User.GetUserByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != user.Email {
+		t.Errorf("expected email %s but got %s", user.Email, got.Email)
+	}
+	got, err = store.User.GetUserByEmail(ctx, "james@bond.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("expected user %s but got %s", user.ID, got.ID)
+	}
+	// The message must not depend on the backend either.
+	if _, err := store.User.InsertUser(ctx, &types.User{Email: "james@bond.com"}); !errors.Is(err, db.ErrDuplicate) || err.Error() != "user "+db.ErrDuplicate.Error() {
+		t.Errorf("expected ErrDuplicate for a taken email but got %v", err)
+	}
+	if _, err := store.User.GetUserByEmail(ctx, "nobody@bond.com"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown email but got %v", err)
+	}
+	if _, err := store.User.GetUserByID(ctx, bson.NewObjectID().Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown id but got %v", err)
+	}
+	if _, err := store.User.GetUserByID(ctx, "not-an-id"); !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID but got %v", err)
+	}
+	err = store.User.UpdateUser(ctx, bson.NewObjectID().Hex(), types.UpdateUserParams{FirstName: "Nobody"}, 0)
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating an unknown user but got %v", err)
+	}
+
+	err = store.User.UpdateUser(ctx, user.ID.Hex(), types.UpdateUserParams{FirstName: "Jimmy"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.User.GetUserByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FirstName != "Jimmy" || got.LastName != "Bond" {
+		t.Errorf("expected Jimmy Bond but got %s %s", got.FirstName, got.LastName)
+	}
+
+	if _, err := store.User.InsertUser(ctx, &types.User{Email: "m@mi6.com"}); err != nil {
+		t.Fatal(err)
+	}
+	users, _, err := store.User.GetUsers(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users but got %d", len(users))
+	}
+	if users[0].ID != user.ID {
+		t.Errorf("expected users in insertion order")
+	}
+
+	if err := store.User.DeleteUser(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.User.GetUserByID(ctx, user.ID.Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected deleted user to be gone but got %v", err)
+	}
+	if err := store.User.DeleteUser(ctx, user.ID.Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a missing user but got %v", err)
+	}
+	if err := store.User.DeleteUser(ctx, "not-an-id"); !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID but got %v", err)
+	}
+}
+
+func testHotel(t *testing.T, store *db.Store) {
+	if store.Hotel == nil {
+		t.Skip("backend has no hotel store")
+	}
+	ctx := context.Background()
+
+	hotel, err := store.Hotel.InsertHotel(ctx, &types.Hotel{
+		Name:     "Grand Hotel",
+		Location: "London",
+		Rooms:    []bson.ObjectID{},
+		Rating:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Hotel.InsertHotel(ctx, &types.Hotel{
+		Name:     "Budget Inn",
+		Location: "Paris",
+		Rooms:    []bson.ObjectID{},
+		Rating:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != hotel.Name || got.Rating != hotel.Rating {
+		t.Errorf("expected %+v but got %+v", hotel, got)
+	}
+	if _, err := store.Hotel.GetHotelByID(ctx, bson.NewObjectID().Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown id but got %v", err)
+	}
+	if _, err := store.Hotel.GetHotelByID(ctx, "not-an-id"); !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID but got %v", err)
+	}
+	if err := store.Hotel.UpdateHotelsRooms(ctx, bson.NewObjectID(), bson.NewObjectID()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound adding a room to an unknown hotel but got %v", err)
+	}
+
+	hotels, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 2 {
+		t.Fatalf("expected 2 hotels but got %d", len(hotels))
+	}
+	hotels, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Rating: 5}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 1 || hotels[0].ID != hotel.ID {
+		t.Fatalf("expected only %s for rating 5 but got %d hotels", hotel.Name, len(hotels))
+	}
+
+	if err := store.Hotel.UpdateHotel(ctx, hotel.ID.Hex(), types.UpdateHotelParams{Name: "Grander Hotel"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Grander Hotel" || got.Location != "London" {
+		t.Errorf("expected only the name to change but got %+v", got)
+	}
+
+	roomID := bson.NewObjectID()
+	if err := store.Hotel.UpdateHotelsRooms(ctx, hotel.ID, roomID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rooms) != 1 || got.Rooms[0] != roomID {
+		t.Errorf("expected rooms [%s] but got %v", roomID, got.Rooms)
+	}
+}
+
+func testRoom(t *testing.T, store *db.Store) {
+	if store.Room == nil || store.Hotel == nil {
+		t.Skip("backend has no room store")
+	}
+	ctx := context.Background()
+
+	hotel := insertHotel(t, store, "Grand Hotel")
+	other := insertHotel(t, store, "Budget Inn")
+
+	room, err := store.Room.InsertRoom(ctx, &types.Room{
+		Type:      types.Double,
+		BasePrice: 100,
+		Price:     100,
+		HotelID:   hotel.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ID.IsZero() {
+		t.Fatal("expected inserted room to get an id")
+	}
+	if _, err := store.Room.InsertRoom(ctx, &types.Room{
+		Type:      types.Single,
+		BasePrice: 50,
+		Price:     50,
+		HotelID:   other.ID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rooms) != 1 || got.Rooms[0] != room.ID {
+		t.Errorf("expected hotel rooms [%s] but got %v", room.ID, got.Rooms)
+	}
+
+	rooms, _, err := store.Room.GetRooms(ctx, db.RoomFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0].ID != room.ID {
+		t.Fatalf("expected only room %s but got %d rooms", room.ID, len(rooms))
+	}
+	if rooms[0].Type != types.Double || rooms[0].Price != 100 {
+		t.Errorf("expected %+v but got %+v", room, rooms[0])
+	}
+	if _, err := store.Room.InsertRoom(ctx, &types.Room{Type: types.Single, HotelID: bson.NewObjectID()}); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a room of an unknown hotel but got %v", err)
+	}
+	rooms, _, err = store.Room.GetRooms(ctx, db.RoomFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 {
+		t.Errorf("expected 2 rooms but got %d", len(rooms))
+	}
+
+	// A batch updates the hotel once, keeping the order of the rooms.
+	batch, err := store.Room.InsertRooms(ctx, other.ID, []*types.Room{
+		{Type: types.Double, BasePrice: 80, Price: 80},
+		{Type: types.SeaView, BasePrice: 120, Price: 120},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, other.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rooms) != 3 || got.Rooms[1] != batch[0].ID || got.Rooms[2] != batch[1].ID {
+		t.Errorf("expected the batch at the end of the hotel rooms but got %v", got.Rooms)
+	}
+	if got.Version != 3 {
+		t.Errorf("expected one version bump for the batch but got version %d", got.Version)
+	}
+	if batch[1].HotelID != other.ID {
+		t.Errorf("expected batch rooms to belong to %s but got %s", other.ID, batch[1].HotelID)
+	}
+	if _, err := store.Room.InsertRooms(ctx, bson.NewObjectID(), []*types.Room{{Type: types.Single}}); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for rooms of an unknown hotel but got %v", err)
+	}
+	rooms, _, err = store.Room.GetRooms(ctx, db.RoomFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 4 {
+		t.Errorf("expected a failed batch to leave nothing behind but got %d rooms", len(rooms))
+	}
+}
+
+func testRoomLifecycle(t *testing.T, store *db.Store) {
+	if store.Room == nil || store.Hotel == nil {
+		t.Skip("backend has no room store")
+	}
+	ctx := context.Background()
+
+	hotel := insertHotel(t, store, "Grand Hotel")
+	room, err := store.Room.InsertRoom(ctx, &types.Room{Type: types.Single, BasePrice: 50, Price: 50, HotelID: hotel.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := store.Room.InsertRoom(ctx, &types.Room{Type: types.Double, BasePrice: 80, Price: 80, HotelID: hotel.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := room.ID.Hex()
+
+	got, err := store.Room.GetRoomByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != room.ID || got.HotelID != hotel.ID || got.Price != 50 {
+		t.Errorf("expected %+v but got %+v", room, got)
+	}
+	if _, err := store.Room.GetRoomByID(ctx, "bogus"); !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID but got %v", err)
+	}
+
+	if err := store.Room.UpdateRoom(ctx, id, types.UpdateRoomParams{Price: 65}, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = store.Room.UpdateRoom(ctx, id, types.UpdateRoomParams{Price: 70}, 1)
+	if !errors.Is(err, db.ErrStaleVersion) {
+		t.Errorf("expected ErrStaleVersion but got %v", err)
+	}
+	got, err = store.Room.GetRoomByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Price != 65 || got.BasePrice != 50 || got.Type != types.Single || got.Version != 2 {
+		t.Errorf("expected only the price to change at version 2 but got %+v", got)
+	}
+
+	before, err := store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Room.DeleteRoom(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Room.GetRoomByID(ctx, id); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted room but got %v", err)
+	}
+	if err := store.Room.DeleteRoom(ctx, id); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a room twice but got %v", err)
+	}
+	after, err := store.Hotel.GetHotelByID(ctx, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after.Rooms) != 1 || after.Rooms[0] != kept.ID {
+		t.Errorf("expected hotel rooms [%s] but got %v", kept.ID, after.Rooms)
+	}
+	if after.Version != before.Version+1 {
+		t.Errorf("expected deleting a room to bump the hotel to version %d but got %d", before.Version+1, after.Version)
+	}
+}
+
+func testBooking(t *testing.T, store *db.Store) {
+	if store.Booking == nil {
+		t.Skip("backend has no booking store")
+	}
+	ctx := context.Background()
+
+	userID, roomID := bson.NewObjectID(), bson.NewObjectID()
+	from := day(10)
+	booking, err := store.Booking.InsertBooking(ctx, &types.Booking{
+		UserID:     userID,
+		RoomID:     roomID,
+		NumPersons: 2,
+		FromDate:   from,
+		TillDate:   from.AddDate(0, 0, 3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booking.ID.IsZero() {
+		t.Fatal("expected inserted booking to get an id")
+	}
+	if _, err := store.Booking.InsertBooking(ctx, &types.Booking{
+		UserID:   bson.NewObjectID(),
+		RoomID:   roomID,
+		FromDate: from.AddDate(0, 0, 5),
+		TillDate: from.AddDate(0, 0, 6),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Booking.GetBookingByID(ctx, booking.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != userID || got.NumPersons != 2 || !got.FromDate.Equal(booking.FromDate) {
+		t.Errorf("expected %+v but got %+v", booking, got)
+	}
+	if _, err := store.Booking.GetBookingByID(ctx, bson.NewObjectID().Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown id but got %v", err)
+	}
+	if err := store.Booking.CancelBooking(ctx, bson.NewObjectID().Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound canceling an unknown booking but got %v", err)
+	}
+	if err := store.Booking.CancelBooking(ctx, "not-an-id"); !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID but got %v", err)
+	}
+
+	bookings, _, err := store.Booking.GetBookings(ctx, db.BookingFilter{UserID: userID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 || bookings[0].ID != booking.ID {
+		t.Fatalf("expected only booking %s but got %d bookings", booking.ID, len(bookings))
+	}
+	bookings, _, err = store.Booking.GetBookings(ctx, db.BookingFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 2 {
+		t.Errorf("expected 2 bookings but got %d", len(bookings))
+	}
+
+	if err := store.Booking.CancelBooking(ctx, booking.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Booking.GetBookingByID(ctx, booking.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Canceled {
+		t.Error("expected booking to be canceled")
+	}
+}
+
+func testRoomAvailability(t *testing.T, store *db.Store) {
+	if store.Booking == nil {
+		t.Skip("backend has no booking store")
+	}
+	ctx := context.Background()
+
+	roomID := bson.NewObjectID()
+	booked, err := store.Booking.InsertBooking(ctx, &types.Booking{
+		UserID:   bson.NewObjectID(),
+		RoomID:   roomID,
+		FromDate: day(10),
+		TillDate: day(13),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		roomID    bson.ObjectID
+		from      time.Time
+		till      time.Time
+		available bool
+	}{
+		{"same dates", roomID, day(10), day(13), false},
+		{"overlaps start", roomID, day(8), day(11), false},
+		{"overlaps end", roomID, day(12), day(15), false},
+		{"inside", roomID, day(11), day(12), false},
+		{"surrounds", roomID, day(9), day(14), false},
+		{"ends on check-in", roomID, day(8), day(10), true},
+		{"starts on check-out", roomID, day(13), day(15), true},
+		{"other room", bson.NewObjectID(), day(10), day(13), true},
+	}
+	for _, tt := range tests {
+		ok, err := store.Booking.IsRoomAvailable(ctx, tt.roomID, tt.from, tt.till)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.available {
+			t.Errorf("%s: expected available=%v but got %v", tt.name, tt.available, ok)
+		}
+	}
+
+	if err := store.Booking.CancelBooking(ctx, booked.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := store.Booking.IsRoomAvailable(ctx, roomID, day(10), day(13))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected a canceled booking to free the room")
+	}
+}
+
+func testBookingLedger(t *testing.T, store *db.Store) {
+	if store.Booking == nil {
+		t.Skip("backend has no booking store")
+	}
+	ctx := context.Background()
+	roomID := bson.NewObjectID()
+
+	// Concurrent requests for overlapping nights: exactly one may win.
+	const attempts = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded []*types.Booking
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			booking, err := store.Booking.InsertBooking(ctx, &types.Booking{
+				UserID:   bson.NewObjectID(),
+				RoomID:   roomID,
+				FromDate: day(20 + i%2),
+				TillDate: day(23),
+			})
+			if errors.Is(err, db.ErrConflict) {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			succeeded = append(succeeded, booking)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	if len(succeeded) != 1 {
+		t.Fatalf("expected exactly 1 booking to succeed but got %d", len(succeeded))
+	}
+
+	bookings, _, err := store.Booking.GetBookings(ctx, db.BookingFilter{RoomID: roomID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Fatalf("expected failed bookings to leave nothing behind but got %d bookings", len(bookings))
+	}
+
+	// Adjacent stays share no night.
+	if _, err := store.Booking.InsertBooking(ctx, &types.Booking{
+		UserID:   bson.NewObjectID(),
+		RoomID:   roomID,
+		FromDate: day(23),
+		TillDate: day(25),
+	}); err != nil {
+		t.Fatalf("expected a stay starting on check-out day to succeed: %v", err)
+	}
+
+	winner := succeeded[0]
+	if err := store.Booking.CancelBooking(ctx, winner.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Booking.GetBookingByID(ctx, winner.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Canceled {
+		t.Error("expected booking to be canceled")
+	}
+	if _, err := store.Booking.InsertBooking(ctx, &types.Booking{
+		UserID:   bson.NewObjectID(),
+		RoomID:   roomID,
+		FromDate: day(20),
+		TillDate: day(23),
+	}); err != nil {
+		t.Fatalf("expected canceled nights to be released: %v", err)
+	}
+}
+
+func testVersions(t *testing.T, store *db.Store) {
+	if store.Hotel == nil || store.Room == nil || store.User == nil {
+		t.Skip("backend lacks hotel, room or user stores")
+	}
+	ctx := context.Background()
+
+	hotel := insertHotel(t, store, "Grand Hotel")
+	if hotel.Version != 1 {
+		t.Fatalf("expected a new hotel at version 1 but got %d", hotel.Version)
+	}
+	id := hotel.ID.Hex()
+	if err := store.Hotel.UpdateHotel(ctx, id, types.UpdateHotelParams{Name: "Grander Hotel"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The first writer moved the hotel to version 2; a second writer that
+	// also read version 1 must not overwrite it.
+	err := store.Hotel.UpdateHotel(ctx, id, types.UpdateHotelParams{Name: "Other Hotel"}, 1)
+	if !errors.Is(err, db.ErrStaleVersion) {
+		t.Errorf("expected ErrStaleVersion but got %v", err)
+	}
+	err = store.Hotel.UpdateHotel(ctx, bson.NewObjectID().Hex(), types.UpdateHotelParams{Name: "Nowhere"}, 1)
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown hotel but got %v", err)
+	}
+	got, err := store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Grander Hotel" || got.Version != 2 {
+		t.Errorf("expected Grander Hotel at version 2 but got %s at %d", got.Name, got.Version)
+	}
+
+	room, err := store.Room.InsertRoom(ctx, &types.Room{Type: types.Single, Price: 50, HotelID: hotel.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Version != 1 {
+		t.Errorf("expected a new room at version 1 but got %d", room.Version)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 3 {
+		t.Errorf("expected adding a room to bump the hotel to version 3 but got %d", got.Version)
+	}
+	if err := store.Hotel.UpdateHotel(ctx, id, types.UpdateHotelParams{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Hotel.GetHotelByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 4 {
+		t.Errorf("expected an unconditional update to bump the hotel to version 4 but got %d", got.Version)
+	}
+
+	user, err := store.User.InsertUser(ctx, &types.User{Email: "james@bond.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Version != 1 {
+		t.Fatalf("expected a new user at version 1 but got %d", user.Version)
+	}
+	if err := store.User.UpdateUser(ctx, user.ID.Hex(), types.UpdateUserParams{FirstName: "James"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = store.User.UpdateUser(ctx, user.ID.Hex(), types.UpdateUserParams{FirstName: "Jimmy"}, 1)
+	if !errors.Is(err, db.ErrStaleVersion) {
+		t.Errorf("expected ErrStaleVersion but got %v", err)
+	}
+	gotUser, err := store.User.GetUserByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotUser.FirstName != "James" || gotUser.Version != 2 {
+		t.Errorf("expected James at version 2 but got %s at %d", gotUser.FirstName, gotUser.Version)
+	}
+}
+
+func testSoftDelete(t *testing.T, store *db.Store) {
+	if store.Hotel == nil || store.Room == nil || store.User == nil || store.Booking == nil {
+		t.Skip("backend lacks a store")
+	}
+	ctx := context.Background()
+	admin := db.WithDeleted(ctx)
+
+	user, err := store.User.InsertUser(ctx, &types.User{Email: "james@bond.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.CreatedAt.IsZero() || !user.UpdatedAt.Equal(user.CreatedAt) || user.DeletedAt != nil {
+		t.Errorf("expected a new user with matching created and updated times but got %+v", user)
+	}
+	if _, err := store.User.InsertUser(ctx, &types.User{Email: "kept@bond.com"}); err != nil {
+		t.Fatal(err)
+	}
+	id := user.ID.Hex()
+	// Mongo keeps milliseconds; make sure the update lands in a later one.
+	time.Sleep(2 * time.Millisecond)
+	if err := store.User.UpdateUser(ctx, id, types.UpdateUserParams{FirstName: "James"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.User.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.After(got.CreatedAt) {
+		t.Errorf("expected an update to move UpdatedAt past CreatedAt but got %s and %s", got.UpdatedAt, got.CreatedAt)
+	}
+
+	if err := store.User.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.User.GetUserByID(ctx, id); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted user but got %v", err)
+	}
+	if _, err := store.User.GetUserByEmail(ctx, user.Email); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound by email for a deleted user but got %v", err)
+	}
+	if err := store.User.UpdateUser(ctx, id, types.UpdateUserParams{FirstName: "Ghost"}, 0); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted user but got %v", err)
+	}
+	if err := store.User.DeleteUser(ctx, id); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a user twice but got %v", err)
+	}
+	users, _, err := store.User.GetUsers(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Errorf("expected 1 live user but got %d", len(users))
+	}
+	users, _, err = store.User.GetUsers(admin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("expected 2 users including deleted but got %d", len(users))
+	}
+	got, err = store.User.GetUserByID(admin, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt == nil || got.FirstName != "James" {
+		t.Errorf("expected the deleted user with DeletedAt set but got %+v", got)
+	}
+
+	hotel := insertHotel(t, store, "Grand Hotel")
+	if hotel.CreatedAt.IsZero() {
+		t.Error("expected a new hotel to get CreatedAt")
+	}
+	room, err := store.Room.InsertRoom(ctx, &types.Room{Type: types.Single, Price: 50, HotelID: hotel.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.CreatedAt.IsZero() {
+		t.Error("expected a new room to get CreatedAt")
+	}
+	booking, err := store.Booking.InsertBooking(ctx, &types.Booking{UserID: user.ID, RoomID: room.ID, FromDate: day(1), TillDate: day(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booking.CreatedAt.IsZero() {
+		t.Error("expected a new booking to get CreatedAt")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := store.Booking.CancelBooking(ctx, booking.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := store.Booking.GetBookingByID(ctx, booking.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.UpdatedAt.After(canceled.CreatedAt) {
+		t.Errorf("expected canceling to move UpdatedAt past CreatedAt but got %s and %s", canceled.UpdatedAt, canceled.CreatedAt)
+	}
+
+	if err := store.Room.DeleteRoom(ctx, room.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Hotel.DeleteHotel(ctx, hotel.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Hotel.GetHotelByID(ctx, hotel.ID.Hex()); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted hotel but got %v", err)
+	}
+	hotels, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 0 {
+		t.Errorf("expected no live hotels but got %d", len(hotels))
+	}
+	deletedHotel, err := store.Hotel.GetHotelByID(admin, hotel.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deletedHotel.DeletedAt == nil {
+		t.Error("expected the deleted hotel to have DeletedAt")
+	}
+	rooms, _, err := store.Room.GetRooms(ctx, db.RoomFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 0 {
+		t.Errorf("expected no live rooms but got %d", len(rooms))
+	}
+	rooms, _, err = store.Room.GetRooms(admin, db.RoomFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0].DeletedAt == nil {
+		t.Errorf("expected the deleted room when asking for deleted records but got %v", rooms)
+	}
+	// The deleted user's bookings are kept, and still found by hotel.
+	bookings, _, err := store.Booking.GetBookings(ctx, db.BookingFilter{HotelID: hotel.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Errorf("expected the booking of the deleted room to remain but got %d", len(bookings))
+	}
+}
+
+func testFilters(t *testing.T, store *db.Store) {
+	if store.Hotel == nil || store.Room == nil || store.Booking == nil {
+		t.Skip("backend lacks hotel, room or booking stores")
+	}
+	ctx := context.Background()
+
+	hotel := insertHotel(t, store, "Grand Hotel")
+	other, err := store.Hotel.InsertHotel(ctx, &types.Hotel{
+		Name:     "Beach Resort",
+		Location: "Nice, France",
+		Rooms:    []bson.ObjectID{},
+		Rating:   4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotels, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{Location: "france"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 1 || hotels[0].ID != other.ID {
+		t.Errorf("expected only %s for location france but got %d hotels", other.Name, len(hotels))
+	}
+	hotels, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Location: "London", Rating: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 0 {
+		t.Errorf("expected no rating 4 hotels in London but got %d", len(hotels))
+	}
+
+	var rooms []*types.Room
+	for _, r := range []struct {
+		hotelID bson.ObjectID
+		typ     types.RoomType
+		price   float64
+	}{
+		{hotel.ID, types.Single, 50},
+		{hotel.ID, types.Double, 120},
+		{hotel.ID, types.Double, 200},
+		{other.ID, types.Double, 150},
+	} {
+		room, err := store.Room.InsertRoom(ctx, &types.Room{Type: r.typ, BasePrice: r.price, Price: r.price, HotelID: r.hotelID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rooms = append(rooms, room)
+	}
+
+	roomTests := []struct {
+		name   string
+		filter db.RoomFilter
+		want   []bson.ObjectID
+	}{
+		{"type", db.RoomFilter{Type: types.Double}, []bson.ObjectID{rooms[1].ID, rooms[2].ID, rooms[3].ID}},
+		{"hotel and type", db.RoomFilter{HotelID: hotel.ID, Type: types.Double}, []bson.ObjectID{rooms[1].ID, rooms[2].ID}},
+		{"min price", db.RoomFilter{MinPrice: 150}, []bson.ObjectID{rooms[2].ID, rooms[3].ID}},
+		{"price range", db.RoomFilter{MinPrice: 50, MaxPrice: 120}, []bson.ObjectID{rooms[0].ID, rooms[1].ID}},
+	}
+	for _, tt := range roomTests {
+		got, _, err := store.Room.GetRooms(ctx, tt.filter, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []bson.ObjectID
+		for _, room := range got {
+			ids = append(ids, room.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("rooms by %s: expected %v but got %v", tt.name, tt.want, ids)
+		}
+	}
+
+	userID := bson.NewObjectID()
+	var bookings []*types.Booking
+	for _, b := range []struct {
+		userID   bson.ObjectID
+		roomID   bson.ObjectID
+		from     int
+		till     int
+		canceled bool
+	}{
+		{userID, rooms[0].ID, 10, 12, false},
+		{userID, rooms[1].ID, 20, 22, true},
+		{bson.NewObjectID(), rooms[3].ID, 11, 15, false},
+	} {
+		booking, err := store.Booking.InsertBooking(ctx, &types.Booking{
+			UserID:   b.userID,
+			RoomID:   b.roomID,
+			FromDate: day(b.from),
+			TillDate: day(b.till),
+			Canceled: b.canceled,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookings = append(bookings, booking)
+	}
+
+	bookingTests := []struct {
+		name   string
+		filter db.BookingFilter
+		want   []bson.ObjectID
+	}{
+		{"hotel", db.BookingFilter{HotelID: hotel.ID}, []bson.ObjectID{bookings[0].ID, bookings[1].ID}},
+		{"hotel and room", db.BookingFilter{HotelID: other.ID, RoomID: rooms[0].ID}, nil},
+		{"active", db.BookingFilter{UserID: userID, Status: db.BookingStatusActive}, []bson.ObjectID{bookings[0].ID}},
+		{"canceled", db.BookingFilter{Status: db.BookingStatusCanceled}, []bson.ObjectID{bookings[1].ID}},
+		{"date range", db.BookingFilter{From: day(12), Till: day(20)}, []bson.ObjectID{bookings[2].ID}},
+		{"open ended", db.BookingFilter{From: day(14)}, []bson.ObjectID{bookings[1].ID, bookings[2].ID}},
+		{"hotel without rooms", db.BookingFilter{HotelID: insertHotel(t, store, "Empty").ID}, nil},
+	}
+	for _, tt := range bookingTests {
+		got, _, err := store.Booking.GetBookings(ctx, tt.filter, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []bson.ObjectID
+		for _, booking := range got {
+			ids = append(ids, booking.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("bookings by %s: expected %v but got %v", tt.name, tt.want, ids)
+		}
+	}
+}
+
+func testNear(t *testing.T, store *db.Store) {
+	if store.Hotel == nil {
+		t.Skip("backend has no hotel store")
+	}
+	ctx := context.Background()
+
+	var hotels []*types.Hotel
+	for _, h := range []struct {
+		name     string
+		lat, lng float64
+	}{
+		{"Louvre", 48.8606, 2.3376},
+		{"Eiffel", 48.8584, 2.2945},
+		{"Versailles", 48.8049, 2.1204},
+		{"London", 51.5072, -0.1276},
+	} {
+		hotel, err := store.Hotel.InsertHotel(ctx, &types.Hotel{
+			Name:        h.name,
+			Location:    "Europe",
+			Rooms:       []bson.ObjectID{},
+			Coordinates: types.NewGeoPoint(h.lat, h.lng),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hotels = append(hotels, hotel)
+	}
+	// Hotels without coordinates never match a near search.
+	insertHotel(t, store, "Nowhere")
+
+	near := types.NewGeoPoint(48.8566, 2.3522) // Paris, close to the Louvre
+	got, info, err := store.Hotel.GetHotels(ctx, db.HotelFilter{Near: near}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Total != 4 || len(got) != 4 {
+		t.Fatalf("expected the 4 hotels with coordinates but got %d of %d", len(got), info.Total)
+	}
+	for i, hotel := range got {
+		if hotel.ID != hotels[i].ID {
+			t.Errorf("expected %s at position %d but got %s", hotels[i].Name, i, hotel.Name)
+		}
+		want := db.Distance(*near, *hotels[i].Coordinates)
+		if hotel.Distance == nil || math.Abs(*hotel.Distance-want) > 1 {
+			t.Errorf("expected %s to be %.0fm away but got %v", hotel.Name, want, hotel.Distance)
+		}
+	}
+
+	got, info, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Near: near, Radius: 10000, Location: "europe"}, &db.Pagination{Limit: 1, Page: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Total != 2 || len(got) != 1 || got[0].ID != hotels[1].ID {
+		t.Errorf("expected page 2 of 2 hotels within 10km to hold %s but got %d of %d", hotels[1].Name, len(got), info.Total)
+	}
+	if info.NextCursor != "" {
+		t.Errorf("expected no cursor for a near search but got %q", info.NextCursor)
+	}
+
+	_, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Near: near}, &db.Pagination{Cursor: db.EncodeCursor(hotels[0].ID)})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a cursor on a near search but got %v", err)
+	}
+}
+
+func testSearch(t *testing.T, store *db.Store) {
+	if store.Hotel == nil {
+		t.Skip("backend has no hotel store")
+	}
+	ctx := context.Background()
+
+	var hotels []*types.Hotel
+	for _, h := range []struct {
+		name, location, description string
+		rating                      int
+	}{
+		{"Harbour View", "Sydney", "Rooms overlooking the harbour", 4},
+		{"Old Town Inn", "Harbour Town", "", 4},
+		{"City Lodge", "Sydney", "Ten minutes from the harbour", 3},
+		{"Harbourside Suites", "Sydney", "", 5},
+		{"Mountain Retreat", "Harbour Sydney", "Quiet valley", 4},
+	} {
+		hotel, err := store.Hotel.InsertHotel(ctx, &types.Hotel{
+			Name:        h.name,
+			Location:    h.location,
+			Description: h.description,
+			Rating:      h.rating,
+			Rooms:       []bson.ObjectID{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hotels = append(hotels, hotel)
+	}
+	if err := store.Hotel.DeleteHotel(ctx, hotels[4].ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A match in the name beats one in the location, which beats one in the
+	// description. Words match whole, so "Harbourside" does not count.
+	got, info, err := store.Hotel.GetHotels(ctx, db.HotelFilter{Query: "HARBOUR"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bson.ObjectID{hotels[0].ID, hotels[1].ID, hotels[2].ID}
+	var ids []bson.ObjectID
+	for _, hotel := range got {
+		ids = append(ids, hotel.ID)
+		if hotel.Score == nil || *hotel.Score <= 0 {
+			t.Errorf("expected a positive score for %s but got %v", hotel.Name, hotel.Score)
+		}
+	}
+	if info.Total != 3 || !slices.Equal(ids, want) {
+		t.Errorf("expected %v ranked by relevance but got %v of %d", want, ids, info.Total)
+	}
+
+	got, info, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Query: "harbour lodge", Rating: 3}, &db.Pagination{Limit: 1, Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Total != 1 || len(got) != 1 || got[0].ID != hotels[2].ID {
+		t.Errorf("expected only %s among rating 3 hotels but got %d of %d", hotels[2].Name, len(got), info.Total)
+	}
+
+	got, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Query: "castle"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no hotels for an unknown word but got %d", len(got))
+	}
+
+	_, _, err = store.Hotel.GetHotels(ctx, db.HotelFilter{Query: "harbour"}, &db.Pagination{Cursor: db.EncodeCursor(hotels[0].ID)})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a cursor on a text search but got %v", err)
+	}
+
+	suggestions, err := store.Hotel.SuggestLocations(ctx, "sy", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(suggestions, []types.LocationSuggestion{{Location: "Sydney", Hotels: 3}}) {
+		t.Errorf("expected Sydney with 3 hotels but got %v", suggestions)
+	}
+	suggestions, err = store.Hotel.SuggestLocations(ctx, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Location != "Sydney" {
+		t.Errorf("expected the busiest location first but got %v", suggestions)
+	}
+}
+
+func testPagination(t *testing.T, store *db.Store) {
+	if store.Hotel == nil {
+		t.Skip("backend has no hotel store")
+	}
+	ctx := context.Background()
+
+	var ids []bson.ObjectID
+	for i := 0; i < 5; i++ {
+		ids = append(ids, insertHotel(t, store, fmt.Sprintf("Hotel %d", i)).ID)
+	}
+
+	hotels, page, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, &db.Pagination{Limit: 2, Page: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 2 || hotels[0].ID != ids[2] || hotels[1].ID != ids[3] {
+		t.Fatalf("expected hotels 2 and 3 on page 2 but got %d hotels", len(hotels))
+	}
+	if page.Total != 5 || page.Page != 2 || page.Limit != 2 || page.NextCursor == "" {
+		t.Errorf("unexpected page info %+v", page)
+	}
+
+	// Following cursors from the first page visits every hotel once.
+	var seen []bson.ObjectID
+	pag := &db.Pagination{Limit: 2}
+	for {
+		hotels, page, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, pag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hotel := range hotels {
+			seen = append(seen, hotel.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		pag = &db.Pagination{Limit: 2, Cursor: page.NextCursor}
+	}
+	if !slices.Equal(seen, ids) {
+		t.Errorf("expected cursors to visit %v but got %v", ids, seen)
+	}
+
+	hotels, page, err = store.Hotel.GetHotels(ctx, db.HotelFilter{}, &db.Pagination{Limit: 2, Page: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 0 || page.NextCursor != "" {
+		t.Errorf("expected an empty last page but got %d hotels", len(hotels))
+	}
+
+	if _, _, err := store.Hotel.GetHotels(ctx, db.HotelFilter{}, &db.Pagination{Cursor: "!!"}); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor but got %v", err)
+	}
+
+	if store.User == nil {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := store.User.InsertUser(ctx, &types.User{Email: fmt.Sprintf("user%d@gotel.com", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, page, err := store.User.GetUsers(ctx, &db.Pagination{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || page.Total != 3 || page.NextCursor == "" {
+		t.Errorf("expected 2 of 3 users with a next cursor but got %d users, %+v", len(users), page)
+	}
+}
+
+func testCache(t *testing.T, store *db.Store) {
+	if store.Cache == nil {
+		t.Skip("backend has no cache store")
+	}
+	ctx := context.Background()
+	key := "storetest-" + bson.NewObjectID().Hex()
+
+	val, err := store.Cache.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "" {
+		t.Errorf("expected a miss but got %q", val)
+	}
+
+	if err := store.Cache.Set(ctx, key, []byte(`{"name":"foo"}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	val, err = store.Cache.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != `{"name":"foo"}` {
+		t.Errorf("expected cached value but got %q", val)
+	}
+
+	if err := store.Cache.Delete(ctx, key, key+"-missing"); err != nil {
+		t.Fatal(err)
+	}
+	val, err = store.Cache.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "" {
+		t.Errorf("expected a miss after Delete but got %q", val)
+	}
+
+	if err := store.Cache.Set(ctx, key, "a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	vals, err := store.Cache.GetMany(ctx, key+"-missing", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(vals, []string{"", "a"}) {
+		t.Errorf("expected a miss and a hit but got %q", vals)
+	}
+
+	// Tags: deleting one drops its keys, however they were tagged, and
+	// leaves other keys alone.
+	hotelTag, roomTag := key+"-hotel", key+"-room"
+	if err := store.Cache.SetWithTags(ctx, key+"-h", "h", time.Minute, hotelTag); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Cache.SetWithTags(ctx, key+"-r", "r", 0, roomTag, hotelTag); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Cache.SetWithTags(ctx, key+"-o", "o", time.Minute, roomTag); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.Cache.DeleteTags(ctx, hotelTag, key+"-unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(deleted)
+	if !slices.Equal(deleted, []string{key + "-h", key + "-r"}) {
+		t.Errorf("expected DeleteTags to return the keys it dropped but got %q", deleted)
+	}
+	vals, err = store.Cache.GetMany(ctx, key+"-h", key+"-r", key+"-o", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(vals, []string{"", "", "o", "a"}) {
+		t.Errorf("expected only the tagged keys dropped but got %q", vals)
+	}
+
+	if err := store.Cache.DeletePrefix(ctx, key+"-"); err != nil {
+		t.Fatal(err)
+	}
+	vals, err = store.Cache.GetMany(ctx, key+"-o", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(vals, []string{"", "a"}) {
+		t.Errorf("expected only the keys with the prefix dropped but got %q", vals)
+	}
+	store.Cache.Delete(ctx, key)
+
+	for _, k := range []string{key + "-c1", key + "-c2", key + "-d"} {
+		if err := store.Cache.Set(ctx, k, "c", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := store.Cache.CountPrefix(ctx, key+"-c"); err != nil || n != 2 {
+		t.Errorf("expected 2 keys with the prefix but got %d, %v", n, err)
+	}
+	store.Cache.DeletePrefix(ctx, key+"-")
+
+	ranking := key + "-ranking"
+	for _, member := range []string{"a", "b", "b", "c", "b", "c"} {
+		if err := store.Cache.IncrRank(ctx, ranking, member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	top, err := store.Cache.TopRanked(ctx, ranking, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(top, []string{"b", "c"}) {
+		t.Errorf("expected the 2 highest ranked members b and c but got %q", top)
+	}
+	store.Cache.Delete(ctx, ranking)
+
+	if err := store.Cache.Set(ctx, key, "short", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	val, err = store.Cache.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "" {
+		t.Errorf("expected key to expire but got %q", val)
+	}
+}
+
+func insertHotel(t *testing.T, store *db.Store, name string) *types.Hotel {
+	t.Helper()
+	hotel, err := store.Hotel.InsertHotel(context.Background(), &types.Hotel{
+		Name:     name,
+		Location: "London",
+		Rooms:    []bson.ObjectID{},
+		Rating:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotel
+}
+
+// day returns midnight UTC n days from now. Mongo stores times with
+// millisecond precision, so tests avoid sub-millisecond values.
+func day(n int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, n)
+}
+
+// RunRateLimiter checks a rate limiter against the sliding window
+// RateLimiter describes.
+func RunRateLimiter(t *testing.T, limiter db.RateLimiter) {
+	ctx := context.Background()
+	key := fmt.Sprintf("storetest:ratelimit:%d", time.Now().UnixNano())
+	window := 200 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(ctx, key, 3, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i || res.Reset <= 0 || res.Reset > window {
+			t.Fatalf("request %d: expected it allowed with %d remaining but got %+v", i+1, 2-i, res)
+		}
+	}
+	res, err := limiter.Allow(ctx, key, 3, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.Remaining != 0 || res.Reset <= 0 || res.Reset > window {
+		t.Errorf("expected the 4th request refused until the first leaves but got %+v", res)
+	}
+	if other, err := limiter.Allow(ctx, key+"-other", 3, window); err != nil || !other.Allowed {
+		t.Errorf("expected another key to have its own window but got %+v, %v", other, err)
+	}
+
+	// Refused requests do not count, so the window frees up on time.
+	time.Sleep(window + 50*time.Millisecond)
+	res, err = limiter.Allow(ctx, key, 3, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 2 {
+		t.Errorf("expected the window to slide past the first requests but got %+v", res)
+	}
+}
+
+// RunLoginAttempts checks a login attempt store.
+func RunLoginAttempts(t *testing.T, store db.LoginAttemptStore) {
+	ctx := context.Background()
+	key := fmt.Sprintf("storetest:login:%d", time.Now().UnixNano())
+	other := key + "-other"
+
+	for i := 1; i <= 3; i++ {
+		n, err := store.RecordLoginFailure(ctx, key, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Errorf("expected failure %d to be counted but got %d", i, n)
+		}
+	}
+	// A failure taken back is counted again; one never counted is not.
+	if err := store.ForgetLoginFailure(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.RecordLoginFailure(ctx, key, time.Minute); err != nil || n != 3 {
+		t.Errorf("expected the failure taken back to be counted again as 3 but got %d, %v", n, err)
+	}
+	if err := store.ForgetLoginFailure(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.BlockLogin(ctx, key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	attempts, err := store.LoginAttempts(ctx, key, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts[0].Failures != 3 || attempts[0].Blocked <= 0 || attempts[0].Blocked > time.Minute {
+		t.Errorf("expected 3 failures and a block but got %+v", attempts[0])
+	}
+	if attempts[1] != (db.LoginAttempts{}) {
+		t.Errorf("expected nothing under another key but got %+v", attempts[1])
+	}
+
+	// Blocks and failures run out on their own.
+	if err := store.BlockLogin(ctx, other, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RecordLoginFailure(ctx, other, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	attempts, err = store.LoginAttempts(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts[0] != (db.LoginAttempts{}) {
+		t.Errorf("expected the failure and block to expire but got %+v", attempts[0])
+	}
+
+	if err := store.ResetLogin(ctx, key, other); err != nil {
+		t.Fatal(err)
+	}
+	attempts, err = store.LoginAttempts(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts[0] != (db.LoginAttempts{}) {
+		t.Errorf("expected a reset to forget everything but got %+v", attempts[0])
+	}
+}
@@ -0,0 +1,455 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CacheEvictChannel is the Redis channel on which API instances tell each
+// other which keys to drop from their local caches.
+const CacheEvictChannel = "cache:evict"
+
+// LocalCacheOptions size the in-process tier of a TieredCacheStore. Size is
+// the most entries kept; TTL is the longest an entry is served locally,
+// which bounds how stale it can get if an eviction message is lost.
+type LocalCacheOptions struct {
+	Size int
+	TTL  time.Duration
+}
+
+var DefaultLocalCacheOptions = LocalCacheOptions{
+	Size: 10000,
+	TTL:  30 * time.Second,
+}
+
+// Environment variables overriding DefaultLocalCacheOptions. A size of 0
+// turns the local tier off.
+const (
+	CacheLocalSizeEnvName = "CACHE_LOCAL_SIZE"
+	CacheLocalTTLEnvName  = "CACHE_LOCAL_TTL"
+)
+
+// LocalCacheOptionsFromEnv returns DefaultLocalCacheOptions with the
+// overrides set in the environment.
+func LocalCacheOptionsFromEnv() (LocalCacheOptions, error) {
+	opts := DefaultLocalCacheOptions
+	if value := os.Getenv(CacheLocalSizeEnvName); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return opts, fmt.Errorf("%s must be a non-negative number, got %q", CacheLocalSizeEnvName, value)
+		}
+		opts.Size = size
+	}
+	if value := os.Getenv(CacheLocalTTLEnvName); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return opts, fmt.Errorf("%s must be a positive duration, got %q", CacheLocalTTLEnvName, value)
+		}
+		opts.TTL = ttl
+	}
+	return opts, nil
+}
+
+// TieredCacheStore keeps recently used entries in process in front of
+// Redis. Every write also evicts the keys it touches from the other
+// instances through CacheEvictChannel.
+//
+// Calls to Redis go through a CacheBreaker, if given, so while it is open
+// the local tier keeps serving and filling on its own. Without one, or
+// before it opens, the write methods return Redis's error once the local
+// tier is updated. Evictions published meanwhile are lost, so the local
+// tier is cleared whenever the subscription is lost or restored.
+type TieredCacheStore struct {
+	remote  *RedisCacheStore
+	breaker *CacheBreaker
+	local   *lruCache
+	ttl     time.Duration
+	// id marks this instance's eviction messages, which it skips.
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// evictMessage is published on CacheEvictChannel.
+type evictMessage struct {
+	From   string   `json:"from"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// NewTieredCacheStore puts a local tier in front of client. breaker, which
+// may be nil, guards the calls to client and should ping it.
+func NewTieredCacheStore(client *redis.Client, breaker *CacheBreaker, opts LocalCacheOptions) *TieredCacheStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TieredCacheStore{
+		remote:  NewRedisCacheStore(client),
+		breaker: breaker,
+		local:   newLRUCache(opts.Size),
+		ttl:     opts.TTL,
+		id:      bson.NewObjectID().Hex(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go c.listen(ctx, client.Subscribe(ctx, CacheEvictChannel))
+	return c
+}
+
+// Close stops listening for evictions.
+func (c *TieredCacheStore) Close() error {
+	c.cancel()
+	<-c.done
+	return nil
+}
+
+// listen applies the evictions of other instances until ctx is done.
+func (c *TieredCacheStore) listen(ctx context.Context, pubsub *redis.PubSub) {
+	defer close(c.done)
+	defer pubsub.Close()
+	connected := false
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			// Subscribed, possibly again after an outage.
+			c.local.clear()
+			connected = true
+		case *redis.Message:
+			c.evict(msg.Payload)
+		}
+		if err != nil {
+			if connected {
+				log.Printf("cache eviction channel lost: %v", err)
+				c.local.clear()
+				connected = false
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func (c *TieredCacheStore) evict(payload string) {
+	var msg evictMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.From == c.id {
+		return
+	}
+	c.local.delete(msg.Keys...)
+	if msg.Prefix != "" {
+		c.local.deletePrefix(msg.Prefix)
+	}
+}
+
+func (c *TieredCacheStore) publish(ctx context.Context, msg evictMessage) error {
+	msg.From = c.id
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.remote.client.Publish(ctx, CacheEvictChannel, payload).Err()
+}
+
+func (c *TieredCacheStore) Get(ctx context.Context, key string) (string, error) {
+	values, err := c.GetMany(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// GetMany reads the keys missing locally from Redis in one round trip and
+// keeps them locally no longer than Redis will.
+func (c *TieredCacheStore) GetMany(ctx context.Context, keys ...string) ([]string, error) {
+	values := make([]string, len(keys))
+	var missing []int
+	now := time.Now()
+	for i, key := range keys {
+		if val, ok := c.local.get(key, now); ok {
+			values[i] = val
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	missingKeys := make([]string, len(missing))
+	for j, i := range missing {
+		missingKeys[j] = keys[i]
+	}
+	var (
+		remote []string
+		ttls   []time.Duration
+	)
+	skipped, err := c.breaker.call(ctx, false, func(ctx context.Context) (err error) {
+		remote, ttls, err = c.remote.getWithTTL(ctx, missingKeys...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skipped {
+		return values, nil
+	}
+	for j, i := range missing {
+		if remote[j] == "" {
+			continue
+		}
+		values[i] = remote[j]
+		ttl := c.ttl
+		if ttls[j] > 0 {
+			ttl = min(ttl, ttls[j])
+		}
+		c.local.set(keys[i], remote[j], ttl)
+	}
+	return values, nil
+}
+
+func (c *TieredCacheStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.SetWithTags(ctx, key, value, expiration)
+}
+
+func (c *TieredCacheStore) SetWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) error {
+	ttl := c.ttl
+	if expiration > 0 {
+		ttl = min(ttl, expiration)
+	}
+	c.local.set(key, cacheString(value), ttl, tags...)
+	_, err := c.breaker.call(ctx, false, func(ctx context.Context) error {
+		if err := c.remote.SetWithTags(ctx, key, value, expiration, tags...); err != nil {
+			return err
+		}
+		return c.publish(ctx, evictMessage{Keys: []string{key}})
+	})
+	return err
+}
+
+func (c *TieredCacheStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	c.local.delete(keys...)
+	_, err := c.breaker.call(ctx, true, func(ctx context.Context) error {
+		if err := c.remote.Delete(ctx, keys...); err != nil {
+			return err
+		}
+		return c.publish(ctx, evictMessage{Keys: keys})
+	})
+	return err
+}
+
+// DeleteTags drops the keys this instance filed under the tags at once and
+// learns the rest, filed by any instance, from Redis. It returns the keys
+// dropped from either tier.
+func (c *TieredCacheStore) DeleteTags(ctx context.Context, tags ...string) ([]string, error) {
+	local := c.local.deleteTags(tags...)
+	var remote []string
+	_, err := c.breaker.call(ctx, true, func(ctx context.Context) (err error) {
+		remote, err = c.remote.DeleteTags(ctx, tags...)
+		c.local.delete(remote...)
+		if err != nil || len(remote) == 0 {
+			return err
+		}
+		return c.publish(ctx, evictMessage{Keys: remote})
+	})
+	keys := remote
+	for _, key := range local {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, err
+}
+
+func (c *TieredCacheStore) DeletePrefix(ctx context.Context, prefix string) error {
+	c.local.deletePrefix(prefix)
+	_, err := c.breaker.call(ctx, true, func(ctx context.Context) error {
+		if err := c.remote.DeletePrefix(ctx, prefix); err != nil {
+			return err
+		}
+		return c.publish(ctx, evictMessage{Prefix: prefix})
+	})
+	return err
+}
+
+// CountPrefix counts the keys in Redis, which holds every key cached
+// locally. It reports none while the breaker is open.
+func (c *TieredCacheStore) CountPrefix(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	_, err := c.breaker.call(ctx, false, func(ctx context.Context) (err error) {
+		n, err = c.remote.CountPrefix(ctx, prefix)
+		return err
+	})
+	return n, err
+}
+
+// IncrRank and TopRanked go straight to Redis, which rankings are shared in.
+func (c *TieredCacheStore) IncrRank(ctx context.Context, ranking, member string) error {
+	_, err := c.breaker.call(ctx, false, func(ctx context.Context) error {
+		return c.remote.IncrRank(ctx, ranking, member)
+	})
+	return err
+}
+
+func (c *TieredCacheStore) TopRanked(ctx context.Context, ranking string, n int) ([]string, error) {
+	members := []string{}
+	_, err := c.breaker.call(ctx, false, func(ctx context.Context) (err error) {
+		members, err = c.remote.TopRanked(ctx, ranking, n)
+		return err
+	})
+	return members, err
+}
+
+// cacheString converts a value the way go-redis writes it to the wire, for
+// the values the cached stores set.
+func cacheString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lruCache is a bounded map of entries with a TTL that drops the least
+// recently used entry when full.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *lruEntry, most recently used first
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+}
+
+type lruEntry struct {
+	key     string
+	value   string
+	expires time.Time
+	tags    []string
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: map[string]*list.Element{},
+		tags:  map[string]map[string]struct{}{},
+	}
+}
+
+func (l *lruCache) get(key string, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*lruEntry)
+	if !now.Before(entry.expires) {
+		l.remove(el)
+		return "", false
+	}
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (l *lruCache) set(key, value string, ttl time.Duration, tags ...string) {
+	if l.size <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl), tags: tags}
+	l.items[key] = l.order.PushFront(entry)
+	for _, tag := range tags {
+		if l.tags[tag] == nil {
+			l.tags[tag] = map[string]struct{}{}
+		}
+		l.tags[tag][key] = struct{}{}
+	}
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *lruCache) delete(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.remove(el)
+		}
+	}
+}
+
+// deleteTags drops the entries filed under the tags and returns their keys.
+func (l *lruCache) deleteTags(tags ...string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var deleted []string
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			l.remove(l.items[key])
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted
+}
+
+func (l *lruCache) deletePrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, el := range l.items {
+		if strings.HasPrefix(key, prefix) {
+			l.remove(el)
+		}
+	}
+}
+
+func (l *lruCache) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.order.Init()
+	clear(l.items)
+	clear(l.tags)
+}
+
+func (l *lruCache) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// remove drops an entry and its tags. The caller holds l.mu.
+func (l *lruCache) remove(el *list.Element) {
+	entry := l.order.Remove(el).(*lruEntry)
+	delete(l.items, entry.key)
+	for _, tag := range entry.tags {
+		delete(l.tags[tag], entry.key)
+		if len(l.tags[tag]) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+}
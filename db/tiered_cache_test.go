@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLRUCache(t *testing.T) {
+	l := newLRUCache(2)
+	now := time.Now()
+	l.set("a", "1", time.Minute, "t")
+	l.set("b", "2", time.Minute)
+	if _, ok := l.get("a", now); !ok {
+		t.Fatal("expected a hit for a")
+	}
+	// b is now the least recently used and makes room for c.
+	l.set("c", "3", time.Minute, "t")
+	if _, ok := l.get("b", now); ok {
+		t.Error("expected b to be evicted")
+	}
+	if l.len() != 2 {
+		t.Errorf("expected 2 entries but got %d", l.len())
+	}
+	if _, ok := l.get("a", now.Add(2*time.Minute)); ok {
+		t.Error("expected a to expire")
+	}
+
+	l.set("a", "1", time.Minute, "t")
+	l.deleteTags("t")
+	if l.len() != 0 || len(l.tags) != 0 {
+		t.Errorf("expected the tag to drop every entry but %d remain, tags %v", l.len(), l.tags)
+	}
+	l.set("hotel-1", "1", time.Minute)
+	l.set("hotels-1", "1", time.Minute)
+	l.deletePrefix("hotel-")
+	if _, ok := l.get("hotels-1", now); !ok || l.len() != 1 {
+		t.Error("expected only hotel-1 to be dropped by its prefix")
+	}
+}
+
+// TestTieredCacheWithoutRedis checks that the local tier keeps serving when
+// Redis cannot be reached.
+func TestTieredCacheWithoutRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+	c := NewTieredCacheStore(client, nil, LocalCacheOptions{Size: 10, TTL: time.Minute})
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetWithTags(ctx, "hotel-1", []byte(`{"name":"foo"}`), time.Minute, "hotel:1"); err == nil {
+		t.Error("expected Set to report that Redis is down")
+	}
+	val, err := c.Get(ctx, "hotel-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != `{"name":"foo"}` {
+		t.Errorf("expected the local copy but got %q", val)
+	}
+	if _, err := c.Get(ctx, "hotel-2"); err == nil {
+		t.Error("expected a local miss to report that Redis is down")
+	}
+
+	c.DeleteTags(ctx, "hotel:1")
+	if _, ok := c.local.get("hotel-1", time.Now()); ok {
+		t.Error("expected DeleteTags to drop the local copy even without Redis")
+	}
+}
+
+// TestTieredCacheBreakerOpen checks that an open breaker only stops the
+// calls to Redis: the local tier keeps serving and filling.
+func TestTieredCacheBreakerOpen(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+	breaker := NewCacheBreaker(NewRedisCacheStore(client), func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}, CacheBreakerOptions{Timeout: time.Second, Failures: 1, ProbeInterval: time.Minute})
+	defer breaker.Close()
+	c := NewTieredCacheStore(client, breaker, LocalCacheOptions{Size: 10, TTL: time.Minute})
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.SetWithTags(ctx, "hotel-1", "foo", time.Minute, "hotel:1"); err == nil {
+		t.Error("expected the Set that trips the breaker to report that Redis is down")
+	}
+	if status := breaker.Status(); status.State != CacheBreakerOpen {
+		t.Fatalf("expected the breaker to open but got %+v", status)
+	}
+
+	if val, err := c.Get(ctx, "hotel-1"); err != nil || val != "foo" {
+		t.Errorf("expected the local copy while the breaker is open but got %q, %v", val, err)
+	}
+	if err := c.Set(ctx, "hotel-2", "bar", time.Minute); err != nil {
+		t.Errorf("expected an open breaker to skip Redis but got %v", err)
+	}
+	if val, err := c.Get(ctx, "hotel-2"); err != nil || val != "bar" {
+		t.Errorf("expected the local tier to fill while the breaker is open but got %q, %v", val, err)
+	}
+	if val, err := c.Get(ctx, "hotel-3"); err != nil || val != "" {
+		t.Errorf("expected a quiet miss while the breaker is open but got %q, %v", val, err)
+	}
+	if keys, err := c.DeleteTags(ctx, "hotel:1"); err != nil || len(keys) != 1 || keys[0] != "hotel-1" {
+		t.Errorf("expected DeleteTags to drop the local copy but got %v, %v", keys, err)
+	}
+	if !breaker.dirty {
+		t.Error("expected the skipped invalidation to mark Redis for a flush")
+	}
+}
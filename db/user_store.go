@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/raminfathi/GoTel/types"
 
@@ -11,6 +12,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 const userColl = "users"
@@ -24,10 +26,14 @@ type UserStore interface {
 	Droper
 
 	GetUserByID(context.Context, string) (*types.User, error)
-	GetUsers(context.Context) ([]*types.User, error)
+	GetUsers(context.Context, *Pagination) ([]*types.User, *PageInfo, error)
 	InsertUser(context.Context, *types.User) (*types.User, error)
+	// DeleteUser soft-deletes the user. Their bookings are kept and their
+	// email stays taken.
 	DeleteUser(context.Context, string) error
-	UpdateUser(ctx context.Context, filter Map, params types.UpdateUserParams) error
+	// UpdateUser changes the given fields of a user. version is the version
+	// the caller read, or 0 to update unconditionally.
+	UpdateUser(ctx context.Context, id string, params types.UpdateUserParams, version int64) error
 	GetUserByEmail(context.Context, string) (*types.User, error)
 }
 
@@ -47,78 +53,76 @@ func NewMongoUserStore(client *mongo.Client) *MongoUserStore {
 		coll:   client.Database(dbname).Collection(userColl),
 	}
 }
+
+// Indexes declares the indexes the users collection needs. The unique email
+// index is what actually prevents duplicate registrations.
+func (s *MongoUserStore) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+}
+
+func (s *MongoUserStore) EnsureIndexes(ctx context.Context) error {
+	return ensureIndexes(ctx, s.coll, s.Indexes())
+}
+
 func (s *MongoUserStore) Drop(ctx context.Context) error {
 	fmt.Println("--- dropping user collection")
 	return s.coll.Drop(ctx)
 }
-func (s *MongoUserStore) UpdateUser(ctx context.Context, filter Map, params types.UpdateUserParams) error {
-	oid, err := bson.ObjectIDFromHex(filter["_id"].(string))
+func (s *MongoUserStore) UpdateUser(ctx context.Context, id string, params types.UpdateUserParams, version int64) error {
+	oid, err := ParseID(id)
 	if err != nil {
 		return err
 	}
-	filter["_id"] = oid
-	update := bson.M{"$set": params.ToBSON()}
-	_, err = s.coll.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	}
-	return nil
+	return versionedUpdate(ctx, s.coll, "user", oid, version, bson.M{"$set": params.ToBSON()})
 }
 
 func (s *MongoUserStore) DeleteUser(ctx context.Context, id string) error {
-	oid, err := bson.ObjectIDFromHex(id)
+	oid, err := ParseID(id)
 	if err != nil {
 		return err
 	}
 
-	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": oid})
-	if err != nil {
-		return err
-	}
-
-	if res.DeletedCount == 0 {
-		return fmt.Errorf("user with id %s not found", id)
-	}
-
-	return nil
+	return softDelete(ctx, s.coll, "user", oid)
 }
 
 func (s *MongoUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
 	res, err := s.coll.InsertOne(ctx, user)
 	if err != nil {
-		return nil, err
+		return nil, mongoErr("user", err)
 	}
 	user.ID = res.InsertedID.(bson.ObjectID)
 	return user, nil
 }
 
 func (s *MongoUserStore) GetUserByID(ctx context.Context, id string) (*types.User, error) {
-	oid, err := bson.ObjectIDFromHex(id)
+	oid, err := ParseID(id)
 	if err != nil {
 		return nil, err
 	}
 	var user types.User
-	if err := s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&user); err != nil {
-		return nil, err
+	if err := s.coll.FindOne(ctx, notDeleted(ctx, bson.M{"_id": oid})).Decode(&user); err != nil {
+		return nil, mongoErr("user", err)
 	}
 	return &user, nil
 }
 func (s *MongoUserStore) GetUserByEmail(ctx context.Context, Email string) (*types.User, error) {
 
 	var user types.User
-	if err := s.coll.FindOne(ctx, bson.M{"email": Email}).Decode(&user); err != nil {
-		return nil, err
+	if err := s.coll.FindOne(ctx, notDeleted(ctx, bson.M{"email": Email})).Decode(&user); err != nil {
+		return nil, mongoErr("user", err)
 	}
 	return &user, nil
 }
-func (s *MongoUserStore) GetUsers(ctx context.Context) ([]*types.User, error) {
-	cur, err := s.coll.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	var users []*types.User
-	if err := cur.All(ctx, &users); err != nil {
-		return []*types.User{}, nil
-	}
-	return users, nil
+func (s *MongoUserStore) GetUsers(ctx context.Context, pag *Pagination) ([]*types.User, *PageInfo, error) {
+	return findPage(ctx, s.coll, notDeleted(ctx, bson.M{}), pag, func(u *types.User) bson.ObjectID { return u.ID })
 }
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Hotels, rooms and users carry a version that starts at 1 and goes up by
+// one on every write. Update methods take the version the caller last read
+// and fail with ErrStaleVersion if it changed since; version 0 skips the
+// check.
+
+// versionedUpdate applies update to the live document with the given id,
+// bumps its version and stamps updatedAt, provided a non-zero version still
+// matches.
+func versionedUpdate(ctx context.Context, coll *mongo.Collection, resource string, oid bson.ObjectID, version int64, update bson.M) error {
+	filter := bson.M{"_id": oid, "deletedAt": nil}
+	if version > 0 {
+		filter["version"] = version
+	}
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["updatedAt"] = time.Now()
+	update["$set"] = set
+	update["$inc"] = bson.M{"version": 1}
+	res, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoErr(resource, err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	if version > 0 {
+		n, err := coll.CountDocuments(ctx, bson.M{"_id": oid, "deletedAt": nil})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return StaleVersion(resource)
+		}
+	}
+	return NotFound(resource)
+}
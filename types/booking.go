@@ -14,6 +14,10 @@ type Booking struct {
 	FromDate   time.Time     `bson:"fromDate,omitempty" json:"fromDate,omitempty"`
 	TillDate   time.Time     `bson:"tillDate,omitempty" json:"tillDate,omitempty"`
 	Canceled   bool          `bson:"canceled" json:"canceled"`
+
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
 }
 type BookRoomParams struct {
 	FromDate   time.Time `json:"fromDate" validate:"required"`
@@ -0,0 +1,20 @@
+package types
+
+// CacheFamilyStats describes a family of cached reads: how many keys it has
+// in the cache now, and how this instance's reads of it were served since
+// it started. Stale hits were served while a refresh ran.
+type CacheFamilyStats struct {
+	Family    string  `json:"family"`
+	Prefix    string  `json:"prefix"`
+	Keys      int64   `json:"keys"`
+	Hits      int64   `json:"hits"`
+	StaleHits int64   `json:"staleHits"`
+	Misses    int64   `json:"misses"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+// CachePurgeReport tells what an admin purge dropped.
+type CachePurgeReport struct {
+	Family string `json:"family"`
+	Key    string `json:"key,omitempty"`
+}
@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// Health is the state of the API and the services it depends on. Status is
+// "ok", or "degraded" while the API works around a failing dependency.
+type Health struct {
+	Status string       `json:"status"`
+	Cache  *CacheHealth `json:"cache,omitempty"`
+}
+
+// CacheHealth is the state of the breaker in front of the cache. While it
+// is "open" the cache is bypassed; Since is when it last changed state.
+type CacheHealth struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError,omitempty"`
+}
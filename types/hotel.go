@@ -1,34 +1,99 @@
 package types
 
 import (
+	"fmt"
+	"time"
+
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 type Hotel struct {
-	ID       bson.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
-	Name     string          `bson:"name" json:"name"`
-	Location string          `bson:"location" json:"location"`
-	Rooms    []bson.ObjectID `bson:"rooms" json:"rooms"`
-	Rating   int             `bson:"rating" json:"rating"`
+	ID          bson.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string          `bson:"name" json:"name"`
+	Location    string          `bson:"location" json:"location"`
+	Description string          `bson:"description,omitempty" json:"description,omitempty"`
+	Rooms       []bson.ObjectID `bson:"rooms" json:"rooms"`
+	Rating      int             `bson:"rating" json:"rating"`
+	Version     int64           `bson:"version" json:"version"`
+	// Coordinates is where the hotel is, if known.
+	Coordinates *GeoPoint `bson:"coordinates,omitempty" json:"coordinates,omitempty"`
+	// Distance is the distance in meters from the point of a near search.
+	// It is only set on search results and never stored.
+	Distance *float64 `bson:"distance,omitempty" json:"distance,omitempty"`
+	// Score is the relevance of the hotel to a text search, higher being
+	// better. It is only set on search results and never stored.
+	Score *float64 `bson:"score,omitempty" json:"score,omitempty"`
+
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
 }
 
 type HotelQueryParams struct {
 	Rating int `query:"rating" json:"rating"`
 }
 type ResourceResp struct {
-	Results int `json:"results"`
-	Data    any `json:"data"`
-	Page    int `json:"page"`
+	Results    int    `json:"results"`
+	Data       any    `json:"data"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	Total      int64  `json:"total"`
+	TotalPages int    `json:"totalPages"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// GeoPoint is a GeoJSON point. Coordinates are [longitude, latitude], the
+// order GeoJSON and Mongo's 2dsphere index expect.
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
 }
 
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{
+		Type:        "Point",
+		Coordinates: []float64{lng, lat},
+	}
+}
+
+func (p GeoPoint) Lat() float64 { return p.Coordinates[1] }
+func (p GeoPoint) Lng() float64 { return p.Coordinates[0] }
+
+// ValidCoordinates reports whether lat and lng name a point on Earth.
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// LocationSuggestion is an autocomplete entry for a location prefix.
+type LocationSuggestion struct {
+	Location string `bson:"_id" json:"location"`
+	Hotels   int    `bson:"hotels" json:"hotels"`
+}
+
+// DeleteHotelReport lists everything removing a hotel touched.
+type DeleteHotelReport struct {
+	HotelID          bson.ObjectID   `json:"hotelId"`
+	DeletedRooms     []bson.ObjectID `json:"deletedRooms"`
+	CanceledBookings []bson.ObjectID `json:"canceledBookings"`
+	PurgedCacheKeys  []string        `json:"purgedCacheKeys"`
+}
+
+// MaxDescriptionLen caps the length of a hotel description.
+const MaxDescriptionLen = 2000
+
 type CreateHotelParams struct {
-	Name     string `json:"name" validate:"required,min=3,max=100"`
-	Location string `json:"location" validate:"required,min=3,max=100"`
+	Name        string `json:"name" validate:"required,min=3,max=100"`
+	Location    string `json:"location" validate:"required,min=3,max=100"`
+	Description string `json:"description" validate:"max=2000"`
+	// Lat and Lng are optional, but must be given together.
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
 }
 
 type UpdateHotelParams struct {
-	Name     string `json:"name" validate:"omitempty,min=3,max=100"` // omitempty یعنی اگر نفرستاد گیر نده
-	Location string `json:"location" validate:"omitempty,min=3,max=100"`
+	Name        string `json:"name" validate:"omitempty,min=3,max=100"` // omitempty یعنی اگر نفرستاد گیر نده
+	Location    string `json:"location" validate:"omitempty,min=3,max=100"`
+	Description string `json:"description" validate:"max=2000"`
 }
 
 func (p CreateHotelParams) Validate() map[string]string {
@@ -39,5 +104,36 @@ func (p CreateHotelParams) Validate() map[string]string {
 	if len(p.Location) < 3 {
 		errors["location"] = "location must be at least 3 characters"
 	}
+	if len(p.Description) > MaxDescriptionLen {
+		errors["description"] = fmt.Sprintf("description must be at most %d characters", MaxDescriptionLen)
+	}
+	switch {
+	case (p.Lat == nil) != (p.Lng == nil):
+		errors["coordinates"] = "lat and lng must be given together"
+	case p.Lat != nil && !ValidCoordinates(*p.Lat, *p.Lng):
+		errors["coordinates"] = "lat must be within ±90 and lng within ±180"
+	}
+	return errors
+}
+
+func (p UpdateHotelParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if p.Name != "" && len(p.Name) < 3 {
+		errors["name"] = "name must be at least 3 characters"
+	}
+	if p.Location != "" && len(p.Location) < 3 {
+		errors["location"] = "location must be at least 3 characters"
+	}
+	if len(p.Description) > MaxDescriptionLen {
+		errors["description"] = fmt.Sprintf("description must be at most %d characters", MaxDescriptionLen)
+	}
 	return errors
 }
+
+// Coordinates returns the point given by Lat and Lng, or nil.
+func (p CreateHotelParams) Coordinates() *GeoPoint {
+	if p.Lat == nil || p.Lng == nil {
+		return nil
+	}
+	return NewGeoPoint(*p.Lat, *p.Lng)
+}
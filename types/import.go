@@ -0,0 +1,55 @@
+package types
+
+// ImportHotel is a hotel of a bulk import together with its rooms. Row is
+// where it appears in the source: the line of a CSV file or the position in
+// a JSON array, starting at 1. Errors holds the fields that could not be
+// read; the import adds those Validate finds.
+type ImportHotel struct {
+	Row    int               `json:"-"`
+	Errors map[string]string `json:"-"`
+	CreateHotelParams
+	Rooms []ImportRoom `json:"rooms"`
+}
+
+// ImportRoom is a room of an ImportHotel. Its HotelID is filled in by the
+// import. Row is the line of a CSV file or the position among the hotel's
+// rooms in JSON.
+type ImportRoom struct {
+	Row    int               `json:"-"`
+	Errors map[string]string `json:"-"`
+	CreateRoomParams
+}
+
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	// ImportValid marks what a dry run would have created.
+	ImportValid   ImportStatus = "valid"
+	ImportInvalid ImportStatus = "invalid"
+	// ImportSkipped marks valid rooms of a hotel that was not imported.
+	ImportSkipped ImportStatus = "skipped"
+	// ImportFailed marks valid rows the store refused.
+	ImportFailed ImportStatus = "failed"
+)
+
+// ImportReport tells how each row of a bulk import fared. A hotel is only
+// imported if it and all its rooms are valid. Hotels and Rooms count what
+// was created, or what would be in a dry run; Rejected counts the hotels
+// that were not imported.
+type ImportReport struct {
+	DryRun   bool           `json:"dryRun"`
+	Hotels   int            `json:"hotels"`
+	Rooms    int            `json:"rooms"`
+	Rejected int            `json:"rejected"`
+	Results  []ImportResult `json:"results"`
+}
+
+type ImportResult struct {
+	Row    int               `json:"row"`
+	Name   string            `json:"name,omitempty"`
+	ID     string            `json:"id,omitempty"`
+	Status ImportStatus      `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+	Rooms  []ImportResult    `json:"rooms,omitempty"`
+}
@@ -1,6 +1,10 @@
 package types
 
-import "go.mongodb.org/mongo-driver/v2/bson"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
 
 type RoomType int
 
@@ -17,6 +21,11 @@ type Room struct {
 	BasePrice float64       `bson:"basePrice" json:"basePrice"`
 	Price     float64       `bson:"price" json:"price"`
 	HotelID   bson.ObjectID `bson:"hotelID" json:"hotelId"`
+	Version   int64         `bson:"version" json:"version"`
+
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
 }
 
 // ---------------------------------------------
@@ -41,3 +50,66 @@ func (p CreateRoomParams) Validate() map[string]string {
 	}
 	return errors
 }
+
+// String returns the lower-case name of the room type.
+func (t RoomType) String() string {
+	switch t {
+	case Single:
+		return "single"
+	case Double:
+		return "double"
+	case SeaView:
+		return "seaview"
+	case KingSuite:
+		return "kingsuite"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRoomType maps a room type name, as String writes it, to a RoomType.
+// It reports false for unknown names.
+func ParseRoomType(name string) (RoomType, bool) {
+	switch name {
+	case "single":
+		return Single, true
+	case "double":
+		return Double, true
+	case "seaview":
+		return SeaView, true
+	case "kingsuite":
+		return KingSuite, true
+	}
+	return 0, false
+}
+
+// RoomTypeFromName maps the room type names CreateRoomParams takes to a
+// RoomType. Unknown names give a single room.
+func RoomTypeFromName(name string) RoomType {
+	if t, ok := ParseRoomType(name); ok {
+		return t
+	}
+	return Single
+}
+
+// UpdateRoomParams changes a room; zero fields keep their current value.
+// Type uses the same numbers as Room.Type.
+type UpdateRoomParams struct {
+	Type      RoomType `json:"type"`
+	BasePrice float64  `json:"basePrice"`
+	Price     float64  `json:"price"`
+}
+
+func (p UpdateRoomParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if p.Type != 0 && (p.Type < Single || p.Type > KingSuite) {
+		errors["type"] = "unknown room type"
+	}
+	if p.BasePrice < 0 {
+		errors["basePrice"] = "price must be greater than 0"
+	}
+	if p.Price < 0 {
+		errors["price"] = "price must be greater than 0"
+	}
+	return errors
+}
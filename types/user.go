@@ -7,9 +7,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	bcrypetCost = 12
-)
+// BcryptCost is the cost user passwords are hashed with.
+const BcryptCost = 12
 
 type CreateUserParams struct {
 	FirstName string `json:"firstName" validate:"required,min=2,max=50"`
@@ -30,10 +29,13 @@ type User struct {
 	EncryptedPassword string        `bson:"encryptedPassword" json:"-"`
 	IsAdmin           bool          `bson:"isAdmin" json:"isAdmin"`
 	CreatedAt         time.Time     `bson:"createdAt" json:"createdAt"`
+	UpdatedAt         time.Time     `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt         *time.Time    `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	Version           int64         `bson:"version" json:"version"`
 }
 
 func NewUserFromParams(params CreateUserParams) (*User, error) {
-	encpw, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypetCost)
+	encpw, err := bcrypt.GenerateFromPassword([]byte(params.Password), BcryptCost)
 	if err != nil {
 		return nil, err
 	}